@@ -2,23 +2,41 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/events"
 	httpserver "github.com/lutefd/baseline-api/internal/http"
+	"github.com/lutefd/baseline-api/internal/outbox"
+	"github.com/lutefd/baseline-api/internal/projections"
 	"github.com/lutefd/baseline-api/internal/storage/postgres"
+	"github.com/lutefd/baseline-api/internal/syncer"
+	"github.com/lutefd/baseline-api/internal/tombstones"
 )
 
 type config struct {
-	Port          string
-	DatabaseURL   string
-	APIToken      string
-	DefaultUserID uuid.UUID
+	Port               string
+	DatabaseURL        string
+	APIToken           string
+	DefaultUserID      uuid.UUID
+	TombstoneRetention time.Duration
+	TombstoneGCEvery   time.Duration
+	PendingRetention   time.Duration
+	PendingExpiryEvery time.Duration
+	ProjectionDebounce time.Duration
+	ProjectionMaxDelay time.Duration
+	ProjectionWorkers  int
+	OutboxPollEvery    time.Duration
+	OutboxRetention    time.Duration
+	RebuildOnStart     bool
 }
 
 func loadConfig() (config, error) {
@@ -46,11 +64,101 @@ func loadConfig() (config, error) {
 		return config{}, err
 	}
 
+	retentionDays := 30
+	if raw := os.Getenv("TOMBSTONE_RETENTION_DAYS"); raw != "" {
+		retentionDays, err = strconv.Atoi(raw)
+		if err != nil {
+			return config{}, fmt.Errorf("TOMBSTONE_RETENTION_DAYS: %w", err)
+		}
+	}
+
+	gcEvery := time.Hour
+	if raw := os.Getenv("TOMBSTONE_GC_INTERVAL"); raw != "" {
+		gcEvery, err = time.ParseDuration(raw)
+		if err != nil {
+			return config{}, fmt.Errorf("TOMBSTONE_GC_INTERVAL: %w", err)
+		}
+	}
+
+	pendingRetention := 30 * 24 * time.Hour
+	if raw := os.Getenv("SYNC_PENDING_RETENTION"); raw != "" {
+		pendingRetention, err = time.ParseDuration(raw)
+		if err != nil {
+			return config{}, fmt.Errorf("SYNC_PENDING_RETENTION: %w", err)
+		}
+	}
+
+	pendingEvery := time.Hour
+	if raw := os.Getenv("SYNC_PENDING_EXPIRY_INTERVAL"); raw != "" {
+		pendingEvery, err = time.ParseDuration(raw)
+		if err != nil {
+			return config{}, fmt.Errorf("SYNC_PENDING_EXPIRY_INTERVAL: %w", err)
+		}
+	}
+
+	debounce := 500 * time.Millisecond
+	if raw := os.Getenv("PROJECTION_DEBOUNCE"); raw != "" {
+		debounce, err = time.ParseDuration(raw)
+		if err != nil {
+			return config{}, fmt.Errorf("PROJECTION_DEBOUNCE: %w", err)
+		}
+	}
+
+	maxDelay := 5 * time.Second
+	if raw := os.Getenv("PROJECTION_MAX_DELAY"); raw != "" {
+		maxDelay, err = time.ParseDuration(raw)
+		if err != nil {
+			return config{}, fmt.Errorf("PROJECTION_MAX_DELAY: %w", err)
+		}
+	}
+
+	projectionWorkers := 4
+	if raw := os.Getenv("PROJECTION_WORKERS"); raw != "" {
+		projectionWorkers, err = strconv.Atoi(raw)
+		if err != nil {
+			return config{}, fmt.Errorf("PROJECTION_WORKERS: %w", err)
+		}
+	}
+
+	outboxPoll := 250 * time.Millisecond
+	if raw := os.Getenv("OUTBOX_POLL_INTERVAL"); raw != "" {
+		outboxPoll, err = time.ParseDuration(raw)
+		if err != nil {
+			return config{}, fmt.Errorf("OUTBOX_POLL_INTERVAL: %w", err)
+		}
+	}
+
+	outboxRetention := 7 * 24 * time.Hour
+	if raw := os.Getenv("OUTBOX_RETENTION"); raw != "" {
+		outboxRetention, err = time.ParseDuration(raw)
+		if err != nil {
+			return config{}, fmt.Errorf("OUTBOX_RETENTION: %w", err)
+		}
+	}
+
+	rebuildOnStart := true
+	if raw := os.Getenv("PROJECTION_REBUILD_ON_START"); raw != "" {
+		rebuildOnStart, err = strconv.ParseBool(raw)
+		if err != nil {
+			return config{}, fmt.Errorf("PROJECTION_REBUILD_ON_START: %w", err)
+		}
+	}
+
 	return config{
-		Port:          port,
-		DatabaseURL:   databaseURL,
-		APIToken:      apiToken,
-		DefaultUserID: parsedUID,
+		Port:               port,
+		DatabaseURL:        databaseURL,
+		APIToken:           apiToken,
+		DefaultUserID:      parsedUID,
+		TombstoneRetention: time.Duration(retentionDays) * 24 * time.Hour,
+		TombstoneGCEvery:   gcEvery,
+		PendingRetention:   pendingRetention,
+		PendingExpiryEvery: pendingEvery,
+		ProjectionDebounce: debounce,
+		ProjectionMaxDelay: maxDelay,
+		ProjectionWorkers:  projectionWorkers,
+		OutboxPollEvery:    outboxPoll,
+		OutboxRetention:    outboxRetention,
+		RebuildOnStart:     rebuildOnStart,
 	}, nil
 }
 
@@ -67,10 +175,56 @@ func main() {
 	}
 	defer store.Close()
 
+	gcCtx, stopGC := context.WithCancel(ctx)
+	defer stopGC()
+	if cfg.TombstoneGCEvery > 0 {
+		go tombstones.NewCollector(store, cfg.TombstoneRetention).Run(gcCtx, cfg.TombstoneGCEvery)
+	}
+	if cfg.PendingRetention > 0 && cfg.PendingExpiryEvery > 0 {
+		go syncer.NewPendingExpirer(store, cfg.PendingRetention).Run(gcCtx, cfg.PendingExpiryEvery)
+	}
+
+	workerCtx, stopWorker := context.WithCancel(ctx)
+	defer stopWorker()
+	projector := projections.NewService(store).WithLock(func(ctx context.Context, userID uuid.UUID, fn func(projections.Store) error) error {
+		return store.WithUserLock(ctx, "projections", userID, func(tx *postgres.Store) error { return fn(tx) })
+	})
+	if cfg.RebuildOnStart {
+		go func() {
+			// Only one replica rebuilds; the others skip while it holds the lock.
+			ran, err := store.TryExclusive(workerCtx, "projections:rebuild-outdated", func() error {
+				rebuilt, err := projector.RebuildOutdated(workerCtx, store)
+				if rebuilt > 0 {
+					log.Printf("rebuilt %d users with outdated projections", rebuilt)
+				}
+				rated, ratingsErr := projector.RebuildOutdatedRatings(workerCtx, store)
+				if rated > 0 {
+					log.Printf("rebuilt ratings for %d users", rated)
+				}
+				return errors.Join(err, ratingsErr)
+			})
+			if err != nil {
+				log.Printf("rebuild outdated projections: %v", err)
+			} else if !ran {
+				log.Printf("rebuild outdated projections: skipped, another instance holds the lock")
+			}
+		}()
+	}
+	worker := projections.NewWorker(projector, cfg.ProjectionDebounce, cfg.ProjectionMaxDelay, cfg.ProjectionWorkers)
+	bus := events.NewBus()
+	bus.Subscribe(projections.EventSessionsChanged, worker.Handle)
+	go worker.Run(workerCtx)
+
+	dispatcher := outbox.NewDispatcher(store, bus)
+	dispatcher.Register(projections.EventSessionsChanged, outbox.JSON[projections.SessionsChanged]())
+	dispatcher.Register(syncer.EventOpponentsChanged, outbox.JSON[syncer.OpponentsChanged]())
+	go dispatcher.Run(workerCtx, cfg.OutboxPollEvery, cfg.OutboxRetention)
+
 	srv := httpserver.NewServer(httpserver.Dependencies{
-		Store:         store,
-		APIToken:      cfg.APIToken,
-		DefaultUserID: cfg.DefaultUserID,
+		Store:            store,
+		APIToken:         cfg.APIToken,
+		DefaultUserID:    cfg.DefaultUserID,
+		ProjectionWorker: worker,
 	})
 
 	httpServer := &http.Server{
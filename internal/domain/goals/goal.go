@@ -0,0 +1,110 @@
+package goals
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/stats"
+)
+
+// Comparators relate a goal's metric to its target.
+const (
+	ComparatorLT  = "lt"
+	ComparatorLTE = "lte"
+	ComparatorGT  = "gt"
+	ComparatorGTE = "gte"
+)
+
+// Goal is a target on one session feature, such as "rushingIndex lt 0.3 in
+// matches" or "composure gte 7 in 4 of the next 5 sessions".
+//
+// Only sessions on or after StartsAt (and up to EndsAt, when set) matching
+// SessionType and OpponentID count. WindowSessions fixes the goal to the first
+// that many of them; WindowDays instead keeps only those of the trailing that
+// many days. With RequiredCount the goal is met when that many sessions meet
+// the target individually; otherwise when the average over the window does.
+type Goal struct {
+	ID             uuid.UUID  `json:"id"`
+	UserID         uuid.UUID  `json:"userId"`
+	Title          string     `json:"title"`
+	Metric         string     `json:"metric"`
+	Comparator     string     `json:"comparator"`
+	Target         float64    `json:"target"`
+	SessionType    *string    `json:"sessionType,omitempty"`
+	OpponentID     *uuid.UUID `json:"opponentId,omitempty"`
+	WindowSessions *int       `json:"windowSessions,omitempty"`
+	WindowDays     *int       `json:"windowDays,omitempty"`
+	RequiredCount  *int       `json:"requiredCount,omitempty"`
+	StartsAt       time.Time  `json:"startsAt"`
+	EndsAt         *time.Time `json:"endsAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	DeletedAt      *time.Time `json:"deletedAt,omitempty"`
+}
+
+func (g Goal) Validate() error {
+	if strings.TrimSpace(g.Title) == "" {
+		return errors.New("title is required")
+	}
+	if !stats.ValidSessionFeature(g.Metric) {
+		return errors.New("metric must be a session feature")
+	}
+	switch g.Comparator {
+	case ComparatorLT, ComparatorLTE, ComparatorGT, ComparatorGTE:
+	default:
+		return errors.New("comparator must be lt, lte, gt or gte")
+	}
+	if math.IsNaN(g.Target) || math.IsInf(g.Target, 0) {
+		return errors.New("target must be a finite number")
+	}
+	if g.SessionType != nil {
+		switch *g.SessionType {
+		case "class", "friendly", "match":
+		default:
+			return errors.New("sessionType must be class, friendly or match")
+		}
+	}
+	if g.WindowSessions != nil && *g.WindowSessions < 1 {
+		return errors.New("windowSessions must be positive")
+	}
+	if g.WindowDays != nil && *g.WindowDays < 1 {
+		return errors.New("windowDays must be positive")
+	}
+	if g.WindowSessions != nil && g.WindowDays != nil {
+		return errors.New("windowSessions and windowDays are mutually exclusive")
+	}
+	if g.RequiredCount != nil {
+		if g.WindowSessions == nil {
+			return errors.New("requiredCount needs windowSessions")
+		}
+		if *g.RequiredCount < 1 || *g.RequiredCount > *g.WindowSessions {
+			return errors.New("requiredCount must be between 1 and windowSessions")
+		}
+	}
+	if g.StartsAt.IsZero() {
+		return errors.New("startsAt is required")
+	}
+	if g.EndsAt != nil && !g.EndsAt.After(g.StartsAt) {
+		return errors.New("endsAt must be after startsAt")
+	}
+	return nil
+}
+
+// Meets reports whether value satisfies the goal's comparator and target.
+func (g Goal) Meets(value float64) bool {
+	switch g.Comparator {
+	case ComparatorLT:
+		return value < g.Target
+	case ComparatorLTE:
+		return value <= g.Target
+	case ComparatorGT:
+		return value > g.Target
+	case ComparatorGTE:
+		return value >= g.Target
+	default:
+		return false
+	}
+}
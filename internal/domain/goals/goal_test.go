@@ -0,0 +1,120 @@
+package goals
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestGoalValidate(t *testing.T) {
+	valid := Goal{Title: "Stay calm", Metric: "composure", Comparator: ComparatorGTE, Target: 7, StartsAt: time.Now()}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid goal, got %v", err)
+	}
+
+	tournament := "tournament"
+	tests := []struct {
+		name   string
+		mutate func(*Goal)
+	}{
+		{name: "missing title", mutate: func(g *Goal) { g.Title = " " }},
+		{name: "unknown metric", mutate: func(g *Goal) { g.Metric = "aces" }},
+		{name: "unknown comparator", mutate: func(g *Goal) { g.Comparator = "eq" }},
+		{name: "unknown session type", mutate: func(g *Goal) { g.SessionType = &tournament }},
+		{name: "both windows", mutate: func(g *Goal) { g.WindowSessions, g.WindowDays = intPtr(5), intPtr(7) }},
+		{name: "count without window", mutate: func(g *Goal) { g.RequiredCount = intPtr(4) }},
+		{name: "count above window", mutate: func(g *Goal) { g.WindowSessions, g.RequiredCount = intPtr(5), intPtr(6) }},
+		{name: "zero start", mutate: func(g *Goal) { g.StartsAt = time.Time{} }},
+		{name: "end before start", mutate: func(g *Goal) { end := g.StartsAt.Add(-time.Hour); g.EndsAt = &end }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			item := valid
+			tc.mutate(&item)
+			if err := item.Validate(); err == nil {
+				t.Fatal("expected validation error")
+			}
+		})
+	}
+}
+
+func TestEvaluateCountGoal(t *testing.T) {
+	start := time.Date(2026, 4, 6, 18, 0, 0, 0, time.UTC)
+	goal := Goal{
+		Metric: "composure", Comparator: ComparatorGTE, Target: 7,
+		WindowSessions: intPtr(5), RequiredCount: intPtr(4), StartsAt: start,
+	}
+	session := func(day, composure int) sessions.Session {
+		return sessions.Session{ID: uuid.New(), SessionType: "class", Date: start.AddDate(0, 0, day), DurationMinutes: 60, Composure: composure}
+	}
+	items := []sessions.Session{
+		session(-1, 10), // before the goal started
+		session(0, 8),
+		session(1, 6),
+		session(2, 7),
+		session(3, 9),
+	}
+	now := start.AddDate(0, 0, 4)
+
+	got := Evaluate(goal, items, nil, now)
+	if got.Sessions != 4 || got.Hits != 3 || *got.Remaining != 1 || *got.Current != 7.5 {
+		t.Fatalf("unexpected progress: %+v", got)
+	}
+	// 3 of 4 is below the 4 of 5 pace.
+	if got.Status != StatusOffTrack {
+		t.Fatalf("expected off_track, got %s", got.Status)
+	}
+
+	got = Evaluate(goal, append(items, session(4, 7), session(5, 1)), nil, now.AddDate(0, 0, 2))
+	if got.Status != StatusAchieved || got.Sessions != 5 || got.Hits != 4 {
+		t.Fatalf("expected the fifth session to achieve the goal, got %+v", got)
+	}
+
+	got = Evaluate(goal, append(items[:3:3], session(3, 2)), nil, now)
+	if got.Status != StatusMissed {
+		t.Fatalf("expected two misses in five to miss the goal, got %+v", got)
+	}
+}
+
+func TestEvaluateAverageGoal(t *testing.T) {
+	start := time.Date(2026, 4, 6, 18, 0, 0, 0, time.UTC)
+	match := "match"
+	opponent := uuid.New()
+	goal := Goal{
+		Metric: "rushingIndex", Comparator: ComparatorLT, Target: 0.3,
+		SessionType: &match, WindowDays: intPtr(28), StartsAt: start,
+	}
+	session := func(day int, sessionType string, rushed int) sessions.Session {
+		return sessions.Session{ID: uuid.New(), SessionType: sessionType, OpponentID: &opponent, Date: start.AddDate(0, 0, day), DurationMinutes: 60, RushedShots: rushed}
+	}
+	items := []sessions.Session{
+		session(0, "match", 30), // out of the 28-day window at now
+		session(10, "match", 24),
+		session(20, "class", 60),
+		session(30, "match", 12),
+	}
+	now := start.AddDate(0, 0, 31)
+
+	got := Evaluate(goal, items, nil, now)
+	if got.Sessions != 2 || *got.Current != 0.3 || got.Remaining != nil {
+		t.Fatalf("unexpected progress: %+v", got)
+	}
+	if got.Status != StatusOffTrack {
+		t.Fatalf("expected an average of exactly the target to be off track for lt, got %s", got.Status)
+	}
+	if got.Trend.SlopePerDay != -0.01 || got.Trend.Direction != TrendImproving {
+		t.Fatalf("expected an improving trend of -0.01 per day, got %+v", got.Trend)
+	}
+
+	end := start.AddDate(0, 0, 30)
+	goal.EndsAt = &end
+	other := uuid.New()
+	goal.OpponentID = &other
+	if got := Evaluate(goal, items, nil, now); got.Status != StatusMissed || got.Current != nil {
+		t.Fatalf("expected a closed goal without sessions to be missed, got %+v", got)
+	}
+}
@@ -0,0 +1,169 @@
+package goals
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+	"github.com/lutefd/baseline-api/internal/domain/stats"
+)
+
+// Attainment statuses. Achieved and missed are final; the others can change
+// as sessions are added.
+const (
+	StatusAchieved         = "achieved"
+	StatusMissed           = "missed"
+	StatusOnTrack          = "on_track"
+	StatusOffTrack         = "off_track"
+	StatusInsufficientData = "insufficient_data"
+)
+
+// Trend directions, relative to the goal's comparator.
+const (
+	TrendImproving = "improving"
+	TrendWorsening = "worsening"
+	TrendFlat      = "flat"
+)
+
+type Trend struct {
+	SlopePerDay float64 `json:"slopePerDay"`
+	Direction   string  `json:"direction"`
+}
+
+// Progress is a goal evaluated against the sessions in its window. Current is
+// the average metric over those sessions and nil when there are none; Hits
+// counts the sessions that meet the target on their own. Remaining is the
+// number of sessions still to come in a windowSessions goal.
+type Progress struct {
+	GoalID      uuid.UUID `json:"goalId"`
+	Status      string    `json:"status"`
+	Current     *float64  `json:"current"`
+	Sessions    int       `json:"sessions"`
+	Hits        int       `json:"hits"`
+	Remaining   *int      `json:"remaining"`
+	Trend       Trend     `json:"trend"`
+	EvaluatedAt time.Time `json:"evaluatedAt"`
+}
+
+// Evaluate measures g at now against items, which may hold sessions outside
+// the goal's scope. Sessions without the metric, such as matches without a
+// result for "win", are skipped.
+func Evaluate(g Goal, items []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet, now time.Time) Progress {
+	window, values := g.window(items, setsBySession, now)
+
+	out := Progress{GoalID: g.ID, Sessions: len(window), EvaluatedAt: now}
+	var sum float64
+	for _, value := range values {
+		sum += value
+		if g.Meets(value) {
+			out.Hits++
+		}
+	}
+	if len(values) > 0 {
+		current := stats.Round(sum / float64(len(values)))
+		out.Current = &current
+	}
+	if g.WindowSessions != nil {
+		remaining := max(0, *g.WindowSessions-len(window))
+		out.Remaining = &remaining
+	}
+
+	slope := stats.FeatureSlope(g.Metric, window, setsBySession)
+	out.Trend = Trend{SlopePerDay: stats.Round(slope), Direction: g.direction(slope)}
+	out.Status = g.status(out, now)
+	return out
+}
+
+// window returns the sessions the goal is evaluated on, oldest first, with
+// their metric values.
+func (g Goal) window(items []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet, now time.Time) ([]sessions.Session, []float64) {
+	sorted := append([]sessions.Session(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	var since time.Time
+	if g.WindowDays != nil {
+		since = now.Add(-time.Duration(*g.WindowDays) * 24 * time.Hour)
+	}
+	window := make([]sessions.Session, 0)
+	values := make([]float64, 0)
+	for _, item := range sorted {
+		if g.WindowSessions != nil && len(window) == *g.WindowSessions {
+			break
+		}
+		if !g.inScope(item) || (g.WindowDays != nil && !item.Date.After(since)) {
+			continue
+		}
+		value, ok := stats.SessionFeature(g.Metric, item, setsBySession[item.ID])
+		if !ok {
+			continue
+		}
+		window = append(window, item)
+		values = append(values, value)
+	}
+	return window, values
+}
+
+func (g Goal) inScope(s sessions.Session) bool {
+	if s.IsDeleted() || s.Date.Before(g.StartsAt) || (g.EndsAt != nil && s.Date.After(*g.EndsAt)) {
+		return false
+	}
+	if g.SessionType != nil && s.SessionType != *g.SessionType {
+		return false
+	}
+	if g.OpponentID != nil && (s.OpponentID == nil || *s.OpponentID != *g.OpponentID) {
+		return false
+	}
+	return true
+}
+
+func (g Goal) status(p Progress, now time.Time) string {
+	closed := g.EndsAt != nil && now.After(*g.EndsAt)
+	if g.RequiredCount != nil {
+		required, planned := *g.RequiredCount, *g.WindowSessions
+		switch {
+		case p.Hits >= required:
+			return StatusAchieved
+		case closed || p.Hits+*p.Remaining < required:
+			return StatusMissed
+		case p.Sessions == 0:
+			return StatusInsufficientData
+		case p.Hits*planned >= required*p.Sessions:
+			// Hitting the target at the rate so far would be enough.
+			return StatusOnTrack
+		default:
+			return StatusOffTrack
+		}
+	}
+
+	if p.Current == nil {
+		if closed {
+			return StatusMissed
+		}
+		return StatusInsufficientData
+	}
+	meets := g.Meets(*p.Current)
+	if closed || (g.WindowSessions != nil && *p.Remaining == 0) {
+		if meets {
+			return StatusAchieved
+		}
+		return StatusMissed
+	}
+	if meets {
+		return StatusOnTrack
+	}
+	return StatusOffTrack
+}
+
+// direction tells whether slope moves the metric towards the target side of
+// the comparator.
+func (g Goal) direction(slope float64) string {
+	if stats.Round(slope) == 0 {
+		return TrendFlat
+	}
+	lowerIsBetter := g.Comparator == ComparatorLT || g.Comparator == ComparatorLTE
+	if (slope < 0) == lowerIsBetter {
+		return TrendImproving
+	}
+	return TrendWorsening
+}
@@ -1,6 +1,8 @@
 package opponents
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,3 +20,17 @@ type Opponent struct {
 	UpdatedAt    time.Time  `json:"updatedAt"`
 	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
 }
+
+func (o Opponent) Validate() error {
+	if strings.TrimSpace(o.Name) == "" {
+		return errors.New("name is required")
+	}
+	if o.DominantHand != nil {
+		switch *o.DominantHand {
+		case "left", "right", "unknown":
+		default:
+			return errors.New("dominantHand must be left, right or unknown")
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package sessions
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -46,3 +47,41 @@ func (s Session) IsDeleted() bool {
 func (s Session) IsMatch() bool {
 	return s.SessionType == "match" || s.SessionType == "friendly"
 }
+
+func (s Session) Validate() error {
+	switch s.SessionType {
+	case "class", "friendly", "match":
+	default:
+		return errors.New("sessionType must be class, friendly or match")
+	}
+	if s.Date.IsZero() {
+		return errors.New("date is required")
+	}
+	if s.DurationMinutes <= 0 {
+		return errors.New("durationMinutes must be positive")
+	}
+	if s.Composure < 1 || s.Composure > 10 {
+		return errors.New("composure must be between 1 and 10")
+	}
+	if s.FollowedFocus != nil {
+		switch *s.FollowedFocus {
+		case "yes", "partial", "no":
+		default:
+			return errors.New("followedFocus must be yes, partial or no")
+		}
+	}
+	return nil
+}
+
+func (m MatchSet) Validate() error {
+	if m.SessionID == uuid.Nil {
+		return errors.New("sessionId is required")
+	}
+	if m.SetNumber < 1 || m.SetNumber > 5 {
+		return errors.New("setNumber must be between 1 and 5")
+	}
+	if m.PlayerGames < 0 || m.PlayerGames > 30 || m.OpponentGames < 0 || m.OpponentGames > 30 {
+		return errors.New("games must be between 0 and 30")
+	}
+	return nil
+}
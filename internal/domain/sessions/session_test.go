@@ -0,0 +1,48 @@
+package sessions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSessionValidate(t *testing.T) {
+	valid := Session{SessionType: "match", Date: time.Now(), DurationMinutes: 60, Composure: 7}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid session, got %v", err)
+	}
+
+	maybe := "maybe"
+	tests := []struct {
+		name   string
+		mutate func(*Session)
+	}{
+		{name: "unknown type", mutate: func(s *Session) { s.SessionType = "tournament" }},
+		{name: "zero date", mutate: func(s *Session) { s.Date = time.Time{} }},
+		{name: "zero duration", mutate: func(s *Session) { s.DurationMinutes = 0 }},
+		{name: "composure too high", mutate: func(s *Session) { s.Composure = 11 }},
+		{name: "bad followed focus", mutate: func(s *Session) { s.FollowedFocus = &maybe }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			item := valid
+			tc.mutate(&item)
+			if err := item.Validate(); err == nil {
+				t.Fatalf("expected validation error")
+			}
+		})
+	}
+}
+
+func TestMatchSetValidate(t *testing.T) {
+	valid := MatchSet{SessionID: uuid.New(), SetNumber: 1, PlayerGames: 6, OpponentGames: 4}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid set, got %v", err)
+	}
+	invalid := valid
+	invalid.SetNumber = 6
+	if err := invalid.Validate(); err == nil {
+		t.Fatalf("expected set number validation error")
+	}
+}
@@ -0,0 +1,287 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+// regressionOrigin anchors the x axis of the running slope sums. The slope is
+// invariant to shifting x, so a fixed origin lets sessions be added or removed
+// without knowing the earliest date, while keeping x small enough for float64.
+var regressionOrigin = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SessionState is a session together with the set differential of its live
+// match sets, which is what opponent projections need from match_sets.
+type SessionState struct {
+	Session         sessions.Session `json:"session"`
+	SetDifferential int              `json:"setDifferential"`
+}
+
+// SessionChange is the before and after state of one session around a write.
+// Before is nil for inserts and After is nil when the row no longer exists.
+type SessionChange struct {
+	Before *SessionState `json:"before,omitempty"`
+	After  *SessionState `json:"after,omitempty"`
+}
+
+type UserAccumulator struct {
+	Sessions        int     `json:"sessions"`
+	Matches         int     `json:"matches"`
+	Wins            int     `json:"wins"`
+	ComposureSum    float64 `json:"composureSum"`
+	RushingSum      float64 `json:"rushingSum"`
+	UnforcedErrors  int     `json:"unforcedErrors"`
+	DurationMinutes int     `json:"durationMinutes"`
+	DaySum          float64 `json:"daySum"`
+	DaySqSum        float64 `json:"daySqSum"`
+	ComposureDaySum float64 `json:"composureDaySum"`
+	RushingDaySum   float64 `json:"rushingDaySum"`
+}
+
+type OpponentAccumulator struct {
+	Matches      int     `json:"matches"`
+	Wins         int     `json:"wins"`
+	ComposureSum float64 `json:"composureSum"`
+	RushingSum   float64 `json:"rushingSum"`
+	SetDiffSum   int     `json:"setDiffSum"`
+}
+
+type PeriodAccumulator struct {
+	Sessions     int     `json:"sessions"`
+	Matches      int     `json:"matches"`
+	Wins         int     `json:"wins"`
+	ComposureSum float64 `json:"composureSum"`
+	RushingSum   float64 `json:"rushingSum"`
+}
+
+// Accumulators holds the running sums of one user. Period accumulators are
+// keyed by period start in Calendar, so a calendar change needs a rebuild.
+// Version is the CalculatorVersion the sums were built with.
+type Accumulators struct {
+	Calendar  Calendar
+	Version   int
+	User      UserAccumulator
+	Opponents map[uuid.UUID]OpponentAccumulator
+	Weeks     map[time.Time]PeriodAccumulator
+	Months    map[time.Time]PeriodAccumulator
+	Years     map[time.Time]PeriodAccumulator
+}
+
+func NewAccumulators(cal Calendar) Accumulators {
+	return Accumulators{
+		Calendar:  cal,
+		Version:   CalculatorVersion,
+		Opponents: make(map[uuid.UUID]OpponentAccumulator),
+		Weeks:     make(map[time.Time]PeriodAccumulator),
+		Months:    make(map[time.Time]PeriodAccumulator),
+		Years:     make(map[time.Time]PeriodAccumulator),
+	}
+}
+
+// Periods returns the period accumulators of the given granularity, keyed by
+// period start.
+func (a Accumulators) Periods(granularity string) map[time.Time]PeriodAccumulator {
+	switch granularity {
+	case PeriodMonth:
+		return a.Months
+	case PeriodYear:
+		return a.Years
+	default:
+		return a.Weeks
+	}
+}
+
+func BuildAccumulators(cal Calendar, items []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet) Accumulators {
+	acc := NewAccumulators(cal)
+	for _, item := range items {
+		acc.Add(SessionState{Session: item, SetDifferential: SetDifferential(setsBySession[item.ID])}, 1)
+	}
+	return acc
+}
+
+const accumulatorTolerance = 1e-6
+
+// Apply folds a batch of session changes into the accumulators and resets
+// the sums of empty accumulators so rounding residue does not build up.
+func (a *Accumulators) Apply(changes []SessionChange) {
+	for _, change := range changes {
+		if change.Before != nil {
+			a.Add(*change.Before, -1)
+		}
+		if change.After != nil {
+			a.Add(*change.After, 1)
+		}
+	}
+	if a.User.Sessions == 0 {
+		a.User = UserAccumulator{}
+	}
+	for id, v := range a.Opponents {
+		if v.Matches == 0 {
+			a.Opponents[id] = OpponentAccumulator{}
+		}
+	}
+	for _, granularity := range PeriodGranularities {
+		periods := a.Periods(granularity)
+		for start, v := range periods {
+			if v.Sessions == 0 {
+				periods[start] = PeriodAccumulator{}
+			}
+		}
+	}
+}
+
+// Add adds (sign=1) or removes (sign=-1) the contribution of one session.
+// Soft-deleted sessions contribute nothing.
+func (a *Accumulators) Add(state SessionState, sign int) {
+	s := state.Session
+	if s.IsDeleted() {
+		return
+	}
+	a.User.add(s, sign)
+
+	for _, granularity := range PeriodGranularities {
+		periods := a.Periods(granularity)
+		start := a.Calendar.PeriodStart(s.Date, granularity)
+		period := periods[start]
+		period.add(s, sign)
+		periods[start] = period
+	}
+
+	if s.IsMatch() && s.OpponentID != nil {
+		opponent := a.Opponents[*s.OpponentID]
+		opponent.add(state, sign)
+		a.Opponents[*s.OpponentID] = opponent
+	}
+}
+
+// Consistent reports whether no counter went negative, which would mean the
+// accumulators had drifted from the raw tables and need a full rebuild.
+// Float sums are compared within accumulatorTolerance.
+func (a Accumulators) Consistent() bool {
+	if a.User.Sessions < 0 || a.User.Matches < 0 || a.User.Wins < 0 || a.User.DurationMinutes < 0 ||
+		negative(a.User.ComposureSum) || negative(a.User.RushingSum) {
+		return false
+	}
+	for _, v := range a.Opponents {
+		if v.Matches < 0 || v.Wins < 0 || negative(v.ComposureSum) || negative(v.RushingSum) {
+			return false
+		}
+	}
+	for _, granularity := range PeriodGranularities {
+		for _, v := range a.Periods(granularity) {
+			if v.Sessions < 0 || v.Matches < 0 || v.Wins < 0 || negative(v.ComposureSum) || negative(v.RushingSum) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func negative(sum float64) bool {
+	return sum < -accumulatorTolerance
+}
+
+func (a *UserAccumulator) add(s sessions.Session, sign int) {
+	f := float64(sign)
+	day := s.Date.Sub(regressionOrigin).Hours() / 24
+	rushing := RushingIndex(s)
+
+	a.Sessions += sign
+	a.ComposureSum += f * float64(s.Composure)
+	a.RushingSum += f * rushing
+	a.UnforcedErrors += sign * s.UnforcedErrors
+	a.DurationMinutes += sign * s.DurationMinutes
+	a.DaySum += f * day
+	a.DaySqSum += f * day * day
+	a.ComposureDaySum += f * day * float64(s.Composure)
+	a.RushingDaySum += f * day * rushing
+	if s.IsMatch() {
+		a.Matches += sign
+		if s.IsMatchWin != nil && *s.IsMatchWin {
+			a.Wins += sign
+		}
+	}
+}
+
+func (a UserAccumulator) Stats(now time.Time) UserStats {
+	out := UserStats{
+		TotalSessions:     a.Sessions,
+		TotalMatches:      a.Matches,
+		LastCalculatedAt:  now,
+		CalculatorVersion: CalculatorVersion,
+	}
+	if a.Matches > 0 {
+		out.WinRate = Round(float64(a.Wins) / float64(a.Matches))
+	}
+	if a.Sessions > 0 {
+		out.AvgComposure = Round(a.ComposureSum / float64(a.Sessions))
+		out.AvgRushingIndex = Round(a.RushingSum / float64(a.Sessions))
+	}
+	if a.DurationMinutes > 0 {
+		out.AvgUnforcedErrorsPerMin = Round(float64(a.UnforcedErrors) / float64(a.DurationMinutes))
+	}
+	if a.Sessions >= 2 {
+		out.ImprovementSlopeComposure = Round(slopeFromSums(float64(a.Sessions), a.DaySum, a.ComposureSum, a.ComposureDaySum, a.DaySqSum))
+		out.ImprovementSlopeRushing = Round(slopeFromSums(float64(a.Sessions), a.DaySum, a.RushingSum, a.RushingDaySum, a.DaySqSum))
+	}
+	return out
+}
+
+func (a *OpponentAccumulator) add(state SessionState, sign int) {
+	s := state.Session
+	f := float64(sign)
+	a.Matches += sign
+	a.ComposureSum += f * float64(s.Composure)
+	a.RushingSum += f * RushingIndex(s)
+	a.SetDiffSum += sign * state.SetDifferential
+	if s.IsMatchWin != nil && *s.IsMatchWin {
+		a.Wins += sign
+	}
+}
+
+func (a OpponentAccumulator) Stats(now time.Time) OpponentStats {
+	out := OpponentStats{MatchesPlayed: a.Matches, LastCalculatedAt: now, CalculatorVersion: CalculatorVersion}
+	if a.Matches > 0 {
+		n := float64(a.Matches)
+		out.WinRate = Round(float64(a.Wins) / n)
+		out.AvgComposure = Round(a.ComposureSum / n)
+		out.AvgRushingIndex = Round(a.RushingSum / n)
+		out.AvgSetDifferential = Round(float64(a.SetDiffSum) / n)
+	}
+	return out
+}
+
+func (a *PeriodAccumulator) add(s sessions.Session, sign int) {
+	f := float64(sign)
+	a.Sessions += sign
+	a.ComposureSum += f * float64(s.Composure)
+	a.RushingSum += f * RushingIndex(s)
+	if s.IsMatch() {
+		a.Matches += sign
+		if s.IsMatchWin != nil && *s.IsMatchWin {
+			a.Wins += sign
+		}
+	}
+}
+
+func (a PeriodAccumulator) Stats(start time.Time) PeriodStats {
+	out := PeriodStats{PeriodStartDate: start, SessionsPlayed: a.Sessions, MatchesPlayed: a.Matches, CalculatorVersion: CalculatorVersion}
+	if a.Sessions > 0 {
+		out.AvgComposure = Round(a.ComposureSum / float64(a.Sessions))
+		out.AvgRushingIndex = Round(a.RushingSum / float64(a.Sessions))
+	}
+	if a.Matches > 0 {
+		out.WinRate = Round(float64(a.Wins) / float64(a.Matches))
+	}
+	return out
+}
+
+func slopeFromSums(n, sumX, sumY, sumXY, sumX2 float64) float64 {
+	denominator := (n * sumX2) - (sumX * sumX)
+	if denominator == 0 {
+		return 0
+	}
+	return ((n * sumXY) - (sumX * sumY)) / denominator
+}
@@ -0,0 +1,111 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func TestAccumulatorsMatchFullRecompute(t *testing.T) {
+	opponentID := uuid.New()
+	win := true
+	loss := false
+	base := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	items := []sessions.Session{
+		{ID: uuid.New(), OpponentID: &opponentID, SessionType: "match", Date: base, DurationMinutes: 60, RushedShots: 8, UnforcedErrors: 4, Composure: 7, IsMatchWin: &win},
+		{ID: uuid.New(), OpponentID: &opponentID, SessionType: "match", Date: base.AddDate(0, 0, 3), DurationMinutes: 50, RushedShots: 10, UnforcedErrors: 6, Composure: 5, IsMatchWin: &loss},
+		{ID: uuid.New(), SessionType: "class", Date: base.AddDate(0, 0, 9), DurationMinutes: 45, RushedShots: 4, UnforcedErrors: 3, Composure: 8},
+	}
+
+	acc := BuildAccumulators(DefaultCalendar, items, nil)
+	got := acc.User.Stats(base)
+	if got.TotalSessions != 3 || got.TotalMatches != 2 {
+		t.Fatalf("unexpected totals: %+v", got)
+	}
+	checks := map[string][2]float64{
+		"winRate":        {got.WinRate, Round(WinRate(items[:2]))},
+		"avgComposure":   {got.AvgComposure, Round(AverageComposure(items))},
+		"avgRushing":     {got.AvgRushingIndex, Round(AverageRushingIndex(items))},
+		"ueMin":          {got.AvgUnforcedErrorsPerMin, Round(AverageUnforcedErrorsPerMin(items))},
+		"slopeComposure": {got.ImprovementSlopeComposure, Round(ImprovementSlopeComposure(items))},
+		"slopeRushing":   {got.ImprovementSlopeRushing, Round(ImprovementSlopeRushing(items))},
+	}
+	for name, pair := range checks {
+		if math.Abs(pair[0]-pair[1]) > 1e-4 {
+			t.Fatalf("%s: incremental %.4f != full %.4f", name, pair[0], pair[1])
+		}
+	}
+	if len(acc.Weeks) != 2 || acc.Opponents[opponentID].Matches != 2 {
+		t.Fatalf("unexpected week/opponent buckets: %+v / %+v", acc.Weeks, acc.Opponents)
+	}
+	month := acc.Months[time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)].Stats(base)
+	if len(acc.Months) != 1 || month.SessionsPlayed != 3 || month.MatchesPlayed != 2 || month.WinRate != 0.5 {
+		t.Fatalf("unexpected month bucket: %+v", month)
+	}
+	if len(acc.Years) != 1 {
+		t.Fatalf("expected one year bucket, got %+v", acc.Years)
+	}
+}
+
+func TestAccumulatorsApplyUpdateAndDelete(t *testing.T) {
+	base := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	first := sessions.Session{ID: uuid.New(), SessionType: "class", Date: base, DurationMinutes: 60, Composure: 4}
+	second := sessions.Session{ID: uuid.New(), SessionType: "class", Date: base.AddDate(0, 0, 1), DurationMinutes: 60, Composure: 6}
+	acc := BuildAccumulators(DefaultCalendar, []sessions.Session{first, second}, nil)
+
+	edited := second
+	edited.Composure = 10
+	deletedAt := base.AddDate(0, 0, 2)
+	deleted := first
+	deleted.DeletedAt = &deletedAt
+	acc.Apply([]SessionChange{
+		{Before: &SessionState{Session: second}, After: &SessionState{Session: edited}},
+		{Before: &SessionState{Session: first}, After: &SessionState{Session: deleted}},
+	})
+
+	if !acc.Consistent() {
+		t.Fatalf("expected accumulators to stay consistent")
+	}
+	got := acc.User.Stats(base)
+	if got.TotalSessions != 1 || got.AvgComposure != 10 {
+		t.Fatalf("unexpected stats after update and delete: %+v", got)
+	}
+	if got.ImprovementSlopeComposure != 0 {
+		t.Fatalf("expected slope to reset with a single session, got %.4f", got.ImprovementSlopeComposure)
+	}
+
+	acc.Add(SessionState{Session: first}, -1)
+	acc.Add(SessionState{Session: first}, -1)
+	if acc.Consistent() {
+		t.Fatalf("expected negative counts to be reported as inconsistent")
+	}
+}
+
+func TestAccumulatorsToleratesFloatDrift(t *testing.T) {
+	base := time.Date(2026, 2, 2, 18, 0, 0, 0, time.UTC)
+	items := make([]sessions.Session, 0, 3)
+	for i, rushed := range []int{1, 2, 7} {
+		items = append(items, sessions.Session{ID: uuid.New(), SessionType: "class", Date: base.AddDate(0, 0, i), DurationMinutes: 30, Composure: 7, RushedShots: rushed})
+	}
+	acc := BuildAccumulators(DefaultCalendar, items, nil)
+
+	changes := make([]SessionChange, 0, len(items))
+	for i := range items {
+		changes = append(changes, SessionChange{Before: &SessionState{Session: items[i]}})
+	}
+	acc.Apply(changes)
+	if !acc.Consistent() {
+		t.Fatalf("expected rounding residue to stay consistent, got %+v", acc.User)
+	}
+	if acc.User != (UserAccumulator{}) {
+		t.Fatalf("expected empty accumulator to be reset, got %+v", acc.User)
+	}
+
+	acc.User.Sessions, acc.User.RushingSum = 1, -0.5
+	if acc.Consistent() {
+		t.Fatalf("expected a negative rushing sum to be inconsistent")
+	}
+}
@@ -0,0 +1,139 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+const (
+	DefaultAnomalyWindow    = 20
+	DefaultAnomalyThreshold = 3.5
+	AnomalyMinBaseline      = 8
+)
+
+var AnomalyMetrics = []string{
+	FeatureDuration,
+	FeatureRushedShots,
+	FeatureUnforcedErrors,
+	FeatureLongRallies,
+	FeatureDirectionChanges,
+	FeatureComposure,
+	FeatureRushingIndex,
+}
+
+const (
+	AnomalyHigh = "high"
+	AnomalyLow  = "low"
+)
+
+type AnomalyFlag struct {
+	Metric    string  `json:"metric"`
+	Value     float64 `json:"value"`
+	Median    float64 `json:"median"`
+	MAD       float64 `json:"mad"`
+	Score     float64 `json:"score"` // 0.6745 * (value - median) / MAD
+	Direction string  `json:"direction"`
+}
+
+type SessionAnomalies struct {
+	SessionID uuid.UUID     `json:"sessionId"`
+	Date      time.Time     `json:"date"`
+	Flags     []AnomalyFlag `json:"flags"`
+}
+
+// DetectAnomalies flags metrics whose modified z-score against the previous
+// window sessions exceeds threshold. A zero MAD falls back to the scaled mean
+// absolute deviation.
+func DetectAnomalies(items []sessions.Session, window int, threshold float64) []SessionAnomalies {
+	sorted := append([]sessions.Session(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	out := make([]SessionAnomalies, 0)
+	for i, item := range sorted {
+		start := max(0, i-window)
+		if i-start < AnomalyMinBaseline {
+			continue
+		}
+		baseline := sorted[start:i]
+
+		flags := make([]AnomalyFlag, 0)
+		for _, metric := range AnomalyMetrics {
+			if flag, ok := anomalyFlag(metric, item, baseline, threshold); ok {
+				flags = append(flags, flag)
+			}
+		}
+		if len(flags) > 0 {
+			out = append(out, SessionAnomalies{SessionID: item.ID, Date: item.Date, Flags: flags})
+		}
+	}
+	return out
+}
+
+func anomalyFlag(metric string, item sessions.Session, baseline []sessions.Session, threshold float64) (AnomalyFlag, bool) {
+	value, ok := SessionFeature(metric, item, nil)
+	if !ok {
+		return AnomalyFlag{}, false
+	}
+	values := make([]float64, 0, len(baseline))
+	for _, s := range baseline {
+		if v, ok := SessionFeature(metric, s, nil); ok {
+			values = append(values, v)
+		}
+	}
+	if len(values) < AnomalyMinBaseline {
+		return AnomalyFlag{}, false
+	}
+
+	center := median(values)
+	deviations := make([]float64, len(values))
+	var meanDeviation float64
+	for i, v := range values {
+		deviations[i] = math.Abs(v - center)
+		meanDeviation += deviations[i]
+	}
+	meanDeviation /= float64(len(values))
+	mad := median(deviations)
+
+	var score float64
+	switch {
+	case mad > 0:
+		score = 0.6745 * (value - center) / mad
+	case meanDeviation > 0:
+		score = (value - center) / (1.253314 * meanDeviation)
+	default:
+		return AnomalyFlag{}, false
+	}
+	if math.Abs(score) <= threshold {
+		return AnomalyFlag{}, false
+	}
+
+	direction := AnomalyHigh
+	if score < 0 {
+		direction = AnomalyLow
+	}
+	return AnomalyFlag{
+		Metric:    metric,
+		Value:     Round(value),
+		Median:    Round(center),
+		MAD:       Round(mad),
+		Score:     Round(score),
+		Direction: direction,
+	}, true
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
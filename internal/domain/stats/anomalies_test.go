@@ -0,0 +1,57 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	start := time.Date(2026, 5, 4, 18, 0, 0, 0, time.UTC)
+	unforced := []int{5, 6, 4, 5, 7, 5, 6, 4, 5, 6}
+	items := make([]sessions.Session, 0, len(unforced)+2)
+	for i, ue := range unforced {
+		items = append(items, sessions.Session{
+			ID: uuid.New(), SessionType: "class", Date: start.AddDate(0, 0, i),
+			DurationMinutes: 60, Composure: 6 + i%2, UnforcedErrors: ue, RushedShots: 3 + i%3, LongRallies: 4, DirectionChanges: 10 + i%2,
+		})
+	}
+	spike := sessions.Session{
+		ID: uuid.New(), SessionType: "match", Date: start.AddDate(0, 0, len(unforced)),
+		DurationMinutes: 60, Composure: 6, UnforcedErrors: 18, RushedShots: 4, LongRallies: 4, DirectionChanges: 10,
+	}
+	// The spike is in the baseline of the last session but does not move the median.
+	items = append(items, spike, sessions.Session{
+		ID: uuid.New(), SessionType: "class", Date: start.AddDate(0, 0, len(unforced)+1),
+		DurationMinutes: 60, Composure: 7, UnforcedErrors: 6, RushedShots: 4, LongRallies: 4, DirectionChanges: 11,
+	})
+
+	got := DetectAnomalies(items, DefaultAnomalyWindow, DefaultAnomalyThreshold)
+	if len(got) != 1 || got[0].SessionID != spike.ID {
+		t.Fatalf("expected only the spike to be flagged, got %+v", got)
+	}
+	var flagged *AnomalyFlag
+	for i, flag := range got[0].Flags {
+		if flag.Metric == FeatureUnforcedErrors {
+			flagged = &got[0].Flags[i]
+		}
+	}
+	// Baseline median 5, MAD 1: 0.6745 * 13 / 1.
+	if flagged == nil || flagged.Median != 5 || flagged.MAD != 1 || flagged.Score != 8.7685 || flagged.Direction != AnomalyHigh {
+		t.Fatalf("unexpected unforced errors flag: %+v", got[0].Flags)
+	}
+}
+
+func TestDetectAnomaliesNeedsBaseline(t *testing.T) {
+	start := time.Date(2026, 5, 4, 18, 0, 0, 0, time.UTC)
+	items := make([]sessions.Session, 0, AnomalyMinBaseline)
+	for i := 0; i < AnomalyMinBaseline-1; i++ {
+		items = append(items, sessions.Session{ID: uuid.New(), Date: start.AddDate(0, 0, i), DurationMinutes: 60, Composure: 5, UnforcedErrors: 4 + i%2})
+	}
+	items = append(items, sessions.Session{ID: uuid.New(), Date: start.AddDate(0, 0, AnomalyMinBaseline), DurationMinutes: 60, Composure: 5, UnforcedErrors: 40})
+	if got := DetectAnomalies(items, DefaultAnomalyWindow, DefaultAnomalyThreshold); len(got) != 0 {
+		t.Fatalf("expected no flags without a full baseline, got %+v", got)
+	}
+}
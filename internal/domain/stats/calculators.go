@@ -8,6 +8,11 @@ import (
 	"github.com/lutefd/baseline-api/internal/domain/sessions"
 )
 
+// CalculatorVersion identifies the formulas in this package. Projection rows
+// are stamped with it; bump it whenever a change alters projected values so
+// that stored projections get rebuilt.
+const CalculatorVersion = 1
+
 func RushingIndex(s sessions.Session) float64 {
 	if s.DurationMinutes <= 0 {
 		return 0
@@ -109,15 +114,26 @@ func AverageRushingIndex(items []sessions.Session) float64 {
 	return sum / float64(len(items))
 }
 
+// WeekStart returns the start of t's week in the default calendar.
 func WeekStart(t time.Time) time.Time {
-	t = t.UTC()
-	weekday := int(t.Weekday())
-	if weekday == 0 {
-		weekday = 7
-	}
-	offset := weekday - 1
-	start := t.AddDate(0, 0, -offset)
-	return time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	return DefaultCalendar.WeekStartOf(t)
+}
+
+const (
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodYear  = "year"
+)
+
+// PeriodGranularities lists the granularities kept as period projections.
+var PeriodGranularities = []string{PeriodWeek, PeriodMonth, PeriodYear}
+
+func ValidPeriodGranularity(granularity string) bool {
+	switch granularity {
+	case PeriodWeek, PeriodMonth, PeriodYear:
+		return true
+	}
+	return false
 }
 
 func Round(v float64) float64 {
@@ -0,0 +1,98 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Calendar decides which local day, week, month and year a session falls in.
+// Bucket starts are calendar dates, returned as midnight UTC of that date so
+// they compare, sort and store like the plain dates they stand for.
+type Calendar struct {
+	Location  *time.Location
+	WeekStart time.Weekday
+}
+
+// DefaultCalendar buckets in UTC with weeks starting on Monday.
+var DefaultCalendar = Calendar{Location: time.UTC, WeekStart: time.Monday}
+
+// NewCalendar loads the named IANA time zone.
+func NewCalendar(timezone string, weekStart time.Weekday) (Calendar, error) {
+	if weekStart < time.Sunday || weekStart > time.Saturday {
+		return Calendar{}, fmt.Errorf("invalid week start %d", weekStart)
+	}
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return Calendar{}, fmt.Errorf("invalid timezone %q", timezone)
+	}
+	return Calendar{Location: loc, WeekStart: weekStart}, nil
+}
+
+// ParseWeekday accepts English weekday names, case-insensitively.
+func ParseWeekday(raw string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(raw, d.String()) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q", raw)
+}
+
+func (c Calendar) location() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
+
+// Timezone returns the IANA name of the calendar's location.
+func (c Calendar) Timezone() string {
+	return c.location().String()
+}
+
+// Day returns the local calendar date of t.
+func (c Calendar) Day(t time.Time) time.Time {
+	local := t.In(c.location())
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (c Calendar) WeekStartOf(t time.Time) time.Time {
+	day := c.Day(t)
+	offset := (int(day.Weekday()) - int(c.WeekStart) + 7) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// PeriodStart returns the first date of the week, month or year containing t.
+func (c Calendar) PeriodStart(t time.Time, granularity string) time.Time {
+	day := c.Day(t)
+	switch granularity {
+	case PeriodMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case PeriodYear:
+		return time.Date(day.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return c.WeekStartOf(t)
+	}
+}
+
+// PeriodRange returns the instants at which the period containing t begins and
+// at which the next one begins, in the calendar's location.
+func (c Calendar) PeriodRange(t time.Time, granularity string) (time.Time, time.Time) {
+	start := c.PeriodStart(t, granularity)
+	var next time.Time
+	switch granularity {
+	case PeriodMonth:
+		next = start.AddDate(0, 1, 0)
+	case PeriodYear:
+		next = start.AddDate(1, 0, 0)
+	default:
+		next = start.AddDate(0, 0, 7)
+	}
+	loc := c.location()
+	return time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc),
+		time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func TestCalendarPeriodStart(t *testing.T) {
+	at := time.Date(2026, 3, 18, 15, 30, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		PeriodWeek:  time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC),
+		PeriodMonth: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		PeriodYear:  time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for granularity, want := range cases {
+		if got := DefaultCalendar.PeriodStart(at, granularity); !got.Equal(want) {
+			t.Fatalf("%s: expected %s, got %s", granularity, want, got)
+		}
+	}
+}
+
+func TestCalendarUsesLocalDateAndWeekStart(t *testing.T) {
+	cal, err := NewCalendar("America/Sao_Paulo", time.Sunday)
+	if err != nil {
+		t.Fatalf("calendar: %v", err)
+	}
+	// 22:00 on Sunday 2026-03-01 in Sao Paulo is already Monday in UTC.
+	evening := time.Date(2026, 3, 2, 1, 0, 0, 0, time.UTC)
+	if got, want := cal.Day(evening), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected local day %s, got %s", want, got)
+	}
+	if got, want := cal.WeekStartOf(evening), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected week start %s, got %s", want, got)
+	}
+	if got, want := cal.PeriodStart(time.Date(2026, 4, 1, 2, 0, 0, 0, time.UTC), PeriodMonth), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected month start %s, got %s", want, got)
+	}
+}
+
+func TestCalendarPeriodRange(t *testing.T) {
+	cal, err := NewCalendar("America/Sao_Paulo", time.Monday)
+	if err != nil {
+		t.Fatalf("calendar: %v", err)
+	}
+	start, next := cal.PeriodRange(time.Date(2026, 3, 1, 1, 0, 0, 0, time.UTC), PeriodMonth)
+	if want := time.Date(2026, 2, 1, 3, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Fatalf("expected start %s, got %s", want, start)
+	}
+	if want := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Fatalf("expected next %s, got %s", want, next)
+	}
+}
+
+func TestNewCalendarRejectsUnknownZone(t *testing.T) {
+	if _, err := NewCalendar("Mars/Olympus_Mons", time.Monday); err == nil {
+		t.Fatalf("expected error for unknown timezone")
+	}
+}
+
+func TestFatigueSignalPairsLocalDays(t *testing.T) {
+	cal, err := NewCalendar("America/Sao_Paulo", time.Monday)
+	if err != nil {
+		t.Fatalf("calendar: %v", err)
+	}
+	// Saturday 20:00 and Sunday 21:00 local; the second is Monday in UTC.
+	items := []sessions.Session{
+		{ID: uuid.New(), Date: time.Date(2026, 3, 7, 23, 0, 0, 0, time.UTC), DurationMinutes: 60, RushedShots: 6, Composure: 7},
+		{ID: uuid.New(), Date: time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC), DurationMinutes: 60, RushedShots: 12, Composure: 5},
+	}
+	if got := fatigueSignal(DefaultCalendar, items); got.AdjacentDayPairs != 0 {
+		t.Fatalf("expected no adjacent UTC days, got %+v", got)
+	}
+	got := fatigueSignal(cal, items)
+	if got.AdjacentDayPairs != 1 || got.WeekendPairs != 1 || got.SaturdayToSundayRushing == nil {
+		t.Fatalf("expected one Saturday-Sunday pair, got %+v", got)
+	}
+}
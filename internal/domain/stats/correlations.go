@@ -1,10 +1,36 @@
 package stats
 
-import "math"
+import (
+	"math"
+	"sort"
 
-import "github.com/lutefd/baseline-api/internal/domain/sessions"
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
 
-func CorrelationComposureVsWin(items []sessions.Session) *float64 {
+const (
+	// MinCorrelationSamples is the smallest usable minSamples: the Fisher-z
+	// interval divides by n-3.
+	MinCorrelationSamples = 4
+	// DefaultCorrelationSamples is the sample size below which a correlation
+	// is reported as insufficient data unless the caller asks otherwise.
+	DefaultCorrelationSamples = 10
+)
+
+// Correlation is a Pearson coefficient with its sample size, a 95% Fisher-z
+// confidence interval and a two-sided p-value for r != 0. When there are fewer
+// than the requested samples, or either variable is constant, InsufficientData
+// is set and the statistics are null.
+type Correlation struct {
+	N                int      `json:"n"`
+	R                *float64 `json:"r"`
+	CILower          *float64 `json:"ciLower"`
+	CIUpper          *float64 `json:"ciUpper"`
+	PValue           *float64 `json:"pValue"`
+	InsufficientData bool     `json:"insufficientData"`
+}
+
+func CorrelationComposureVsWin(items []sessions.Session, minSamples int) Correlation {
 	x := make([]float64, 0)
 	y := make([]float64, 0)
 	for _, s := range items {
@@ -18,10 +44,10 @@ func CorrelationComposureVsWin(items []sessions.Session) *float64 {
 			y = append(y, 0)
 		}
 	}
-	return pearson(x, y)
+	return correlate(x, y, minSamples)
 }
 
-func CorrelationRushingVsWin(items []sessions.Session) *float64 {
+func CorrelationRushingVsWin(items []sessions.Session, minSamples int) Correlation {
 	x := make([]float64, 0)
 	y := make([]float64, 0)
 	for _, s := range items {
@@ -35,10 +61,10 @@ func CorrelationRushingVsWin(items []sessions.Session) *float64 {
 			y = append(y, 0)
 		}
 	}
-	return pearson(x, y)
+	return correlate(x, y, minSamples)
 }
 
-func CorrelationFollowedFocusVsRushing(items []sessions.Session) *float64 {
+func CorrelationFollowedFocusVsRushing(items []sessions.Session, minSamples int) Correlation {
 	x := make([]float64, 0)
 	y := make([]float64, 0)
 	for _, s := range items {
@@ -52,10 +78,10 @@ func CorrelationFollowedFocusVsRushing(items []sessions.Session) *float64 {
 		x = append(x, val)
 		y = append(y, RushingIndex(s))
 	}
-	return pearson(x, y)
+	return correlate(x, y, minSamples)
 }
 
-func CorrelationLongRalliesVsWin(items []sessions.Session) *float64 {
+func CorrelationLongRalliesVsWin(items []sessions.Session, minSamples int) Correlation {
 	x := make([]float64, 0)
 	y := make([]float64, 0)
 	for _, s := range items {
@@ -69,7 +95,80 @@ func CorrelationLongRalliesVsWin(items []sessions.Session) *float64 {
 			y = append(y, 0)
 		}
 	}
-	return pearson(x, y)
+	return correlate(x, y, minSamples)
+}
+
+const (
+	CorrelationPearson  = "pearson"
+	CorrelationSpearman = "spearman"
+)
+
+func ValidCorrelationMethod(method string) bool {
+	return method == CorrelationPearson || method == CorrelationSpearman
+}
+
+// CorrelationMatrix correlates every pair of fields. Matrix[i][j] pairs
+// Fields[i] with Fields[j] over the sessions that have both.
+type CorrelationMatrix struct {
+	Method string          `json:"method"`
+	Fields []string        `json:"fields"`
+	Matrix [][]Correlation `json:"matrix"`
+}
+
+// BuildCorrelationMatrix computes the matrix of the named session features
+// with Pearson's r or Spearman's rank correlation. Spearman's interval uses
+// the Fieller et al. standard error sqrt(1.06/(n-3)) on Fisher's z; its
+// p-value uses the same t approximation as Pearson's, applied to the ranks.
+func BuildCorrelationMatrix(items []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet, fields []string, method string, minSamples int) CorrelationMatrix {
+	values, present := featureColumns(items, setsBySession, fields)
+	matrix := make([][]Correlation, len(fields))
+	for i := range fields {
+		matrix[i] = make([]Correlation, len(fields))
+	}
+	variance := pearsonZVariance
+	if method == CorrelationSpearman {
+		variance = spearmanZVariance
+	}
+	for i := range fields {
+		for j := i; j < len(fields); j++ {
+			x := make([]float64, 0, len(items))
+			y := make([]float64, 0, len(items))
+			for k := range items {
+				if present[i][k] && present[j][k] {
+					x = append(x, values[i][k])
+					y = append(y, values[j][k])
+				}
+			}
+			if method == CorrelationSpearman {
+				x, y = ranks(x), ranks(y)
+			}
+			matrix[i][j] = correlateFisher(x, y, minSamples, variance)
+			matrix[j][i] = matrix[i][j]
+		}
+	}
+	return CorrelationMatrix{Method: method, Fields: fields, Matrix: matrix}
+}
+
+// ranks returns the 1-based rank of each value, giving ties their average rank.
+func ranks(v []float64) []float64 {
+	order := make([]int, len(v))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return v[order[a]] < v[order[b]] })
+	out := make([]float64, len(v))
+	for start := 0; start < len(order); {
+		end := start + 1
+		for end < len(order) && v[order[end]] == v[order[start]] {
+			end++
+		}
+		rank := float64(start+end+1) / 2
+		for _, idx := range order[start:end] {
+			out[idx] = rank
+		}
+		start = end
+	}
+	return out
 }
 
 func followedFocusToNumeric(v string) (float64, bool) {
@@ -85,9 +184,49 @@ func followedFocusToNumeric(v string) (float64, bool) {
 	}
 }
 
-func pearson(x, y []float64) *float64 {
+// Fisher's z of Pearson's r has variance 1/(n-3); for Spearman's rho Fieller,
+// Hartley and Pearson (1957) give 1.06/(n-3).
+const (
+	pearsonZVariance  = 1.0
+	spearmanZVariance = 1.06
+)
+
+func correlate(x, y []float64, minSamples int) Correlation {
+	return correlateFisher(x, y, minSamples, pearsonZVariance)
+}
+
+func correlateFisher(x, y []float64, minSamples int, variance float64) Correlation {
+	out := Correlation{N: len(x), InsufficientData: true}
+	if len(x) < max(minSamples, MinCorrelationSamples) {
+		return out
+	}
+	r, ok := pearson(x, y)
+	if !ok {
+		return out
+	}
+	n := float64(len(x))
+	z := math.Atanh(math.Max(-1+1e-12, math.Min(1-1e-12, r)))
+	half := 1.959964 * math.Sqrt(variance/(n-3))
+	lower := Round(math.Tanh(z - half))
+	upper := Round(math.Tanh(z + half))
+	// t = r*sqrt((n-2)/(1-r^2)) has a Student t distribution with n-2
+	// degrees of freedom when the true correlation is zero.
+	p := 0.0
+	if math.Abs(r) < 1 {
+		df := n - 2
+		t := r * math.Sqrt(df/(1-r*r))
+		p = regularizedIncompleteBeta(df/2, 0.5, df/(df+t*t))
+	}
+	rounded := Round(r)
+	p = Round(p)
+	out.R, out.CILower, out.CIUpper, out.PValue = &rounded, &lower, &upper, &p
+	out.InsufficientData = false
+	return out
+}
+
+func pearson(x, y []float64) (float64, bool) {
 	if len(x) != len(y) || len(x) < 2 {
-		return nil
+		return 0, false
 	}
 	meanX := mean(x)
 	meanY := mean(y)
@@ -100,11 +239,72 @@ func pearson(x, y []float64) *float64 {
 		denY += dy * dy
 	}
 	if denX == 0 || denY == 0 {
-		return nil
+		return 0, false
+	}
+	return num / (math.Sqrt(denX) * math.Sqrt(denY)), true
+}
+
+// regularizedIncompleteBeta returns I_x(a, b), evaluated with the continued
+// fraction from Numerical Recipes.
+func regularizedIncompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+func betaContinuedFraction(a, b, x float64) float64 {
+	const (
+		maxIterations = 200
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		aa := fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
 	}
-	v := num / (math.Sqrt(denX) * math.Sqrt(denY))
-	rounded := Round(v)
-	return &rounded
+	return h
 }
 
 func mean(v []float64) float64 {
@@ -1,8 +1,10 @@
 package stats
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/lutefd/baseline-api/internal/domain/sessions"
 )
 
@@ -15,14 +17,135 @@ func TestCorrelationComposureVsWin(t *testing.T) {
 		{Composure: 8, IsMatchWin: &win},
 		{Composure: 9, IsMatchWin: &win},
 	}
-	corr := CorrelationComposureVsWin(items)
-	if corr == nil || *corr <= 0 {
-		t.Fatalf("expected positive correlation, got %v", corr)
+	corr := CorrelationComposureVsWin(items, MinCorrelationSamples)
+	if corr.InsufficientData || corr.R == nil || *corr.R <= 0 {
+		t.Fatalf("expected positive correlation, got %+v", corr)
+	}
+	if corr.N != 4 {
+		t.Fatalf("expected n=4, got %d", corr.N)
+	}
+	if *corr.CILower > *corr.R || *corr.CIUpper < *corr.R || *corr.CIUpper > 1 {
+		t.Fatalf("expected interval around r, got [%v, %v]", *corr.CILower, *corr.CIUpper)
 	}
 }
 
 func TestCorrelationInsufficientSamples(t *testing.T) {
-	if got := CorrelationRushingVsWin(nil); got != nil {
-		t.Fatalf("expected nil correlation, got %v", *got)
+	got := CorrelationRushingVsWin(nil, DefaultCorrelationSamples)
+	if !got.InsufficientData || got.R != nil || got.N != 0 {
+		t.Fatalf("expected insufficient data, got %+v", got)
+	}
+
+	win := true
+	items := []sessions.Session{
+		{Composure: 3, IsMatchWin: &win},
+		{Composure: 5, IsMatchWin: &win},
+		{Composure: 7, IsMatchWin: &win},
+		{Composure: 9, IsMatchWin: &win},
+	}
+	// Every match won: the outcome has no variance.
+	got = CorrelationComposureVsWin(items, MinCorrelationSamples)
+	if !got.InsufficientData || got.N != 4 {
+		t.Fatalf("expected insufficient data for constant outcome, got %+v", got)
+	}
+}
+
+func TestCorrelationBelowMinSamples(t *testing.T) {
+	x := []float64{1, 2, 3, 4, 5}
+	y := []float64{2, 4, 5, 4, 5}
+	if got := correlate(x, y, 6); !got.InsufficientData || got.N != 5 || got.PValue != nil {
+		t.Fatalf("expected insufficient data below minSamples, got %+v", got)
+	}
+}
+
+func TestCorrelationPValue(t *testing.T) {
+	// r = 0.7746 with n = 5; scipy.stats.pearsonr gives p = 0.1240 and the
+	// Fisher-z interval is [-0.3401, 0.9842].
+	x := []float64{1, 2, 3, 4, 5}
+	y := []float64{2, 4, 5, 4, 5}
+	got := correlate(x, y, MinCorrelationSamples)
+	if got.InsufficientData {
+		t.Fatalf("expected a correlation, got %+v", got)
+	}
+	if *got.R != 0.7746 {
+		t.Fatalf("expected r=0.7746, got %v", *got.R)
+	}
+	if *got.PValue != 0.124 {
+		t.Fatalf("expected p=0.124, got %v", *got.PValue)
+	}
+	if *got.CILower != -0.3401 || *got.CIUpper != 0.9842 {
+		t.Fatalf("unexpected interval [%v, %v]", *got.CILower, *got.CIUpper)
+	}
+}
+
+func TestRanksAverageTies(t *testing.T) {
+	got := ranks([]float64{10, 30, 20, 30, 5})
+	want := []float64{2, 4.5, 3, 4.5, 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestCorrelationMatrixSpearman(t *testing.T) {
+	win, loss := true, false
+	focus := "yes"
+	items := make([]sessions.Session, 0)
+	setsBySession := map[uuid.UUID][]sessions.MatchSet{}
+	for i := 1; i <= 6; i++ {
+		item := sessions.Session{
+			ID:              uuid.New(),
+			SessionType:     "match",
+			DurationMinutes: 60,
+			// Long rallies grow much faster than composure: monotonic but
+			// not linear.
+			Composure:   i,
+			LongRallies: i * i * i,
+			IsMatchWin:  &loss,
+		}
+		if i > 3 {
+			item.IsMatchWin = &win
+			setsBySession[item.ID] = []sessions.MatchSet{{PlayerGames: 6, OpponentGames: i - 3}}
+		}
+		if i == 1 {
+			item.FollowedFocus = &focus
+		}
+		items = append(items, item)
+	}
+	fields := []string{FeatureComposure, FeatureLongRallies, FeatureFollowedFocus, FeatureSetDifferential}
+
+	got := BuildCorrelationMatrix(items, setsBySession, fields, CorrelationSpearman, MinCorrelationSamples)
+	if got.Method != CorrelationSpearman || len(got.Matrix) != 4 || len(got.Matrix[0]) != 4 {
+		t.Fatalf("unexpected matrix shape: %+v", got)
+	}
+	if r := got.Matrix[0][1].R; r == nil || *r != 1 {
+		t.Fatalf("expected spearman 1 for a monotonic pair, got %+v", got.Matrix[0][1])
+	}
+	if got.Matrix[1][0] != got.Matrix[0][1] {
+		t.Fatalf("expected a symmetric matrix")
+	}
+	if focus := got.Matrix[0][2]; !focus.InsufficientData || focus.N != 1 {
+		t.Fatalf("expected followedFocus pairs only where recorded, got %+v", focus)
+	}
+	if diff := got.Matrix[0][3]; !diff.InsufficientData || diff.N != 3 {
+		t.Fatalf("expected setDifferential only for sessions with sets, got %+v", diff)
+	}
+
+	pearson := BuildCorrelationMatrix(items, setsBySession, fields, CorrelationPearson, MinCorrelationSamples)
+	if r := pearson.Matrix[0][1].R; r == nil || *r >= 1 {
+		t.Fatalf("expected pearson below 1 for a non-linear pair, got %+v", pearson.Matrix[0][1])
+	}
+}
+
+func TestSpearmanIntervalIsWiderThanPearson(t *testing.T) {
+	x := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	y := []float64{2, 1, 4, 3, 6, 5, 8, 7, 10, 9, 12, 11}
+
+	pearson := correlateFisher(x, y, MinCorrelationSamples, pearsonZVariance)
+	spearman := correlateFisher(x, y, MinCorrelationSamples, spearmanZVariance)
+	if *pearson.R != *spearman.R || *pearson.PValue != *spearman.PValue {
+		t.Fatalf("expected the same r and p-value, got %+v and %+v", pearson, spearman)
+	}
+	if *spearman.CILower >= *pearson.CILower || *spearman.CIUpper <= *pearson.CIUpper {
+		t.Fatalf("expected the spearman interval to contain the pearson one, got [%v,%v] and [%v,%v]",
+			*spearman.CILower, *spearman.CIUpper, *pearson.CILower, *pearson.CIUpper)
 	}
 }
@@ -82,7 +82,7 @@ type DeepInsights struct {
 	FatigueSignal               FatigueSignal               `json:"fatigueSignal"`
 }
 
-func BuildDeepInsights(items []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet, opponentNames map[uuid.UUID]string, granularity string) DeepInsights {
+func BuildDeepInsights(cal Calendar, items []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet, opponentNames map[uuid.UUID]string, granularity string) DeepInsights {
 	if granularity != "month" {
 		granularity = "week"
 	}
@@ -103,23 +103,23 @@ func BuildDeepInsights(items []sessions.Session, setsBySession map[uuid.UUID][]s
 		},
 		ComposureThresholdAnalysis: composureThresholdAnalysis(items),
 		FocusAdherenceImpact:       focusAdherenceImpact(items),
-		RallyDensityTrend: buildRateTrend(items, granularity, func(s sessions.Session) float64 {
+		RallyDensityTrend: buildRateTrend(cal, items, granularity, func(s sessions.Session) float64 {
 			if s.DurationMinutes <= 0 {
 				return 0
 			}
 			return float64(s.LongRallies) / float64(s.DurationMinutes)
 		}),
-		DirectionChangesTrend: buildRateTrend(items, granularity, func(s sessions.Session) float64 {
+		DirectionChangesTrend: buildRateTrend(cal, items, granularity, func(s sessions.Session) float64 {
 			if s.DurationMinutes <= 0 {
 				return 0
 			}
 			return float64(s.DirectionChanges) / float64(s.DurationMinutes)
 		}),
-		SetDifferentialTrend:    setDifferentialTrend(matchSessions, setsBySession, granularity),
+		SetDifferentialTrend:    setDifferentialTrend(cal, matchSessions, setsBySession, granularity),
 		OpponentBehavioralShift: opponentBehavioralShift(matchSessions, setsBySession, opponentNames),
-		WeeklyVolatility:        weeklyVolatility(items),
+		WeeklyVolatility:        weeklyVolatility(cal, items),
 		ClutchIndicator:         clutchIndicator(matchSessions, setsBySession),
-		FatigueSignal:           fatigueSignal(items),
+		FatigueSignal:           fatigueSignal(cal, items),
 	}
 
 	return insights
@@ -205,14 +205,14 @@ func focusAdherenceImpact(items []sessions.Session) map[string]InsightMetric {
 	}
 }
 
-func buildRateTrend(items []sessions.Session, granularity string, rateFn func(sessions.Session) float64) []ScalarTrendPoint {
+func buildRateTrend(cal Calendar, items []sessions.Session, granularity string, rateFn func(sessions.Session) float64) []ScalarTrendPoint {
 	type bucket struct {
 		totalRate float64
 		sessions  int
 	}
 	acc := map[time.Time]*bucket{}
 	for _, item := range items {
-		key := trendBucketStart(item.Date, granularity)
+		key := cal.PeriodStart(item.Date, granularity)
 		if _, ok := acc[key]; !ok {
 			acc[key] = &bucket{}
 		}
@@ -233,7 +233,7 @@ func buildRateTrend(items []sessions.Session, granularity string, rateFn func(se
 	return out
 }
 
-func setDifferentialTrend(matchSessions []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet, granularity string) []SetDifferentialTrendPoint {
+func setDifferentialTrend(cal Calendar, matchSessions []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet, granularity string) []SetDifferentialTrendPoint {
 	type bucket struct {
 		totalDiff int
 		matches   int
@@ -244,7 +244,7 @@ func setDifferentialTrend(matchSessions []sessions.Session, setsBySession map[uu
 		if !hasNonDeletedSets(sets) {
 			continue
 		}
-		key := trendBucketStart(item.Date, granularity)
+		key := cal.PeriodStart(item.Date, granularity)
 		if _, ok := acc[key]; !ok {
 			acc[key] = &bucket{}
 		}
@@ -313,10 +313,10 @@ func opponentBehavioralShift(matchSessions []sessions.Session, setsBySession map
 	return out
 }
 
-func weeklyVolatility(items []sessions.Session) []WeeklyVolatilityPoint {
+func weeklyVolatility(cal Calendar, items []sessions.Session) []WeeklyVolatilityPoint {
 	byWeek := map[time.Time][]sessions.Session{}
 	for _, item := range items {
-		week := WeekStart(item.Date)
+		week := cal.WeekStartOf(item.Date)
 		byWeek[week] = append(byWeek[week], item)
 	}
 
@@ -381,7 +381,8 @@ func hasNonDeletedSets(sets []sessions.MatchSet) bool {
 	return false
 }
 
-func fatigueSignal(items []sessions.Session) FatigueSignal {
+// fatigueSignal pairs sessions on consecutive local days of cal.
+func fatigueSignal(cal Calendar, items []sessions.Session) FatigueSignal {
 	if len(items) < 2 {
 		return FatigueSignal{}
 	}
@@ -397,8 +398,8 @@ func fatigueSignal(items []sessions.Session) FatigueSignal {
 	for i := 0; i < len(sorted)-1; i++ {
 		curr := sorted[i]
 		next := sorted[i+1]
-		currDay := time.Date(curr.Date.UTC().Year(), curr.Date.UTC().Month(), curr.Date.UTC().Day(), 0, 0, 0, 0, time.UTC)
-		nextDay := time.Date(next.Date.UTC().Year(), next.Date.UTC().Month(), next.Date.UTC().Day(), 0, 0, 0, 0, time.UTC)
+		currDay := cal.Day(curr.Date)
+		nextDay := cal.Day(next.Date)
 		if int(nextDay.Sub(currDay).Hours()/24) != 1 {
 			continue
 		}
@@ -444,14 +445,6 @@ func stdDev(values []float64) float64 {
 	return math.Sqrt(variance)
 }
 
-func trendBucketStart(t time.Time, granularity string) time.Time {
-	t = t.UTC()
-	if granularity == "month" {
-		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
-	}
-	return WeekStart(t)
-}
-
 func sortedTimeKeys[T any](in map[time.Time]T) []time.Time {
 	keys := make([]time.Time, 0, len(in))
 	for key := range in {
@@ -76,7 +76,7 @@ func TestBuildDeepInsights(t *testing.T) {
 		IsMatchWin:       &win,
 	}
 
-	insights := BuildDeepInsights([]sessions.Session{s1, s2, s3, s4}, map[uuid.UUID][]sessions.MatchSet{
+	insights := BuildDeepInsights(DefaultCalendar, []sessions.Session{s1, s2, s3, s4}, map[uuid.UUID][]sessions.MatchSet{
 		s1.ID: {{SessionID: s1.ID, PlayerGames: 6, OpponentGames: 4}},
 		s2.ID: {{SessionID: s2.ID, PlayerGames: 4, OpponentGames: 6}},
 		s4.ID: {{SessionID: s4.ID, PlayerGames: 6, OpponentGames: 3}},
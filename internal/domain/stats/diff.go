@@ -0,0 +1,76 @@
+package stats
+
+type UserStatsChange struct {
+	Before UserStats          `json:"before"`
+	After  UserStats          `json:"after"`
+	Delta  map[string]float64 `json:"delta"`
+}
+
+func NewUserStatsChange(before, after UserStats) UserStatsChange {
+	return UserStatsChange{Before: before, After: after, Delta: DiffUserStats(before, after)}
+}
+
+const (
+	ChangeUpdated = "updated"
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+)
+
+// ProjectionChange is one projection row that differs between two states.
+// Scope is "user", "opponent" or a period granularity, and Key identifies the
+// row within it. Delta is after-before for updated rows.
+type ProjectionChange struct {
+	Scope string             `json:"scope"`
+	Key   string             `json:"key,omitempty"`
+	Kind  string             `json:"kind"`
+	Delta map[string]float64 `json:"delta,omitempty"`
+}
+
+// DiffUserStats returns after-before for every metric that changed, keyed by
+// the metric's JSON name. LastCalculatedAt is ignored.
+func DiffUserStats(before, after UserStats) map[string]float64 {
+	out := make(metricDelta)
+	out.add("totalSessions", float64(before.TotalSessions), float64(after.TotalSessions))
+	out.add("totalMatches", float64(before.TotalMatches), float64(after.TotalMatches))
+	out.add("winRate", before.WinRate, after.WinRate)
+	out.add("avgComposure", before.AvgComposure, after.AvgComposure)
+	out.add("avgRushingIndex", before.AvgRushingIndex, after.AvgRushingIndex)
+	out.add("avgUnforcedErrorsPerMin", before.AvgUnforcedErrorsPerMin, after.AvgUnforcedErrorsPerMin)
+	out.add("improvementSlopeComposure", before.ImprovementSlopeComposure, after.ImprovementSlopeComposure)
+	out.add("improvementSlopeRushing", before.ImprovementSlopeRushing, after.ImprovementSlopeRushing)
+	out.add("calculatorVersion", float64(before.CalculatorVersion), float64(after.CalculatorVersion))
+	return out
+}
+
+// DiffOpponentStats is DiffUserStats for opponent projections.
+func DiffOpponentStats(before, after OpponentStats) map[string]float64 {
+	out := make(metricDelta)
+	out.add("matchesPlayed", float64(before.MatchesPlayed), float64(after.MatchesPlayed))
+	out.add("winRate", before.WinRate, after.WinRate)
+	out.add("avgComposure", before.AvgComposure, after.AvgComposure)
+	out.add("avgRushingIndex", before.AvgRushingIndex, after.AvgRushingIndex)
+	out.add("avgSetDifferential", before.AvgSetDifferential, after.AvgSetDifferential)
+	out.add("calculatorVersion", float64(before.CalculatorVersion), float64(after.CalculatorVersion))
+	return out
+}
+
+// DiffPeriodStats is DiffUserStats for one weekly, monthly or yearly bucket.
+func DiffPeriodStats(before, after PeriodStats) map[string]float64 {
+	out := make(metricDelta)
+	out.add("sessionsPlayed", float64(before.SessionsPlayed), float64(after.SessionsPlayed))
+	out.add("matchesPlayed", float64(before.MatchesPlayed), float64(after.MatchesPlayed))
+	out.add("winRate", before.WinRate, after.WinRate)
+	out.add("avgComposure", before.AvgComposure, after.AvgComposure)
+	out.add("avgRushingIndex", before.AvgRushingIndex, after.AvgRushingIndex)
+	out.add("calculatorVersion", float64(before.CalculatorVersion), float64(after.CalculatorVersion))
+	return out
+}
+
+// metricDelta collects after-before per metric, keeping only nonzero deltas.
+type metricDelta map[string]float64
+
+func (d metricDelta) add(name string, before, after float64) {
+	if delta := Round(after - before); delta != 0 {
+		d[name] = delta
+	}
+}
@@ -0,0 +1,32 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffUserStatsReportsOnlyChangedMetrics(t *testing.T) {
+	before := UserStats{TotalSessions: 4, WinRate: 0.5, AvgComposure: 6, LastCalculatedAt: time.Now()}
+	after := UserStats{TotalSessions: 5, WinRate: 0.6, AvgComposure: 6, LastCalculatedAt: time.Now().Add(time.Minute)}
+
+	delta := DiffUserStats(before, after)
+	if len(delta) != 2 {
+		t.Fatalf("expected 2 changed metrics, got %+v", delta)
+	}
+	if delta["totalSessions"] != 1 {
+		t.Fatalf("expected totalSessions delta 1, got %.4f", delta["totalSessions"])
+	}
+	if delta["winRate"] != 0.1 {
+		t.Fatalf("expected winRate delta 0.1, got %.4f", delta["winRate"])
+	}
+}
+
+func TestDiffPeriodStatsReportsOnlyChangedMetrics(t *testing.T) {
+	before := PeriodStats{SessionsPlayed: 3, MatchesPlayed: 1, AvgComposure: 6}
+	after := PeriodStats{SessionsPlayed: 3, MatchesPlayed: 2, AvgComposure: 6.5}
+
+	delta := DiffPeriodStats(before, after)
+	if len(delta) != 2 || delta["matchesPlayed"] != 1 || delta["avgComposure"] != 0.5 {
+		t.Fatalf("unexpected delta: %+v", delta)
+	}
+}
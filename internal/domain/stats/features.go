@@ -0,0 +1,121 @@
+package stats
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+// Numeric session features, by the names used in query parameters.
+const (
+	FeatureDuration         = "duration"
+	FeatureRushedShots      = "rushedShots"
+	FeatureUnforcedErrors   = "unforcedErrors"
+	FeatureLongRallies      = "longRallies"
+	FeatureDirectionChanges = "directionChanges"
+	FeatureComposure        = "composure"
+	FeatureRushingIndex     = "rushingIndex"
+	FeatureFollowedFocus    = "followedFocus"
+	FeatureWin              = "win"
+	FeatureSetDifferential  = "setDifferential"
+)
+
+// SessionFeatures lists every feature in response order.
+var SessionFeatures = []string{
+	FeatureDuration,
+	FeatureRushedShots,
+	FeatureUnforcedErrors,
+	FeatureLongRallies,
+	FeatureDirectionChanges,
+	FeatureComposure,
+	FeatureRushingIndex,
+	FeatureFollowedFocus,
+	FeatureWin,
+	FeatureSetDifferential,
+}
+
+func ValidSessionFeature(name string) bool {
+	for _, feature := range SessionFeatures {
+		if feature == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionFeature returns the named feature of s. It reports false when s does
+// not have one: followedFocus was not recorded, the match result is unknown,
+// or there are no sets to take a differential from.
+func SessionFeature(name string, s sessions.Session, sets []sessions.MatchSet) (float64, bool) {
+	switch name {
+	case FeatureDuration:
+		return float64(s.DurationMinutes), true
+	case FeatureRushedShots:
+		return float64(s.RushedShots), true
+	case FeatureUnforcedErrors:
+		return float64(s.UnforcedErrors), true
+	case FeatureLongRallies:
+		return float64(s.LongRallies), true
+	case FeatureDirectionChanges:
+		return float64(s.DirectionChanges), true
+	case FeatureComposure:
+		return float64(s.Composure), true
+	case FeatureRushingIndex:
+		return RushingIndex(s), true
+	case FeatureFollowedFocus:
+		if s.FollowedFocus == nil {
+			return 0, false
+		}
+		return followedFocusToNumeric(*s.FollowedFocus)
+	case FeatureWin:
+		if s.IsMatchWin == nil {
+			return 0, false
+		}
+		if *s.IsMatchWin {
+			return 1, true
+		}
+		return 0, true
+	case FeatureSetDifferential:
+		if !s.IsMatch() || !hasNonDeletedSets(sets) {
+			return 0, false
+		}
+		return float64(SetDifferential(sets)), true
+	default:
+		return 0, false
+	}
+}
+
+// featureColumns extracts fields from every session; present[i][k] reports
+// whether column i has a value for session k.
+func featureColumns(items []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet, fields []string) ([][]float64, [][]bool) {
+	values := make([][]float64, len(fields))
+	present := make([][]bool, len(fields))
+	for i, field := range fields {
+		values[i] = make([]float64, len(items))
+		present[i] = make([]bool, len(items))
+		for k, item := range items {
+			values[i][k], present[i][k] = SessionFeature(field, item, setsBySession[item.ID])
+		}
+	}
+	return values, present
+}
+
+// FeatureSlope is the least-squares change of the named feature per day
+// across the sessions that have it, or 0 with fewer than two of them.
+func FeatureSlope(name string, items []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet) float64 {
+	sorted := append([]sessions.Session(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	x := make([]float64, 0, len(sorted))
+	y := make([]float64, 0, len(sorted))
+	for _, s := range sorted {
+		value, ok := SessionFeature(name, s, setsBySession[s.ID])
+		if !ok {
+			continue
+		}
+		x = append(x, s.Date.Sub(sorted[0].Date).Hours()/24)
+		y = append(y, value)
+	}
+	return linearRegressionSlope(x, y)
+}
@@ -0,0 +1,68 @@
+package stats
+
+import "time"
+
+// HistoryDaily is the resolution of history that was not downsampled.
+const HistoryDaily = "day"
+
+// UserStatsSnapshot is the user_stats row as it stood at the end of Date, a
+// calendar date in the user's time zone.
+type UserStatsSnapshot struct {
+	Date time.Time `json:"date"`
+	UserStats
+}
+
+type HistoryValue struct {
+	Date  time.Time `json:"date"`
+	Value float64   `json:"value"`
+}
+
+// DownsampleHistory reduces snapshots, sorted by date, to at most maxPoints by
+// keeping the last snapshot of each week, month or year, whichever is the
+// finest resolution that fits. Snapshots already fitting are returned as they
+// are with resolution "day". Only cal's week start is used, since snapshot
+// dates are already local. Years are used even if they do not fit.
+func DownsampleHistory(cal Calendar, snapshots []UserStatsSnapshot, maxPoints int) ([]UserStatsSnapshot, string) {
+	if len(snapshots) <= maxPoints {
+		return snapshots, HistoryDaily
+	}
+	dates := Calendar{Location: time.UTC, WeekStart: cal.WeekStart}
+	var out []UserStatsSnapshot
+	for _, granularity := range PeriodGranularities {
+		out = out[:0]
+		for i, snapshot := range snapshots {
+			last := i == len(snapshots)-1
+			if last || !dates.PeriodStart(snapshots[i+1].Date, granularity).Equal(dates.PeriodStart(snapshot.Date, granularity)) {
+				out = append(out, snapshot)
+			}
+		}
+		if len(out) <= maxPoints {
+			return out, granularity
+		}
+	}
+	return out, PeriodYear
+}
+
+// HistorySeries splits snapshots into one series per overview metric, keyed by
+// the metric's JSON name.
+func HistorySeries(snapshots []UserStatsSnapshot) map[string][]HistoryValue {
+	metrics := map[string]func(UserStats) float64{
+		"totalSessions":             func(v UserStats) float64 { return float64(v.TotalSessions) },
+		"totalMatches":              func(v UserStats) float64 { return float64(v.TotalMatches) },
+		"winRate":                   func(v UserStats) float64 { return v.WinRate },
+		"avgComposure":              func(v UserStats) float64 { return v.AvgComposure },
+		"avgRushingIndex":           func(v UserStats) float64 { return v.AvgRushingIndex },
+		"avgUnforcedErrorsPerMin":   func(v UserStats) float64 { return v.AvgUnforcedErrorsPerMin },
+		"improvementSlopeComposure": func(v UserStats) float64 { return v.ImprovementSlopeComposure },
+		"improvementSlopeRushing":   func(v UserStats) float64 { return v.ImprovementSlopeRushing },
+	}
+	out := make(map[string][]HistoryValue, len(metrics))
+	for name, value := range metrics {
+		series := make([]HistoryValue, 0, len(snapshots))
+		for _, snapshot := range snapshots {
+			series = append(series, HistoryValue{Date: snapshot.Date, Value: value(snapshot.UserStats)})
+		}
+		out[name] = series
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func dailySnapshots(start time.Time, days int) []UserStatsSnapshot {
+	out := make([]UserStatsSnapshot, 0, days)
+	for i := 0; i < days; i++ {
+		out = append(out, UserStatsSnapshot{Date: start.AddDate(0, 0, i), UserStats: UserStats{TotalSessions: i + 1}})
+	}
+	return out
+}
+
+func TestDownsampleHistoryKeepsShortRangesDaily(t *testing.T) {
+	snapshots := dailySnapshots(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), 10)
+	got, resolution := DownsampleHistory(DefaultCalendar, snapshots, 10)
+	if resolution != HistoryDaily || len(got) != 10 {
+		t.Fatalf("expected 10 daily points, got %d at %s", len(got), resolution)
+	}
+}
+
+func TestDownsampleHistoryKeepsLastSnapshotPerPeriod(t *testing.T) {
+	// Monday 2026-03-02 through Sunday 2026-03-22: three full weeks.
+	snapshots := dailySnapshots(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), 21)
+	got, resolution := DownsampleHistory(DefaultCalendar, snapshots, 5)
+	if resolution != PeriodWeek || len(got) != 3 {
+		t.Fatalf("expected 3 weekly points, got %d at %s", len(got), resolution)
+	}
+	if got[0].TotalSessions != 7 || !got[0].Date.Equal(time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the Sunday snapshot to close the first week, got %+v", got[0])
+	}
+
+	got, resolution = DownsampleHistory(DefaultCalendar, snapshots, 2)
+	if resolution != PeriodMonth || len(got) != 1 || got[0].TotalSessions != 21 {
+		t.Fatalf("expected one monthly point with the latest snapshot, got %+v at %s", got, resolution)
+	}
+}
+
+func TestHistorySeriesSplitsMetrics(t *testing.T) {
+	snapshots := dailySnapshots(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), 2)
+	series := HistorySeries(snapshots)
+	if len(series["totalSessions"]) != 2 || series["totalSessions"][1].Value != 2 {
+		t.Fatalf("unexpected totalSessions series: %+v", series["totalSessions"])
+	}
+	if _, ok := series["improvementSlopeComposure"]; !ok {
+		t.Fatalf("expected a series for every overview metric")
+	}
+}
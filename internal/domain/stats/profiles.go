@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/opponents"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+const (
+	ProfileUnknownHand      = "unknown"
+	ProfileUnspecifiedStyle = "unspecified"
+)
+
+// ProfileMetric deltas are against all matches with a known opponent.
+type ProfileMetric struct {
+	InsightMetric
+	Opponents          int      `json:"opponents"`
+	AvgSetDifferential *float64 `json:"avgSetDifferential"`
+	DeltaRushingIndex  float64  `json:"deltaRushingIndex"`
+	DeltaComposure     float64  `json:"deltaComposure"`
+}
+
+type OpponentProfiles struct {
+	Overall        ProfileMetric            `json:"overall"`
+	ByDominantHand map[string]ProfileMetric `json:"byDominantHand"`
+	ByPlayStyle    map[string]ProfileMetric `json:"byPlayStyle"`
+}
+
+func BuildOpponentProfiles(matchSessions []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet, opponentsByID map[uuid.UUID]opponents.Opponent) OpponentProfiles {
+	all := make([]sessions.Session, 0, len(matchSessions))
+	byHand := make(map[string][]sessions.Session)
+	byStyle := make(map[string][]sessions.Session)
+	for _, item := range matchSessions {
+		if !item.IsMatch() || item.OpponentID == nil {
+			continue
+		}
+		opponent, ok := opponentsByID[*item.OpponentID]
+		if !ok {
+			continue
+		}
+		all = append(all, item)
+
+		hand := ProfileUnknownHand
+		if opponent.DominantHand != nil {
+			hand = *opponent.DominantHand
+		}
+		byHand[hand] = append(byHand[hand], item)
+
+		style := ProfileUnspecifiedStyle
+		if opponent.PlayStyle != nil && strings.TrimSpace(*opponent.PlayStyle) != "" {
+			style = strings.ToLower(strings.TrimSpace(*opponent.PlayStyle))
+		}
+		byStyle[style] = append(byStyle[style], item)
+	}
+
+	overall := buildProfileMetric(all, setsBySession, nil)
+	out := OpponentProfiles{
+		Overall:        overall,
+		ByDominantHand: make(map[string]ProfileMetric, len(byHand)),
+		ByPlayStyle:    make(map[string]ProfileMetric, len(byStyle)),
+	}
+	for hand, items := range byHand {
+		out.ByDominantHand[hand] = buildProfileMetric(items, setsBySession, &overall)
+	}
+	for style, items := range byStyle {
+		out.ByPlayStyle[style] = buildProfileMetric(items, setsBySession, &overall)
+	}
+	return out
+}
+
+func buildProfileMetric(items []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet, overall *ProfileMetric) ProfileMetric {
+	out := ProfileMetric{InsightMetric: buildInsightMetric(items)}
+
+	seen := make(map[uuid.UUID]bool)
+	var differential, withSets int
+	for _, item := range items {
+		seen[*item.OpponentID] = true
+		if sets := setsBySession[item.ID]; hasNonDeletedSets(sets) {
+			differential += SetDifferential(sets)
+			withSets++
+		}
+	}
+	out.Opponents = len(seen)
+	if withSets > 0 {
+		avg := Round(float64(differential) / float64(withSets))
+		out.AvgSetDifferential = &avg
+	}
+	if overall != nil {
+		out.DeltaRushingIndex = Round(out.AvgRushingIndex - overall.AvgRushingIndex)
+		out.DeltaComposure = Round(out.AvgComposure - overall.AvgComposure)
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/opponents"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func TestBuildOpponentProfiles(t *testing.T) {
+	win, loss := true, false
+	left, right := "left", "right"
+	counter, baseliner := "Counterpuncher ", "baseliner"
+	lefty := opponents.Opponent{ID: uuid.New(), DominantHand: &left, PlayStyle: &counter}
+	righty := opponents.Opponent{ID: uuid.New(), DominantHand: &right, PlayStyle: &baseliner}
+	mystery := opponents.Opponent{ID: uuid.New(), PlayStyle: &baseliner}
+	byID := map[uuid.UUID]opponents.Opponent{lefty.ID: lefty, righty.ID: righty, mystery.ID: mystery}
+
+	now := time.Date(2026, 7, 1, 18, 0, 0, 0, time.UTC)
+	match := func(o opponents.Opponent, result *bool, rushed, composure int) sessions.Session {
+		return sessions.Session{ID: uuid.New(), SessionType: "match", OpponentID: &o.ID, Date: now, DurationMinutes: 60, RushedShots: rushed, Composure: composure, IsMatchWin: result}
+	}
+	items := []sessions.Session{
+		match(lefty, &loss, 30, 4),
+		match(lefty, &win, 24, 6),
+		match(righty, &win, 6, 8),
+		match(mystery, &win, 12, 6),
+		// Ignored: a class, and a match without an opponent.
+		{ID: uuid.New(), SessionType: "class", OpponentID: &lefty.ID, Date: now, DurationMinutes: 60, Composure: 9},
+		{ID: uuid.New(), SessionType: "match", Date: now, DurationMinutes: 60, Composure: 1},
+	}
+	sets := map[uuid.UUID][]sessions.MatchSet{
+		items[0].ID: {{PlayerGames: 3, OpponentGames: 6}, {PlayerGames: 4, OpponentGames: 6}},
+	}
+
+	got := BuildOpponentProfiles(items, sets, byID)
+	if got.Overall.Matches != 4 || got.Overall.Opponents != 3 || got.Overall.AvgRushingIndex != 0.3 {
+		t.Fatalf("unexpected overall profile: %+v", got.Overall)
+	}
+
+	lefties := got.ByDominantHand["left"]
+	if lefties.Matches != 2 || lefties.WinRate != 0.5 || lefties.AvgRushingIndex != 0.45 || lefties.DeltaRushingIndex != 0.15 {
+		t.Fatalf("unexpected left-handed profile: %+v", lefties)
+	}
+	if lefties.AvgSetDifferential == nil || *lefties.AvgSetDifferential != -5 {
+		t.Fatalf("expected the set differential of the one match with sets, got %v", lefties.AvgSetDifferential)
+	}
+	if unknown := got.ByDominantHand[ProfileUnknownHand]; unknown.Matches != 1 || unknown.AvgSetDifferential != nil {
+		t.Fatalf("unexpected unknown-hand profile: %+v", unknown)
+	}
+
+	if style := got.ByPlayStyle["counterpuncher"]; style.Matches != 2 || style.DeltaComposure != -1 {
+		t.Fatalf("expected normalized play style with a composure drop, got %+v", style)
+	}
+	if style := got.ByPlayStyle["baseliner"]; style.Matches != 2 || style.Opponents != 2 {
+		t.Fatalf("unexpected baseliner profile: %+v", style)
+	}
+}
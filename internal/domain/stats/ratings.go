@@ -0,0 +1,274 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+const (
+	InitialRating          = 1500.0
+	InitialRatingDeviation = 350.0
+	InitialVolatility      = 0.06
+	glickoScale            = 173.7178
+	glickoTau              = 0.5
+	glickoEpsilon          = 1e-6
+	// ratingPeriod is how long an idle rating takes to gain one period of
+	// uncertainty.
+	ratingPeriod = 7 * 24 * time.Hour
+)
+
+// RatingsVersion identifies the rating formulas. Rating rows are stamped with
+// it rather than CalculatorVersion, so a ratings change rebuilds only ratings.
+const RatingsVersion = 1
+
+type Rating struct {
+	Rating          float64    `json:"rating"`
+	RatingDeviation float64    `json:"ratingDeviation"`
+	Volatility      float64    `json:"volatility"`
+	Matches         int        `json:"matches"`
+	LastMatchAt     *time.Time `json:"lastMatchAt"`
+}
+
+type RatingEvent struct {
+	SessionID     uuid.UUID `json:"sessionId"`
+	OpponentID    uuid.UUID `json:"opponentId"`
+	Date          time.Time `json:"date"`
+	Won           bool      `json:"won"`
+	Score         float64   `json:"score"`
+	ExpectedScore float64   `json:"expectedScore"`
+	Player        Rating    `json:"player"`
+	Opponent      Rating    `json:"opponent"`
+}
+
+type Ratings struct {
+	Player Rating
+	// StrengthAdjustedWinRate is 0.5 plus the mean of result minus expected
+	// result, clamped to [0, 1].
+	StrengthAdjustedWinRate *float64
+	// Surprise is the sum of result minus expected result.
+	Surprise  float64
+	Opponents map[uuid.UUID]Rating
+	History   []RatingEvent
+	Version   int
+}
+
+func NewRating() Rating {
+	return Rating{Rating: InitialRating, RatingDeviation: InitialRatingDeviation, Volatility: InitialVolatility}
+}
+
+// ComputeRatings replays rated matches oldest first. A match scores 1 or 0,
+// averaged with the share of games won when it has sets.
+func ComputeRatings(matchSessions []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet) Ratings {
+	return ExtendRatings(Ratings{}, matchSessions, setsBySession)
+}
+
+// ExtendRatings rates matches played after everything in prev, continuing
+// from prev's ratings. Opponents and History hold only what those matches
+// touched.
+func ExtendRatings(prev Ratings, matchSessions []sessions.Session, setsBySession map[uuid.UUID][]sessions.MatchSet) Ratings {
+	rated := make([]sessions.Session, 0, len(matchSessions))
+	for _, item := range matchSessions {
+		if IsRatedMatch(item) {
+			rated = append(rated, item)
+		}
+	}
+	sort.SliceStable(rated, func(i, j int) bool {
+		if !rated[i].Date.Equal(rated[j].Date) {
+			return rated[i].Date.Before(rated[j].Date)
+		}
+		return rated[i].ID.String() < rated[j].ID.String()
+	})
+
+	player := resumeGlicko(prev.Player)
+	opponents := make(map[uuid.UUID]*glickoState)
+	out := Ratings{
+		Surprise:  prev.Surprise,
+		Opponents: make(map[uuid.UUID]Rating),
+		History:   make([]RatingEvent, 0, len(rated)),
+		Version:   RatingsVersion,
+	}
+	for _, item := range rated {
+		opponentID := *item.OpponentID
+		opponent, ok := opponents[opponentID]
+		if !ok {
+			opponent = resumeGlicko(prev.Opponents[opponentID])
+			opponents[opponentID] = opponent
+		}
+		player.idle(item.Date)
+		opponent.idle(item.Date)
+
+		result := 0.0
+		if *item.IsMatchWin {
+			result = 1
+		}
+		score := result
+		if share, ok := gameShare(setsBySession[item.ID]); ok {
+			score = (result + share) / 2
+		}
+		expected := player.expected(*opponent)
+		out.Surprise += result - expected
+
+		before := *player
+		player.update(*opponent, score, item.Date)
+		opponent.update(before, 1-score, item.Date)
+
+		out.History = append(out.History, RatingEvent{
+			SessionID:     item.ID,
+			OpponentID:    opponentID,
+			Date:          item.Date,
+			Won:           *item.IsMatchWin,
+			Score:         Round(score),
+			ExpectedScore: Round(expected),
+			Player:        player.rating(),
+			Opponent:      opponent.rating(),
+		})
+	}
+
+	out.Player = player.rating()
+	if player.matches > 0 {
+		adjusted := Round(math.Min(1, math.Max(0, 0.5+out.Surprise/float64(player.matches))))
+		out.StrengthAdjustedWinRate = &adjusted
+	}
+	for id, opponent := range opponents {
+		out.Opponents[id] = opponent.rating()
+	}
+	return out
+}
+
+// IsRatedMatch reports whether item counts towards the ratings.
+func IsRatedMatch(item sessions.Session) bool {
+	return item.IsMatch() && item.OpponentID != nil && item.IsMatchWin != nil
+}
+
+func gameShare(sets []sessions.MatchSet) (float64, bool) {
+	var won, total int
+	for _, set := range sets {
+		if set.DeletedAt != nil {
+			continue
+		}
+		won += set.PlayerGames
+		total += set.PlayerGames + set.OpponentGames
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return float64(won) / float64(total), true
+}
+
+type glickoState struct {
+	mu, phi, sigma float64
+	matches        int
+	last           time.Time
+}
+
+func newGlicko() *glickoState {
+	return &glickoState{phi: InitialRatingDeviation / glickoScale, sigma: InitialVolatility}
+}
+
+// resumeGlicko continues from a stored rating, or starts fresh when r was
+// never rated.
+func resumeGlicko(r Rating) *glickoState {
+	if r.Matches == 0 {
+		return newGlicko()
+	}
+	g := &glickoState{
+		mu:      (r.Rating - InitialRating) / glickoScale,
+		phi:     r.RatingDeviation / glickoScale,
+		sigma:   r.Volatility,
+		matches: r.Matches,
+	}
+	if r.LastMatchAt != nil {
+		g.last = *r.LastMatchAt
+	}
+	return g
+}
+
+func (g glickoState) rating() Rating {
+	out := Rating{
+		Rating:          Round(InitialRating + g.mu*glickoScale),
+		RatingDeviation: Round(g.phi * glickoScale),
+		Volatility:      Round(g.sigma),
+		Matches:         g.matches,
+	}
+	if g.matches > 0 {
+		last := g.last
+		out.LastMatchAt = &last
+	}
+	return out
+}
+
+func (g *glickoState) idle(now time.Time) {
+	if g.matches == 0 || !now.After(g.last) {
+		return
+	}
+	periods := float64(now.Sub(g.last)) / float64(ratingPeriod)
+	g.phi = math.Min(math.Sqrt(g.phi*g.phi+periods*g.sigma*g.sigma), InitialRatingDeviation/glickoScale)
+}
+
+func (g glickoState) expected(opponent glickoState) float64 {
+	return 1 / (1 + math.Exp(-glickoG(opponent.phi)*(g.mu-opponent.mu)))
+}
+
+// update follows steps 3 to 8 of Glickman's "Example of the Glicko-2 system".
+func (g *glickoState) update(opponent glickoState, score float64, at time.Time) {
+	g.applyGames([]glickoState{opponent}, []float64{score})
+	g.matches++
+	g.last = at
+}
+
+func (g *glickoState) applyGames(opponents []glickoState, scores []float64) {
+	var vInv, delta float64
+	for i, opponent := range opponents {
+		weight := glickoG(opponent.phi)
+		e := g.expected(opponent)
+		vInv += weight * weight * e * (1 - e)
+		delta += weight * (scores[i] - e)
+	}
+	v := 1 / vInv
+	delta *= v
+
+	g.sigma = glickoVolatility(g.phi, g.sigma, v, delta)
+	phiStar := math.Sqrt(g.phi*g.phi + g.sigma*g.sigma)
+	g.phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	g.mu += g.phi * g.phi * delta / v
+}
+
+func glickoG(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func glickoVolatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(glickoTau*glickoTau)
+	}
+	lower := a
+	var upper float64
+	if delta*delta > phi*phi+v {
+		upper = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*glickoTau) < 0 {
+			k++
+		}
+		upper = a - k*glickoTau
+	}
+	fLower, fUpper := f(lower), f(upper)
+	for math.Abs(upper-lower) > glickoEpsilon {
+		c := lower + (lower-upper)*fLower/(fUpper-fLower)
+		fc := f(c)
+		if fc*fUpper <= 0 {
+			lower, fLower = upper, fUpper
+		} else {
+			fLower /= 2
+		}
+		upper, fUpper = c, fc
+	}
+	return math.Exp(lower / 2)
+}
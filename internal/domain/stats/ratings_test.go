@@ -0,0 +1,91 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func TestGlickoMatchesGlickmanExample(t *testing.T) {
+	state := func(rating, deviation float64) glickoState {
+		return glickoState{mu: (rating - InitialRating) / glickoScale, phi: deviation / glickoScale, sigma: InitialVolatility}
+	}
+	player := state(1500, 200)
+	player.applyGames(
+		[]glickoState{state(1400, 30), state(1550, 100), state(1700, 300)},
+		[]float64{1, 0, 0},
+	)
+	got := player.rating()
+	if math.Abs(got.Rating-1464.06) > 0.01 || math.Abs(got.RatingDeviation-151.52) > 0.01 || math.Abs(got.Volatility-0.06) > 0.0001 {
+		t.Fatalf("expected 1464.06/151.52/0.06, got %+v", got)
+	}
+}
+
+func TestComputeRatings(t *testing.T) {
+	win, loss := true, false
+	strong, weak := uuid.New(), uuid.New()
+	start := time.Date(2026, 1, 5, 18, 0, 0, 0, time.UTC)
+	rout := uuid.New()
+	items := []sessions.Session{
+		{ID: uuid.New(), SessionType: "match", OpponentID: &strong, Date: start.AddDate(0, 0, 14), IsMatchWin: &loss},
+		{ID: rout, SessionType: "friendly", OpponentID: &weak, Date: start, IsMatchWin: &win},
+		{ID: uuid.New(), SessionType: "match", OpponentID: &strong, Date: start.AddDate(0, 0, 7), IsMatchWin: &loss},
+		{ID: uuid.New(), SessionType: "match", OpponentID: &weak, Date: start.AddDate(0, 0, 21), IsMatchWin: &win},
+		// Not rated: no opponent, no result.
+		{ID: uuid.New(), SessionType: "match", Date: start, IsMatchWin: &win},
+		{ID: uuid.New(), SessionType: "match", OpponentID: &weak, Date: start},
+	}
+	sets := map[uuid.UUID][]sessions.MatchSet{
+		rout: {{PlayerGames: 6, OpponentGames: 0}, {PlayerGames: 6, OpponentGames: 2}},
+	}
+
+	got := ComputeRatings(items, sets)
+	if len(got.History) != 4 || got.Player.Matches != 4 {
+		t.Fatalf("expected 4 rated matches, got %+v", got.History)
+	}
+	if !got.History[0].Date.Equal(start) || got.History[0].SessionID != rout {
+		t.Fatalf("expected chronological history, got %+v", got.History[0])
+	}
+	// (1 + 12/14) / 2
+	if got.History[0].Score != 0.9286 || got.History[0].ExpectedScore != 0.5 {
+		t.Fatalf("expected blended score 0.9286 at even odds, got %+v", got.History[0])
+	}
+	if got.Opponents[strong].Rating <= got.Opponents[weak].Rating {
+		t.Fatalf("expected the unbeaten opponent to rate higher, got %+v", got.Opponents)
+	}
+	if got.Opponents[strong].Matches != 2 || got.Opponents[strong].LastMatchAt == nil {
+		t.Fatalf("unexpected opponent rating: %+v", got.Opponents[strong])
+	}
+	if got.Player.RatingDeviation >= InitialRatingDeviation {
+		t.Fatalf("expected the deviation to shrink, got %v", got.Player.RatingDeviation)
+	}
+	// Results minus the expected scores recorded for each match.
+	surprise := (1 - 0.5) + (0 - got.History[1].ExpectedScore) + (0 - got.History[2].ExpectedScore) + (1 - got.History[3].ExpectedScore)
+	if got.StrengthAdjustedWinRate == nil || math.Abs(*got.StrengthAdjustedWinRate-(0.5+surprise/4)) > 1e-3 {
+		t.Fatalf("unexpected adjusted win rate %v", got.StrengthAdjustedWinRate)
+	}
+}
+
+func TestComputeRatingsIdleWidensDeviation(t *testing.T) {
+	win := true
+	opponent := uuid.New()
+	start := time.Date(2026, 1, 5, 18, 0, 0, 0, time.UTC)
+	match := func(at time.Time) sessions.Session {
+		return sessions.Session{ID: uuid.New(), SessionType: "match", OpponentID: &opponent, Date: at, IsMatchWin: &win}
+	}
+	soon := ComputeRatings([]sessions.Session{match(start), match(start.AddDate(0, 0, 1))}, nil)
+	late := ComputeRatings([]sessions.Session{match(start), match(start.AddDate(1, 0, 0))}, nil)
+	if late.Player.RatingDeviation <= soon.Player.RatingDeviation {
+		t.Fatalf("expected a year off to leave more uncertainty, got %v vs %v", late.Player.RatingDeviation, soon.Player.RatingDeviation)
+	}
+}
+
+func TestComputeRatingsEmpty(t *testing.T) {
+	got := ComputeRatings(nil, nil)
+	if got.Player.Rating != InitialRating || got.StrengthAdjustedWinRate != nil || len(got.History) != 0 {
+		t.Fatalf("expected an unrated player, got %+v", got)
+	}
+}
@@ -0,0 +1,116 @@
+package stats
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+// RollingPoint WinRate is nil without matches in the window. For EWMA series
+// Sessions and Matches are effective sample sizes.
+type RollingPoint struct {
+	SessionID            uuid.UUID `json:"sessionId"`
+	Date                 time.Time `json:"date"`
+	Sessions             float64   `json:"sessions"`
+	Matches              float64   `json:"matches"`
+	AvgComposure         float64   `json:"avgComposure"`
+	AvgRushingIndex      float64   `json:"avgRushingIndex"`
+	UnforcedErrorsPerMin float64   `json:"unforcedErrorsPerMin"`
+	RallyDensity         float64   `json:"rallyDensity"`
+	WinRate              *float64  `json:"winRate"`
+}
+
+type RollingSeries struct {
+	SessionWindow []RollingPoint `json:"sessionWindow"`
+	DayWindow     []RollingPoint `json:"dayWindow"`
+	EWMA          []RollingPoint `json:"ewma"`
+}
+
+// BuildRollingSeries averages items over the last window sessions, the last
+// days days, and with weights halving every halfLifeDays.
+func BuildRollingSeries(items []sessions.Session, window, days int, halfLifeDays float64) RollingSeries {
+	out := RollingSeries{
+		SessionWindow: make([]RollingPoint, 0, len(items)),
+		DayWindow:     make([]RollingPoint, 0, len(items)),
+		EWMA:          make([]RollingPoint, 0, len(items)),
+	}
+	span := time.Duration(days) * 24 * time.Hour
+	var bySession, byDay, ewma rollingSums
+	oldestDay := 0
+	for i, item := range items {
+		bySession.add(item, 1)
+		if i >= window {
+			bySession.add(items[i-window], -1)
+		}
+
+		byDay.add(item, 1)
+		for ; !items[oldestDay].Date.After(item.Date.Add(-span)); oldestDay++ {
+			byDay.add(items[oldestDay], -1)
+		}
+
+		if i > 0 {
+			elapsed := item.Date.Sub(items[i-1].Date).Hours() / 24
+			ewma.scale(math.Pow(0.5, elapsed/halfLifeDays))
+		}
+		ewma.add(item, 1)
+
+		out.SessionWindow = append(out.SessionWindow, bySession.point(item))
+		out.DayWindow = append(out.DayWindow, byDay.point(item))
+		out.EWMA = append(out.EWMA, ewma.point(item))
+	}
+	return out
+}
+
+type rollingSums struct {
+	weight, composure, rushing, unforcedErrors, rallies float64
+	matchWeight, wins                                   float64
+}
+
+func (r *rollingSums) add(s sessions.Session, weight float64) {
+	r.weight += weight
+	r.composure += weight * float64(s.Composure)
+	r.rushing += weight * RushingIndex(s)
+	if s.DurationMinutes > 0 {
+		r.unforcedErrors += weight * float64(s.UnforcedErrors) / float64(s.DurationMinutes)
+		r.rallies += weight * float64(s.LongRallies) / float64(s.DurationMinutes)
+	}
+	if s.IsMatch() {
+		r.matchWeight += weight
+		if s.IsMatchWin != nil && *s.IsMatchWin {
+			r.wins += weight
+		}
+	}
+}
+
+func (r *rollingSums) scale(f float64) {
+	r.weight *= f
+	r.composure *= f
+	r.rushing *= f
+	r.unforcedErrors *= f
+	r.rallies *= f
+	r.matchWeight *= f
+	r.wins *= f
+}
+
+func (r rollingSums) point(s sessions.Session) RollingPoint {
+	point := RollingPoint{
+		SessionID: s.ID,
+		Date:      s.Date,
+		Sessions:  Round(r.weight),
+		Matches:   Round(r.matchWeight),
+	}
+	if r.weight > 0 {
+		point.AvgComposure = Round(r.composure / r.weight)
+		point.AvgRushingIndex = Round(r.rushing / r.weight)
+		point.UnforcedErrorsPerMin = Round(r.unforcedErrors / r.weight)
+		point.RallyDensity = Round(r.rallies / r.weight)
+	}
+	// Subtracting sessions that left a window can leave a tiny residue.
+	if r.matchWeight > 1e-9 {
+		winRate := Round(r.wins / r.matchWeight)
+		point.WinRate = &winRate
+	}
+	return point
+}
@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func TestBuildRollingSeries(t *testing.T) {
+	win, loss := true, false
+	start := time.Date(2026, 3, 2, 18, 0, 0, 0, time.UTC)
+	items := []sessions.Session{
+		{SessionType: "match", Date: start, DurationMinutes: 60, Composure: 4, UnforcedErrors: 6, LongRallies: 3, IsMatchWin: &loss},
+		{SessionType: "class", Date: start.AddDate(0, 0, 1), DurationMinutes: 60, Composure: 6, UnforcedErrors: 12},
+		{SessionType: "match", Date: start.AddDate(0, 0, 10), DurationMinutes: 30, Composure: 8, LongRallies: 6, IsMatchWin: &win},
+	}
+
+	got := BuildRollingSeries(items, 2, 7, 10)
+	if len(got.SessionWindow) != 3 || len(got.DayWindow) != 3 || len(got.EWMA) != 3 {
+		t.Fatalf("expected one point per session, got %+v", got)
+	}
+
+	last := got.SessionWindow[2]
+	if last.Sessions != 2 || last.AvgComposure != 7 || last.Matches != 1 || last.WinRate == nil || *last.WinRate != 1 {
+		t.Fatalf("unexpected session window: %+v", last)
+	}
+	if second := got.SessionWindow[1]; second.WinRate == nil || *second.WinRate != 0 || second.UnforcedErrorsPerMin != 0.15 {
+		t.Fatalf("unexpected second session window: %+v", second)
+	}
+
+	// Ten days later, the 7-day window holds only the last session.
+	if day := got.DayWindow[2]; day.Sessions != 1 || day.AvgComposure != 8 || day.RallyDensity != 0.2 {
+		t.Fatalf("unexpected day window: %+v", day)
+	}
+	if day := got.DayWindow[1]; day.Sessions != 2 {
+		t.Fatalf("expected both early sessions in the day window, got %+v", day)
+	}
+
+	// Weights at the last session: 0.5^1 = 0.5 and 0.5^0.9 for the
+	// earlier two, 1 for the last one.
+	ewma := got.EWMA[2]
+	w0, w1 := 0.5, 0.535887
+	wantComposure := (4*w0 + 6*w1 + 8) / (w0 + w1 + 1)
+	if diff := ewma.AvgComposure - wantComposure; diff > 1e-3 || diff < -1e-3 {
+		t.Fatalf("expected EWMA composure %.4f, got %v", wantComposure, ewma.AvgComposure)
+	}
+	if ewma.WinRate == nil || *ewma.WinRate != Round(1/(w0+1)) {
+		t.Fatalf("expected EWMA win rate %v, got %v", Round(1/(w0+1)), ewma.WinRate)
+	}
+}
+
+func TestBuildRollingSeriesWithoutMatches(t *testing.T) {
+	items := []sessions.Session{{SessionType: "class", Date: time.Now(), DurationMinutes: 60, Composure: 5}}
+	got := BuildRollingSeries(items, 5, 28, 14)
+	if got.SessionWindow[0].WinRate != nil || got.EWMA[0].Matches != 0 {
+		t.Fatalf("expected no win rate without matches, got %+v", got.SessionWindow[0])
+	}
+}
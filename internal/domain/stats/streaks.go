@@ -0,0 +1,143 @@
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+const (
+	DefaultFormSize     = 5
+	DefaultMinComposure = 7
+)
+
+const (
+	ResultWin  = "win"
+	ResultLoss = "loss"
+)
+
+type Streak struct {
+	Length         int       `json:"length"`
+	StartSessionID uuid.UUID `json:"startSessionId"`
+	EndSessionID   uuid.UUID `json:"endSessionId"`
+	StartDate      time.Time `json:"startDate"`
+	EndDate        time.Time `json:"endDate"`
+}
+
+type ResultStreak struct {
+	Result string `json:"result"`
+	Streak
+}
+
+type FormResult struct {
+	SessionID uuid.UUID `json:"sessionId"`
+	Date      time.Time `json:"date"`
+	Won       bool      `json:"won"`
+}
+
+type Form struct {
+	Results  []FormResult `json:"results"`
+	Sequence string       `json:"sequence"`
+	Wins     int          `json:"wins"`
+	Losses   int          `json:"losses"`
+	WinRate  *float64     `json:"winRate"`
+}
+
+type Streaks struct {
+	CurrentResult        *ResultStreak `json:"currentResult"`
+	LongestWin           *Streak       `json:"longestWin"`
+	LongestLoss          *Streak       `json:"longestLoss"`
+	Form                 Form          `json:"form"`
+	CurrentFollowedFocus *Streak       `json:"currentFollowedFocus"`
+	LongestFollowedFocus *Streak       `json:"longestFollowedFocus"`
+	MinComposure         int           `json:"minComposure"`
+	CurrentComposure     *Streak       `json:"currentComposure"`
+	LongestComposure     *Streak       `json:"longestComposure"`
+}
+
+// BuildStreaks ignores sessions outside a streak's scope, so they neither
+// extend nor break it.
+func BuildStreaks(items []sessions.Session, formSize, minComposure int) Streaks {
+	sorted := append([]sessions.Session(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Date.Equal(sorted[j].Date) {
+			return sorted[i].Date.Before(sorted[j].Date)
+		}
+		return sorted[i].ID.String() < sorted[j].ID.String()
+	})
+
+	results := make([]sessions.Session, 0)
+	focus := make([]sessions.Session, 0)
+	for _, item := range sorted {
+		if item.IsMatch() && item.IsMatchWin != nil {
+			results = append(results, item)
+		}
+		if item.FollowedFocus != nil {
+			focus = append(focus, item)
+		}
+	}
+
+	won := func(s sessions.Session) bool { return *s.IsMatchWin }
+	lost := func(s sessions.Session) bool { return !*s.IsMatchWin }
+	out := Streaks{MinComposure: minComposure, Form: buildForm(results, formSize)}
+
+	currentWin, longestWin := runs(results, won)
+	currentLoss, longestLoss := runs(results, lost)
+	out.LongestWin, out.LongestLoss = longestWin, longestLoss
+	switch {
+	case currentWin != nil:
+		out.CurrentResult = &ResultStreak{Result: ResultWin, Streak: *currentWin}
+	case currentLoss != nil:
+		out.CurrentResult = &ResultStreak{Result: ResultLoss, Streak: *currentLoss}
+	}
+
+	out.CurrentFollowedFocus, out.LongestFollowedFocus = runs(focus, func(s sessions.Session) bool { return *s.FollowedFocus == "yes" })
+	out.CurrentComposure, out.LongestComposure = runs(sorted, func(s sessions.Session) bool { return s.Composure >= minComposure })
+	return out
+}
+
+// runs returns the run ending at the last session, if any, and the earliest
+// longest run.
+func runs(items []sessions.Session, qualifies func(sessions.Session) bool) (*Streak, *Streak) {
+	var current, longest *Streak
+	for _, item := range items {
+		if !qualifies(item) {
+			current = nil
+			continue
+		}
+		if current == nil {
+			current = &Streak{StartSessionID: item.ID, StartDate: item.Date}
+		}
+		current.Length++
+		current.EndSessionID, current.EndDate = item.ID, item.Date
+		if longest == nil || current.Length > longest.Length {
+			run := *current
+			longest = &run
+		}
+	}
+	return current, longest
+}
+
+func buildForm(results []sessions.Session, size int) Form {
+	recent := results[max(0, len(results)-size):]
+	out := Form{Results: make([]FormResult, 0, len(recent))}
+	sequence := make([]byte, 0, len(recent))
+	for _, item := range recent {
+		out.Results = append(out.Results, FormResult{SessionID: item.ID, Date: item.Date, Won: *item.IsMatchWin})
+		if *item.IsMatchWin {
+			out.Wins++
+			sequence = append(sequence, 'W')
+		} else {
+			out.Losses++
+			sequence = append(sequence, 'L')
+		}
+	}
+	out.Sequence = string(sequence)
+	if len(recent) > 0 {
+		winRate := Round(float64(out.Wins) / float64(len(recent)))
+		out.WinRate = &winRate
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func TestBuildStreaks(t *testing.T) {
+	win, loss := true, false
+	yes, no := "yes", "no"
+	start := time.Date(2026, 6, 1, 18, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return start.AddDate(0, 0, n) }
+	match := func(n int, result *bool, composure int, focus *string) sessions.Session {
+		return sessions.Session{ID: uuid.New(), SessionType: "match", Date: day(n), IsMatchWin: result, Composure: composure, FollowedFocus: focus}
+	}
+	items := []sessions.Session{
+		match(5, &loss, 8, &yes),
+		match(0, &win, 7, &yes),
+		match(1, &win, 9, nil),
+		{ID: uuid.New(), SessionType: "class", Date: day(2), Composure: 8, FollowedFocus: &yes},
+		match(3, nil, 7, &yes), // no result: skipped by result streaks
+		match(4, &win, 6, &no),
+		match(6, &loss, 7, &yes),
+	}
+
+	got := BuildStreaks(items, 4, 7)
+	if got.LongestWin == nil || got.LongestWin.Length != 3 || got.LongestWin.StartSessionID != items[1].ID || got.LongestWin.EndSessionID != items[5].ID {
+		t.Fatalf("unexpected longest win: %+v", got.LongestWin)
+	}
+	if got.CurrentResult == nil || got.CurrentResult.Result != ResultLoss || got.CurrentResult.Length != 2 || got.CurrentResult.EndSessionID != items[6].ID {
+		t.Fatalf("unexpected current streak: %+v", got.CurrentResult)
+	}
+	if got.Form.Sequence != "WWLL" || got.Form.Wins != 2 || *got.Form.WinRate != 0.5 {
+		t.Fatalf("unexpected form: %+v", got.Form)
+	}
+
+	// Days 0, 2, 3 say yes (day 1 recorded nothing), day 4 says no.
+	if got.LongestFollowedFocus == nil || got.LongestFollowedFocus.Length != 3 || got.LongestFollowedFocus.EndSessionID != items[4].ID {
+		t.Fatalf("unexpected longest focus streak: %+v", got.LongestFollowedFocus)
+	}
+	if got.CurrentFollowedFocus == nil || got.CurrentFollowedFocus.Length != 2 {
+		t.Fatalf("unexpected current focus streak: %+v", got.CurrentFollowedFocus)
+	}
+
+	// Composure 7, 9, 8, 7 then 6 breaks it; 8 and 7 follow.
+	if got.LongestComposure.Length != 4 || got.CurrentComposure.Length != 2 || got.MinComposure != 7 {
+		t.Fatalf("unexpected composure streaks: %+v / %+v", got.LongestComposure, got.CurrentComposure)
+	}
+}
+
+func TestBuildStreaksEmpty(t *testing.T) {
+	got := BuildStreaks(nil, DefaultFormSize, DefaultMinComposure)
+	if got.CurrentResult != nil || got.LongestWin != nil || got.Form.WinRate != nil || got.Form.Sequence != "" {
+		t.Fatalf("expected no streaks, got %+v", got)
+	}
+}
@@ -12,6 +12,8 @@ type UserStats struct {
 	ImprovementSlopeComposure float64   `json:"improvementSlopeComposure"`
 	ImprovementSlopeRushing   float64   `json:"improvementSlopeRushing"`
 	LastCalculatedAt          time.Time `json:"lastCalculatedAt"`
+	// CalculatorVersion is the CalculatorVersion that produced a stored row.
+	CalculatorVersion int `json:"calculatorVersion"`
 }
 
 type OpponentStats struct {
@@ -21,12 +23,16 @@ type OpponentStats struct {
 	AvgRushingIndex    float64   `json:"avgRushingIndex"`
 	AvgSetDifferential float64   `json:"avgSetDifferential"`
 	LastCalculatedAt   time.Time `json:"lastCalculatedAt"`
+	CalculatorVersion  int       `json:"calculatorVersion"`
 }
 
-type WeeklyStats struct {
-	WeekStartDate   time.Time `json:"weekStartDate"`
-	AvgComposure    float64   `json:"avgComposure"`
-	AvgRushingIndex float64   `json:"avgRushingIndex"`
-	WinRate         float64   `json:"winRate"`
-	MatchesPlayed   int       `json:"matchesPlayed"`
+// PeriodStats is one bucket of the weekly, monthly or yearly projections.
+type PeriodStats struct {
+	PeriodStartDate   time.Time `json:"periodStartDate"`
+	SessionsPlayed    int       `json:"sessionsPlayed"`
+	AvgComposure      float64   `json:"avgComposure"`
+	AvgRushingIndex   float64   `json:"avgRushingIndex"`
+	WinRate           float64   `json:"winRate"`
+	MatchesPlayed     int       `json:"matchesPlayed"`
+	CalculatorVersion int       `json:"calculatorVersion"`
 }
@@ -0,0 +1,300 @@
+package stats
+
+import (
+	"math"
+
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+const (
+	WinModelMinSamples = 20
+	// winModelLambda is the L2 penalty on standardized coefficients.
+	winModelLambda         = 1.0
+	winModelMaxIterations  = 50
+	winModelTolerance      = 1e-9
+	winModelCalibrationBin = 0.2
+)
+
+var WinModelFeatures = []string{
+	"composure",
+	"rushingIndex",
+	"unforcedErrorsPerMin",
+	"longRalliesPerMin",
+	"directionChangesPerMin",
+}
+
+// WinModel is a logistic regression of match wins on standardized
+// WinModelFeatures.
+type WinModel struct {
+	Samples      int                   `json:"samples"`
+	Wins         int                   `json:"wins"`
+	Regularized  bool                  `json:"regularized"`
+	Lambda       float64               `json:"lambda"`
+	Intercept    float64               `json:"intercept"`
+	Coefficients []WinModelCoefficient `json:"coefficients"`
+	Calibration  WinModelCalibration   `json:"calibration"`
+
+	beta    []float64
+	means   []float64
+	stdDevs []float64
+}
+
+// WinModelCoefficient is the change in log-odds per standard deviation.
+type WinModelCoefficient struct {
+	Feature     string  `json:"feature"`
+	Coefficient float64 `json:"coefficient"`
+	OddsRatio   float64 `json:"oddsRatio"`
+	Mean        float64 `json:"mean"`
+	StdDev      float64 `json:"stdDev"`
+}
+
+type WinModelCalibration struct {
+	BrierScore float64          `json:"brierScore"`
+	LogLoss    float64          `json:"logLoss"`
+	Accuracy   float64          `json:"accuracy"`
+	Bins       []CalibrationBin `json:"bins"`
+}
+
+type CalibrationBin struct {
+	Lower         float64 `json:"lower"`
+	Upper         float64 `json:"upper"`
+	Matches       int     `json:"matches"`
+	MeanPredicted float64 `json:"meanPredicted"`
+	ObservedRate  float64 `json:"observedRate"`
+}
+
+type WinModelContribution struct {
+	Feature string  `json:"feature"`
+	Value   float64 `json:"value"`
+	LogOdds float64 `json:"logOdds"`
+}
+
+func WinModelInputs(s sessions.Session) []float64 {
+	perMinute := func(v int) float64 {
+		if s.DurationMinutes <= 0 {
+			return 0
+		}
+		return float64(v) / float64(s.DurationMinutes)
+	}
+	return []float64{
+		float64(s.Composure),
+		RushingIndex(s),
+		perMinute(s.UnforcedErrors),
+		perMinute(s.LongRallies),
+		perMinute(s.DirectionChanges),
+	}
+}
+
+// FitWinModel fits the decided matches among items with penalized
+// Newton-Raphson. Below WinModelMinSamples matches the penalty grows as
+// WinModelMinSamples/n.
+func FitWinModel(items []sessions.Session) WinModel {
+	rows := make([][]float64, 0)
+	outcomes := make([]float64, 0)
+	for _, item := range items {
+		if !item.IsMatch() || item.IsMatchWin == nil {
+			continue
+		}
+		rows = append(rows, WinModelInputs(item))
+		if *item.IsMatchWin {
+			outcomes = append(outcomes, 1)
+		} else {
+			outcomes = append(outcomes, 0)
+		}
+	}
+	n := len(rows)
+	model := WinModel{Samples: n, Regularized: n < WinModelMinSamples, Coefficients: make([]WinModelCoefficient, len(WinModelFeatures))}
+	for _, y := range outcomes {
+		model.Wins += int(y)
+	}
+
+	means := make([]float64, len(WinModelFeatures))
+	stdDevs := make([]float64, len(WinModelFeatures))
+	for j := range WinModelFeatures {
+		column := make([]float64, n)
+		for i, row := range rows {
+			column[i] = row[j]
+		}
+		means[j] = mean(column)
+		stdDevs[j] = stdDev(column)
+	}
+	standardized := make([][]float64, n)
+	for i, row := range rows {
+		standardized[i] = standardize(row, means, stdDevs)
+	}
+
+	beta := make([]float64, len(WinModelFeatures)+1)
+	if model.Wins == 0 || model.Wins == n {
+		beta[0] = math.Log((float64(model.Wins) + 0.5) / (float64(n-model.Wins) + 0.5))
+		model.Regularized = true
+	} else {
+		model.Lambda = winModelLambda * math.Max(1, float64(WinModelMinSamples)/float64(n))
+		beta = fitLogistic(standardized, outcomes, model.Lambda)
+	}
+
+	model.beta, model.means, model.stdDevs = beta, means, stdDevs
+	model.Intercept = Round(beta[0])
+	for j, feature := range WinModelFeatures {
+		model.Coefficients[j] = WinModelCoefficient{
+			Feature:     feature,
+			Coefficient: Round(beta[j+1]),
+			OddsRatio:   Round(math.Exp(beta[j+1])),
+			Mean:        Round(means[j]),
+			StdDev:      Round(stdDevs[j]),
+		}
+	}
+	model.Calibration = calibrate(beta, standardized, outcomes)
+	return model
+}
+
+func (m WinModel) Predict(s sessions.Session) (float64, []WinModelContribution) {
+	inputs := WinModelInputs(s)
+	z := standardize(inputs, m.means, m.stdDevs)
+	logOdds := m.beta[0]
+	contributions := make([]WinModelContribution, len(WinModelFeatures))
+	for j, feature := range WinModelFeatures {
+		share := m.beta[j+1] * z[j]
+		logOdds += share
+		contributions[j] = WinModelContribution{Feature: feature, Value: Round(inputs[j]), LogOdds: Round(share)}
+	}
+	return Round(sigmoid(logOdds)), contributions
+}
+
+func fitLogistic(rows [][]float64, outcomes []float64, lambda float64) []float64 {
+	k := len(rows[0]) + 1
+	beta := make([]float64, k)
+	x := make([]float64, k)
+	x[0] = 1
+	for iter := 0; iter < winModelMaxIterations; iter++ {
+		gradient := make([]float64, k)
+		hessian := make([][]float64, k)
+		for a := range hessian {
+			hessian[a] = make([]float64, k)
+		}
+		for i, row := range rows {
+			copy(x[1:], row)
+			p := sigmoid(dot(beta, x))
+			w := p * (1 - p)
+			for a := 0; a < k; a++ {
+				gradient[a] += (outcomes[i] - p) * x[a]
+				for b := 0; b < k; b++ {
+					hessian[a][b] += w * x[a] * x[b]
+				}
+			}
+		}
+		for a := 1; a < k; a++ {
+			gradient[a] -= lambda * beta[a]
+			hessian[a][a] += lambda
+		}
+		step, ok := solveLinear(hessian, gradient)
+		if !ok {
+			break
+		}
+		largest := 0.0
+		for a := range beta {
+			beta[a] += step[a]
+			largest = math.Max(largest, math.Abs(step[a]))
+		}
+		if largest < winModelTolerance {
+			break
+		}
+	}
+	return beta
+}
+
+func calibrate(beta []float64, rows [][]float64, outcomes []float64) WinModelCalibration {
+	bins := make([]CalibrationBin, 0)
+	for lower := 0.0; lower < 1-1e-9; lower += winModelCalibrationBin {
+		bins = append(bins, CalibrationBin{Lower: Round(lower), Upper: Round(lower + winModelCalibrationBin)})
+	}
+	out := WinModelCalibration{Bins: bins}
+	if len(rows) == 0 {
+		return out
+	}
+	predicted := make([]float64, len(bins))
+	observed := make([]float64, len(bins))
+	var brier, logLoss float64
+	correct := 0
+	for i, row := range rows {
+		p := sigmoid(beta[0] + dot(beta[1:], row))
+		y := outcomes[i]
+		brier += (p - y) * (p - y)
+		clamped := math.Min(math.Max(p, 1e-15), 1-1e-15)
+		logLoss -= y*math.Log(clamped) + (1-y)*math.Log(1-clamped)
+		if (p >= 0.5) == (y == 1) {
+			correct++
+		}
+		bin := min(int(p/winModelCalibrationBin), len(bins)-1)
+		bins[bin].Matches++
+		predicted[bin] += p
+		observed[bin] += y
+	}
+	n := float64(len(rows))
+	out.BrierScore = Round(brier / n)
+	out.LogLoss = Round(logLoss / n)
+	out.Accuracy = Round(float64(correct) / n)
+	for i := range bins {
+		if bins[i].Matches > 0 {
+			bins[i].MeanPredicted = Round(predicted[i] / float64(bins[i].Matches))
+			bins[i].ObservedRate = Round(observed[i] / float64(bins[i].Matches))
+		}
+	}
+	return out
+}
+
+func solveLinear(a [][]float64, b []float64) ([]float64, bool) {
+	n := len(b)
+	m := make([][]float64, n)
+	for i := range a {
+		m[i] = append(append([]float64{}, a[i]...), b[i])
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for row := col + 1; row < n; row++ {
+			factor := m[row][col] / m[col][col]
+			for c := col; c <= n; c++ {
+				m[row][c] -= factor * m[col][c]
+			}
+		}
+	}
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := m[row][n]
+		for c := row + 1; c < n; c++ {
+			sum -= m[row][c] * x[c]
+		}
+		x[row] = sum / m[row][row]
+	}
+	return x, true
+}
+
+func standardize(row, means, stdDevs []float64) []float64 {
+	out := make([]float64, len(row))
+	for j, v := range row {
+		if stdDevs[j] > 0 {
+			out[j] = (v - means[j]) / stdDevs[j]
+		}
+	}
+	return out
+}
+
+func sigmoid(v float64) float64 {
+	return 1 / (1 + math.Exp(-v))
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func winModelSessions(n int) []sessions.Session {
+	items := make([]sessions.Session, 0, n)
+	for i := 0; i < n; i++ {
+		// Composure mostly decides the match, with one upset either way
+		// so that the fit stays finite.
+		win := i%10 >= 5
+		if i%10 == 4 || i%10 == 5 {
+			win = !win
+		}
+		items = append(items, sessions.Session{
+			SessionType:      "match",
+			DurationMinutes:  60,
+			Composure:        1 + i%10,
+			RushedShots:      10 + i%3,
+			UnforcedErrors:   8 + i%4,
+			LongRallies:      5 + i%5,
+			DirectionChanges: 12,
+			IsMatchWin:       &win,
+		})
+	}
+	return items
+}
+
+func TestFitWinModelLearnsComposure(t *testing.T) {
+	items := winModelSessions(40)
+	class := sessions.Session{SessionType: "class", DurationMinutes: 60, Composure: 1}
+	model := FitWinModel(append(items, class))
+	if model.Samples != 40 || model.Wins != 20 || model.Regularized {
+		t.Fatalf("unexpected sample summary: %+v", model)
+	}
+	if model.Coefficients[0].Feature != "composure" || model.Coefficients[0].Coefficient <= 0 {
+		t.Fatalf("expected positive composure coefficient, got %+v", model.Coefficients[0])
+	}
+	if model.Coefficients[4].StdDev != 0 || model.Coefficients[4].Coefficient != 0 {
+		t.Fatalf("expected constant feature to have no effect, got %+v", model.Coefficients[4])
+	}
+
+	calm, _ := model.Predict(sessions.Session{DurationMinutes: 60, Composure: 10, RushedShots: 10, UnforcedErrors: 8, LongRallies: 5})
+	tense, contributions := model.Predict(sessions.Session{DurationMinutes: 60, Composure: 1, RushedShots: 10, UnforcedErrors: 8, LongRallies: 5})
+	if calm <= 0.5 || tense >= 0.5 {
+		t.Fatalf("expected calm > 0.5 > tense, got %v and %v", calm, tense)
+	}
+	if len(contributions) != len(WinModelFeatures) || contributions[0].LogOdds >= 0 {
+		t.Fatalf("expected negative composure contribution, got %+v", contributions)
+	}
+
+	cal := model.Calibration
+	if cal.Accuracy < 0.7 || cal.BrierScore <= 0 || cal.BrierScore >= 0.25 {
+		t.Fatalf("unexpected calibration: %+v", cal)
+	}
+	total := 0
+	for _, bin := range cal.Bins {
+		total += bin.Matches
+	}
+	if len(cal.Bins) != 5 || total != 40 {
+		t.Fatalf("expected 5 bins covering 40 matches, got %+v", cal.Bins)
+	}
+}
+
+func TestFitWinModelDeterministic(t *testing.T) {
+	a := FitWinModel(winModelSessions(30))
+	b := FitWinModel(winModelSessions(30))
+	if a.Intercept != b.Intercept || a.Coefficients[0] != b.Coefficients[0] {
+		t.Fatalf("expected identical fits, got %+v and %+v", a, b)
+	}
+}
+
+func TestFitWinModelShrinksSmallSamples(t *testing.T) {
+	small := FitWinModel(winModelSessions(10))
+	large := FitWinModel(winModelSessions(40))
+	if !small.Regularized || small.Lambda <= large.Lambda {
+		t.Fatalf("expected a stronger penalty for 10 matches, got %v vs %v", small.Lambda, large.Lambda)
+	}
+	if small.Coefficients[0].Coefficient >= large.Coefficients[0].Coefficient {
+		t.Fatalf("expected shrunk composure coefficient, got %v vs %v", small.Coefficients[0].Coefficient, large.Coefficients[0].Coefficient)
+	}
+}
+
+func TestFitWinModelOneSidedResults(t *testing.T) {
+	win := true
+	items := []sessions.Session{
+		{SessionType: "match", DurationMinutes: 60, Composure: 5, IsMatchWin: &win},
+		{SessionType: "friendly", DurationMinutes: 45, Composure: 7, IsMatchWin: &win},
+	}
+	model := FitWinModel(items)
+	if !model.Regularized || model.Wins != 2 {
+		t.Fatalf("unexpected model: %+v", model)
+	}
+	p, _ := model.Predict(sessions.Session{DurationMinutes: 60, Composure: 1})
+	// (2 + 0.5) / (2 + 1)
+	if p != 0.8333 {
+		t.Fatalf("expected smoothed base rate 0.8333, got %v", p)
+	}
+	if got := FitWinModel(nil); got.Samples != 0 {
+		t.Fatalf("expected empty model, got %+v", got)
+	}
+	if p, _ := FitWinModel(nil).Predict(sessions.Session{DurationMinutes: 60}); p != 0.5 {
+		t.Fatalf("expected 0.5 without matches, got %v", p)
+	}
+}
@@ -0,0 +1,24 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+var ErrForeignOwner = errors.New("entity belongs to another user")
+
+type ItemError struct {
+	EntityType EntityType
+	ID         uuid.UUID
+	Err        error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.EntityType, e.ID, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,37 @@
+package sync
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/goals"
+	"github.com/lutefd/baseline-api/internal/domain/opponents"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func OpponentIdentityKey(o opponents.Opponent) string {
+	if key := strings.TrimSpace(o.IdentityKey); key != "" {
+		return key
+	}
+	return o.ID.String()
+}
+
+func RemapSessionOpponent(s sessions.Session, remaps map[uuid.UUID]uuid.UUID) sessions.Session {
+	if s.OpponentID == nil {
+		return s
+	}
+	if canonical, ok := remaps[*s.OpponentID]; ok {
+		s.OpponentID = &canonical
+	}
+	return s
+}
+
+func RemapGoalOpponent(g goals.Goal, remaps map[uuid.UUID]uuid.UUID) goals.Goal {
+	if g.OpponentID == nil {
+		return g
+	}
+	if canonical, ok := remaps[*g.OpponentID]; ok {
+		g.OpponentID = &canonical
+	}
+	return g
+}
@@ -0,0 +1,39 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/opponents"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func TestOpponentIdentityKeyDefaultsToID(t *testing.T) {
+	id := uuid.New()
+	if got := OpponentIdentityKey(opponents.Opponent{ID: id, IdentityKey: "  "}); got != id.String() {
+		t.Fatalf("expected id fallback, got %q", got)
+	}
+	if got := OpponentIdentityKey(opponents.Opponent{ID: id, IdentityKey: " club:rival "}); got != "club:rival" {
+		t.Fatalf("expected trimmed key, got %q", got)
+	}
+}
+
+func TestRemapSessionOpponent(t *testing.T) {
+	local := uuid.New()
+	canonical := uuid.New()
+	other := uuid.New()
+	remaps := map[uuid.UUID]uuid.UUID{local: canonical}
+
+	remapped := RemapSessionOpponent(sessions.Session{OpponentID: &local}, remaps)
+	if remapped.OpponentID == nil || *remapped.OpponentID != canonical {
+		t.Fatalf("expected opponent to be remapped to %s", canonical)
+	}
+
+	untouched := RemapSessionOpponent(sessions.Session{OpponentID: &other}, remaps)
+	if *untouched.OpponentID != other {
+		t.Fatalf("expected unrelated opponent to stay unchanged")
+	}
+	if RemapSessionOpponent(sessions.Session{}, remaps).OpponentID != nil {
+		t.Fatalf("expected nil opponent to stay nil")
+	}
+}
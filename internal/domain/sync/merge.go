@@ -5,9 +5,10 @@ import "time"
 type MergeDecision string
 
 const (
-	DecisionInsert MergeDecision = "insert"
-	DecisionUpdate MergeDecision = "update"
-	DecisionIgnore MergeDecision = "ignore"
+	DecisionInsert  MergeDecision = "insert"
+	DecisionUpdate  MergeDecision = "update"
+	DecisionIgnore  MergeDecision = "ignore"
+	DecisionPending MergeDecision = "pending"
 )
 
 func ResolveByUpdatedAt(incomingUpdatedAt, storedUpdatedAt time.Time, incomingDeletedAt, storedDeletedAt *time.Time) MergeDecision {
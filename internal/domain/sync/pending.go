@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/goals"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+type EntityType string
+
+const (
+	EntityOpponent EntityType = "opponent"
+	EntitySession  EntityType = "session"
+	EntityMatchSet EntityType = "matchSet"
+	EntityGoal     EntityType = "goal"
+)
+
+type PendingItem struct {
+	EntityType EntityType `json:"entityType"`
+	ID         uuid.UUID  `json:"id"`
+	ParentType EntityType `json:"parentType"`
+	ParentID   uuid.UUID  `json:"parentId"`
+}
+
+// PendingRecord is a pushed child whose parent has not reached the server yet.
+// Exactly one of Session, MatchSet or Goal is set, matching EntityType.
+type PendingRecord struct {
+	PendingItem
+	Session   *sessions.Session
+	MatchSet  *sessions.MatchSet
+	Goal      *goals.Goal
+	UpdatedAt time.Time
+}
+
+func PendingSession(s sessions.Session) PendingRecord {
+	return PendingRecord{
+		PendingItem: PendingItem{EntityType: EntitySession, ID: s.ID, ParentType: EntityOpponent, ParentID: *s.OpponentID},
+		Session:     &s,
+		UpdatedAt:   s.UpdatedAt,
+	}
+}
+
+func PendingMatchSet(ms sessions.MatchSet) PendingRecord {
+	return PendingRecord{
+		PendingItem: PendingItem{EntityType: EntityMatchSet, ID: ms.ID, ParentType: EntitySession, ParentID: ms.SessionID},
+		MatchSet:    &ms,
+		UpdatedAt:   ms.UpdatedAt,
+	}
+}
+
+func PendingGoal(g goals.Goal) PendingRecord {
+	return PendingRecord{
+		PendingItem: PendingItem{EntityType: EntityGoal, ID: g.ID, ParentType: EntityOpponent, ParentID: *g.OpponentID},
+		Goal:        &g,
+		UpdatedAt:   g.UpdatedAt,
+	}
+}
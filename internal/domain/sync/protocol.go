@@ -0,0 +1,165 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lutefd/baseline-api/internal/domain/opponents"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+const (
+	ProtocolHeader = "X-Sync-Protocol"
+
+	// ProtocolVersionLegacy is assumed for clients that send no protocol header.
+	ProtocolVersionLegacy  = 1
+	ProtocolVersionCurrent = 2
+	MinProtocolVersion     = 1
+)
+
+var ErrProtocolTooOld = errors.New("sync protocol version is no longer supported")
+
+type FieldSpec struct {
+	Name  string `json:"name"`
+	Since int    `json:"since"`
+}
+
+// Fields added after protocol v1. Clients below Since never send them, so the
+// stored value is kept when those clients push the row back. Every session
+// and match set field still dates from v1, so nothing is preserved for them
+// until a field is added here; capabilities report that per entity.
+var (
+	SessionFields  = []FieldSpec{}
+	MatchSetFields = []FieldSpec{}
+	OpponentFields = []FieldSpec{{Name: "identityKey", Since: 2}}
+	GoalFields     = []FieldSpec{}
+)
+
+type Capabilities struct {
+	ProtocolVersion    int                        `json:"protocolVersion"`
+	MinProtocolVersion int                        `json:"minProtocolVersion"`
+	Features           []string                   `json:"features"`
+	Fields             map[EntityType][]FieldSpec `json:"fields"`
+	// FieldPreservation reports per entity whether any stored field is kept
+	// for older clients.
+	FieldPreservation map[EntityType]bool `json:"fieldPreservation"`
+}
+
+func CurrentCapabilities() Capabilities {
+	return Capabilities{
+		ProtocolVersion:    ProtocolVersionCurrent,
+		MinProtocolVersion: MinProtocolVersion,
+		Features: []string{
+			"tombstoneFullResync",
+			"opponentIdentityRemap",
+			"pendingChildren",
+			"pushDryRun",
+			"goals",
+		},
+		Fields: map[EntityType][]FieldSpec{
+			EntitySession:  SessionFields,
+			EntityMatchSet: MatchSetFields,
+			EntityOpponent: OpponentFields,
+			EntityGoal:     GoalFields,
+		},
+		FieldPreservation: map[EntityType]bool{
+			EntitySession:  len(SessionFields) > 0,
+			EntityMatchSet: len(MatchSetFields) > 0,
+			EntityOpponent: len(OpponentFields) > 0,
+			EntityGoal:     len(GoalFields) > 0,
+		},
+	}
+}
+
+// ParseProtocolVersion reads the protocol header, returning ErrProtocolTooOld
+// with the parsed version when it is below minVersion.
+func ParseProtocolVersion(raw string, minVersion int) (int, error) {
+	version := ProtocolVersionLegacy
+	if raw = strings.TrimSpace(raw); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			return 0, fmt.Errorf("invalid %s header %q", ProtocolHeader, raw)
+		}
+		version = parsed
+	}
+	if version < minVersion {
+		return version, ErrProtocolTooOld
+	}
+	return version, nil
+}
+
+// UnsupportedFields lists the fields a client at version does not know.
+func UnsupportedFields(specs []FieldSpec, version int) []string {
+	out := make([]string, 0)
+	for _, spec := range specs {
+		if version < spec.Since {
+			out = append(out, spec.Name)
+		}
+	}
+	return out
+}
+
+func SupportsField(specs []FieldSpec, name string, version int) bool {
+	for _, spec := range specs {
+		if spec.Name == name {
+			return version >= spec.Since
+		}
+	}
+	return true
+}
+
+func PreserveOpponentFields(incoming, stored opponents.Opponent, version int) opponents.Opponent {
+	if !SupportsField(OpponentFields, "identityKey", version) {
+		incoming.IdentityKey = stored.IdentityKey
+	}
+	return incoming
+}
+
+// PreserveSessionFields keeps the stored value of every SessionFields entry
+// the client's version does not know.
+func PreserveSessionFields(incoming, stored sessions.Session, version int) (sessions.Session, error) {
+	return preserveFields(UnsupportedFields(SessionFields, version), incoming, stored)
+}
+
+// preserveFields copies the named JSON fields from stored onto incoming.
+func preserveFields[T any](names []string, incoming, stored T) (T, error) {
+	if len(names) == 0 {
+		return incoming, nil
+	}
+	fields, err := jsonFields(incoming)
+	if err != nil {
+		return incoming, err
+	}
+	kept, err := jsonFields(stored)
+	if err != nil {
+		return incoming, err
+	}
+	for _, name := range names {
+		if value, ok := kept[name]; ok {
+			fields[name] = value
+		} else {
+			delete(fields, name)
+		}
+	}
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return incoming, err
+	}
+	var out T
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return incoming, err
+	}
+	return out, nil
+}
+
+func jsonFields(v any) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	return fields, json.Unmarshal(raw, &fields)
+}
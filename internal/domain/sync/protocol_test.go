@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/opponents"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+)
+
+func TestParseProtocolVersion(t *testing.T) {
+	if got, err := ParseProtocolVersion("", MinProtocolVersion); err != nil || got != ProtocolVersionLegacy {
+		t.Fatalf("expected legacy version for missing header, got %d (%v)", got, err)
+	}
+	if got, err := ParseProtocolVersion(" 2 ", MinProtocolVersion); err != nil || got != 2 {
+		t.Fatalf("expected version 2, got %d (%v)", got, err)
+	}
+	if _, err := ParseProtocolVersion("two", MinProtocolVersion); err == nil {
+		t.Fatalf("expected error for non-numeric version")
+	}
+	if _, err := ParseProtocolVersion("0", MinProtocolVersion); err == nil || errors.Is(err, ErrProtocolTooOld) {
+		t.Fatalf("expected invalid version error, got %v", err)
+	}
+	if got, err := ParseProtocolVersion("1", 2); !errors.Is(err, ErrProtocolTooOld) || got != 1 {
+		t.Fatalf("expected version 1 to be too old, got %d (%v)", got, err)
+	}
+	if _, err := ParseProtocolVersion("", 2); !errors.Is(err, ErrProtocolTooOld) {
+		t.Fatalf("expected a missing header to be too old, got %v", err)
+	}
+}
+
+func TestPreserveOpponentFieldsForLegacyClients(t *testing.T) {
+	id := uuid.New()
+	stored := opponents.Opponent{ID: id, IdentityKey: "club:rival"}
+	incoming := opponents.Opponent{ID: id, Name: "Rival"}
+
+	legacy := PreserveOpponentFields(incoming, stored, ProtocolVersionLegacy)
+	if legacy.IdentityKey != "club:rival" {
+		t.Fatalf("expected legacy push to keep stored identity key, got %q", legacy.IdentityKey)
+	}
+
+	current := PreserveOpponentFields(opponents.Opponent{ID: id, IdentityKey: "club:new"}, stored, ProtocolVersionCurrent)
+	if current.IdentityKey != "club:new" {
+		t.Fatalf("expected current client to own identity key, got %q", current.IdentityKey)
+	}
+}
+
+func TestPreserveSessionFieldsForLegacyClients(t *testing.T) {
+	registered := SessionFields
+	SessionFields = []FieldSpec{{Name: "notes", Since: 2}, {Name: "focusText", Since: 2}}
+	t.Cleanup(func() { SessionFields = registered })
+
+	notes := "kept from v2"
+	id := uuid.New()
+	stored := sessions.Session{ID: id, Composure: 5, Notes: &notes}
+	incoming := sessions.Session{ID: id, Composure: 8, FocusText: &notes}
+
+	legacy, err := PreserveSessionFields(incoming, stored, ProtocolVersionLegacy)
+	if err != nil {
+		t.Fatalf("preserve failed: %v", err)
+	}
+	if legacy.Notes == nil || *legacy.Notes != notes || legacy.FocusText != nil {
+		t.Fatalf("expected v1 push to keep stored v2 fields, got notes=%v focusText=%v", legacy.Notes, legacy.FocusText)
+	}
+	if legacy.Composure != 8 {
+		t.Fatalf("expected v1 push to own v1 fields, got composure %d", legacy.Composure)
+	}
+
+	current, err := PreserveSessionFields(incoming, stored, ProtocolVersionCurrent)
+	if err != nil {
+		t.Fatalf("preserve failed: %v", err)
+	}
+	if current.Notes != nil || current.FocusText == nil {
+		t.Fatalf("expected current client to own v2 fields, got %+v", current)
+	}
+}
+
+func TestCapabilitiesReportFieldPreservation(t *testing.T) {
+	caps := CurrentCapabilities()
+	if caps.FieldPreservation[EntitySession] || caps.FieldPreservation[EntityMatchSet] {
+		t.Fatalf("expected no preservation for sessions or match sets, got %+v", caps.FieldPreservation)
+	}
+	if !caps.FieldPreservation[EntityOpponent] {
+		t.Fatalf("expected opponent identity keys to be preserved, got %+v", caps.FieldPreservation)
+	}
+}
@@ -0,0 +1,34 @@
+package sync
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// StreamRecordEnd marks the trailer line of an NDJSON pull, and
+// StreamRecordError a pull that failed after the response had started.
+const (
+	StreamRecordEnd   = "end"
+	StreamRecordError = "error"
+)
+
+// StreamRecord is one NDJSON line of a streamed push or pull. Type is an
+// EntityType for data lines, or StreamRecordEnd or StreamRecordError for the
+// last line of a pull.
+type StreamRecord struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type PullStreamEnd struct {
+	FullResyncRequired bool      `json:"fullResyncRequired"`
+	ServerTimestamp    time.Time `json:"serverTimestamp"`
+	Sessions           int       `json:"sessions"`
+	MatchSets          int       `json:"matchSets"`
+	Opponents          int       `json:"opponents"`
+	Goals              int       `json:"goals"`
+}
+
+type PullStreamError struct {
+	Error string `json:"error"`
+}
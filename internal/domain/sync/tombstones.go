@@ -0,0 +1,31 @@
+package sync
+
+import "time"
+
+type TombstonePurge struct {
+	Sessions  int `json:"sessions"`
+	MatchSets int `json:"matchSets"`
+	Opponents int `json:"opponents"`
+	Goals     int `json:"goals"`
+}
+
+func (p TombstonePurge) Total() int {
+	return p.Sessions + p.MatchSets + p.Opponents + p.Goals
+}
+
+func (p *TombstonePurge) Add(other TombstonePurge) {
+	p.Sessions += other.Sessions
+	p.MatchSets += other.MatchSets
+	p.Opponents += other.Opponents
+	p.Goals += other.Goals
+}
+
+// RequiresFullResync reports whether a pull cursor predates tombstones that
+// have already been hard-deleted, meaning the device may have missed deletions.
+// A zero or epoch cursor is itself a full resync and never needs flagging.
+func RequiresFullResync(updatedAfter time.Time, purgedThrough *time.Time) bool {
+	if purgedThrough == nil || !updatedAfter.After(time.Unix(0, 0)) {
+		return false
+	}
+	return updatedAfter.Before(*purgedThrough)
+}
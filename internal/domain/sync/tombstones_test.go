@@ -0,0 +1,31 @@
+package sync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequiresFullResync(t *testing.T) {
+	purged := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		updatedAfter  time.Time
+		purgedThrough *time.Time
+		want          bool
+	}{
+		{name: "nothing purged", updatedAfter: purged.Add(-time.Hour), want: false},
+		{name: "cursor before purge", updatedAfter: purged.Add(-time.Hour), purgedThrough: &purged, want: true},
+		{name: "cursor at purge", updatedAfter: purged, purgedThrough: &purged, want: false},
+		{name: "cursor after purge", updatedAfter: purged.Add(time.Hour), purgedThrough: &purged, want: false},
+		{name: "epoch cursor", updatedAfter: time.Unix(0, 0).UTC(), purgedThrough: &purged, want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := RequiresFullResync(tc.updatedAfter, tc.purgedThrough); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
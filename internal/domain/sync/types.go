@@ -3,31 +3,65 @@ package sync
 import (
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/goals"
 	"github.com/lutefd/baseline-api/internal/domain/opponents"
 	"github.com/lutefd/baseline-api/internal/domain/sessions"
+	"github.com/lutefd/baseline-api/internal/domain/stats"
 )
 
 type PushRequest struct {
 	Sessions  []sessions.Session   `json:"sessions"`
 	MatchSets []sessions.MatchSet  `json:"matchSets"`
 	Opponents []opponents.Opponent `json:"opponents"`
+	Goals     []goals.Goal         `json:"goals"`
+
+	// ProtocolVersion comes from the request header, not the body.
+	ProtocolVersion int `json:"-"`
 }
 
 type EntityCounts struct {
 	Inserted int `json:"inserted"`
 	Updated  int `json:"updated"`
 	Ignored  int `json:"ignored"`
+	Pending  int `json:"pending"`
+}
+
+type ItemDecision struct {
+	EntityType EntityType    `json:"entityType"`
+	ID         uuid.UUID     `json:"id"`
+	Decision   MergeDecision `json:"decision"`
 }
 
 type PushResponse struct {
-	Sessions        EntityCounts `json:"sessions"`
-	MatchSets       EntityCounts `json:"matchSets"`
-	Opponents       EntityCounts `json:"opponents"`
-	ServerTimestamp time.Time    `json:"serverTimestamp"`
+	Sessions         EntityCounts  `json:"sessions"`
+	MatchSets        EntityCounts  `json:"matchSets"`
+	Opponents        EntityCounts  `json:"opponents"`
+	Goals            EntityCounts  `json:"goals"`
+	OpponentIDRemaps []IDRemap     `json:"opponentIdRemaps"`
+	Pending          []PendingItem `json:"pending"`
+	ServerTimestamp  time.Time     `json:"serverTimestamp"`
+}
+
+type PushPreview struct {
+	PushResponse
+	DryRun          bool                  `json:"dryRun"`
+	Items           []ItemDecision        `json:"items"`
+	ProjectionDelta stats.UserStatsChange `json:"projectionDelta"`
+	// ProjectionChanges lists every user, opponent and period row the push
+	// would add, remove or update.
+	ProjectionChanges []stats.ProjectionChange `json:"projectionChanges"`
 }
 
 type PullResponse struct {
-	Sessions  []sessions.Session   `json:"sessions"`
-	MatchSets []sessions.MatchSet  `json:"matchSets"`
-	Opponents []opponents.Opponent `json:"opponents"`
+	Sessions           []sessions.Session   `json:"sessions"`
+	MatchSets          []sessions.MatchSet  `json:"matchSets"`
+	Opponents          []opponents.Opponent `json:"opponents"`
+	Goals              []goals.Goal         `json:"goals"`
+	FullResyncRequired bool                 `json:"fullResyncRequired"`
+}
+
+type IDRemap struct {
+	From uuid.UUID `json:"from"`
+	To   uuid.UUID `json:"to"`
 }
@@ -2,10 +2,14 @@ package events
 
 import (
 	"context"
+	"errors"
 	"sync"
 )
 
+// Event is a named domain event. ID is the durable outbox sequence the event
+// was delivered from, or zero for events published in memory only.
 type Event struct {
+	ID      int64
 	Name    string
 	Payload any
 }
@@ -27,15 +31,18 @@ func (b *Bus) Subscribe(name string, handler Handler) {
 	b.handlers[name] = append(b.handlers[name], handler)
 }
 
+// Publish calls every handler subscribed to the event in order. A failing
+// handler does not stop the others; all errors are joined and returned.
 func (b *Bus) Publish(ctx context.Context, e Event) error {
 	b.mu.RLock()
 	handlers := append([]Handler(nil), b.handlers[e.Name]...)
 	b.mu.RUnlock()
 
+	var errs []error
 	for _, handler := range handlers {
 		if err := handler(ctx, e); err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
@@ -28,7 +28,7 @@ func TestBusPublishCallsHandlersInOrder(t *testing.T) {
 	}
 }
 
-func TestBusPublishStopsOnFirstError(t *testing.T) {
+func TestBusPublishRunsAllHandlersAndJoinsErrors(t *testing.T) {
 	bus := NewBus()
 	var calledSecond bool
 	expectedErr := errors.New("handler failed")
@@ -45,7 +45,7 @@ func TestBusPublishStopsOnFirstError(t *testing.T) {
 	if !errors.Is(err, expectedErr) {
 		t.Fatalf("expected %v, got %v", expectedErr, err)
 	}
-	if calledSecond {
-		t.Fatalf("expected second handler not to run")
+	if !calledSecond {
+		t.Fatalf("expected second handler to run despite the first failing")
 	}
 }
@@ -0,0 +1,157 @@
+package httpserver
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+
+	maxJSONBodyBytes   int64 = 32 << 20
+	maxNDJSONBodyBytes int64 = 512 << 20
+	maxNDJSONLineBytes       = 1 << 20
+)
+
+func isNDJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == ndjsonContentType
+}
+
+func acceptsNDJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if isNDJSON(strings.TrimSpace(part)) {
+			return true
+		}
+	}
+	return false
+}
+
+// decompressionMiddleware transparently decodes gzip and zstd request bodies and
+// caps both the wire size and the decoded size, so a small compressed payload
+// cannot expand past the limit.
+func decompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limit := maxJSONBodyBytes
+		if isNDJSON(r.Header.Get("Content-Type")) {
+			limit = maxNDJSONBodyBytes
+		}
+		body := http.MaxBytesReader(w, r.Body, limit)
+
+		switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+		case "", "identity":
+			r.Body = body
+		case "gzip":
+			zr, err := gzip.NewReader(body)
+			if err != nil {
+				http.Error(w, "invalid gzip body", http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			r.Body = http.MaxBytesReader(w, zr, limit)
+		case "zstd":
+			zr, err := zstd.NewReader(body)
+			if err != nil {
+				http.Error(w, "invalid zstd body", http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			r.Body = http.MaxBytesReader(w, zr.IOReadCloser(), limit)
+		default:
+			http.Error(w, "unsupported content encoding "+strconv.Quote(encoding), http.StatusUnsupportedMediaType)
+			return
+		}
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = -1
+		next.ServeHTTP(w, r)
+	})
+}
+
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+}
+
+type compressedResponseWriter struct {
+	http.ResponseWriter
+	enc flushWriteCloser
+}
+
+func (c *compressedResponseWriter) WriteHeader(status int) {
+	c.Header().Del("Content-Length")
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *compressedResponseWriter) Write(p []byte) (int, error) {
+	return c.enc.Write(p)
+}
+
+func (c *compressedResponseWriter) Flush() {
+	_ = c.enc.Flush()
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		var enc flushWriteCloser
+		switch negotiateEncoding(r.Header.Get("Accept-Encoding")) {
+		case "zstd":
+			zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest))
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			enc = zw
+			w.Header().Set("Content-Encoding", "zstd")
+		case "gzip":
+			enc = gzip.NewWriter(w)
+			w.Header().Set("Content-Encoding", "gzip")
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer enc.Close()
+		next.ServeHTTP(&compressedResponseWriter{ResponseWriter: w, enc: enc}, r)
+	})
+}
+
+// negotiateEncoding picks zstd over gzip when both are acceptable, honouring
+// explicit q=0 refusals.
+func negotiateEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if _, raw, ok := strings.Cut(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			if parsed, err := strconv.ParseFloat(raw, 64); err == nil {
+				q = parsed
+			}
+		}
+		accepted[name] = q > 0
+	}
+	for _, candidate := range []string{"zstd", "gzip"} {
+		if accepted[candidate] {
+			return candidate
+		}
+	}
+	return ""
+}
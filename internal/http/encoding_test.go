@@ -0,0 +1,92 @@
+package httpserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "gzip, deflate, br", want: "gzip"},
+		{header: "gzip, zstd", want: "zstd"},
+		{header: "zstd;q=0, gzip;q=0.5", want: "gzip"},
+		{header: "identity", want: ""},
+	}
+	for _, tc := range tests {
+		if got := negotiateEncoding(tc.header); got != tc.want {
+			t.Fatalf("negotiateEncoding(%q): expected %q, got %q", tc.header, tc.want, got)
+		}
+	}
+}
+
+func TestDecompressionMiddlewareDecodesGzipAndZstd(t *testing.T) {
+	payload := `{"sessions":[]}`
+	echo := decompressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, _ = gw.Write([]byte(payload))
+	_ = gw.Close()
+
+	zenc, _ := zstd.NewWriter(nil)
+	zs := zenc.EncodeAll([]byte(payload), nil)
+
+	for encoding, body := range map[string][]byte{"gzip": gz.Bytes(), "zstd": zs} {
+		req := httptest.NewRequest(http.MethodPost, "/v1/sync/push", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		echo.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != payload {
+			t.Fatalf("%s: expected decoded payload, got %d %q", encoding, rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/sync/push", strings.NewReader(payload))
+	req.Header.Set("Content-Encoding", "br")
+	rec := httptest.NewRecorder()
+	echo.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 for unsupported encoding, got %d", rec.Code)
+	}
+}
+
+func TestCompressionMiddlewareGzipsResponses(t *testing.T) {
+	handler := compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip content encoding, got %q", rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("response is not gzip: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if strings.TrimSpace(string(body)) != `{"status":"ok"}` {
+		t.Fatalf("unexpected decompressed body: %q", body)
+	}
+}
@@ -0,0 +1,236 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/auth"
+	"github.com/lutefd/baseline-api/internal/domain/goals"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+	domainstats "github.com/lutefd/baseline-api/internal/domain/stats"
+	"github.com/lutefd/baseline-api/internal/storage/postgres"
+)
+
+func (s *Server) handleCreateGoal(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var payload goals.Goal
+	if err := decodeJSON(r, &payload); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if payload.ID == uuid.Nil {
+		payload.ID = uuid.New()
+	}
+	now := time.Now().UTC()
+	if payload.StartsAt.IsZero() {
+		payload.StartsAt = now
+	}
+	payload.UserID = userID
+	if payload.CreatedAt.IsZero() {
+		payload.CreatedAt = now
+	}
+	payload.UpdatedAt = now
+	payload.DeletedAt = nil
+	if !s.validGoal(w, r, payload) {
+		return
+	}
+
+	ctx := r.Context()
+	err := s.store.WithTx(ctx, func(tx *postgres.Store) error {
+		if err := tx.EnsureDefaultUser(ctx, userID); err != nil {
+			return err
+		}
+		return tx.CreateGoal(ctx, payload)
+	})
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			http.Error(w, "goal with this id already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, payload)
+}
+
+func (s *Server) handleListGoals(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	includeDeleted := r.URL.Query().Get("includeDeleted") == "true"
+	items, err := s.store.ListGoalsByUser(r.Context(), userID, includeDeleted)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"goals": items})
+}
+
+func (s *Server) handleGetGoal(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	goal, ok := s.requestGoal(w, r, userID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, goal)
+}
+
+func (s *Server) handleUpdateGoal(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	stored, ok := s.requestGoal(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var payload goals.Goal
+	if err := decodeJSON(r, &payload); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	payload.ID = stored.ID
+	payload.UserID = userID
+	payload.CreatedAt = stored.CreatedAt
+	payload.UpdatedAt = time.Now().UTC()
+	payload.DeletedAt = nil
+	if payload.StartsAt.IsZero() {
+		payload.StartsAt = stored.StartsAt
+	}
+	if !s.validGoal(w, r, payload) {
+		return
+	}
+
+	found, err := s.store.UpdateGoal(r.Context(), payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, payload)
+}
+
+func (s *Server) handleDeleteGoal(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	goal, ok := s.requestGoal(w, r, userID)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	goal.UpdatedAt = now
+	goal.DeletedAt = &now
+	found, err := s.store.UpdateGoal(r.Context(), goal)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, goal)
+}
+
+func (s *Server) handleGoalProgress(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	goal, ok := s.requestGoal(w, r, userID)
+	if !ok {
+		return
+	}
+
+	progress, err := s.evaluateGoal(r.Context(), goal, time.Now().UTC())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"goal":     goal,
+		"progress": progress,
+	})
+}
+
+func (s *Server) evaluateGoal(ctx context.Context, goal goals.Goal, now time.Time) (goals.Progress, error) {
+	items, err := s.store.ListSessionsByDateRange(ctx, goal.UserID, &goal.StartsAt, goal.EndsAt)
+	if err != nil {
+		return goals.Progress{}, err
+	}
+	var setsBySession map[uuid.UUID][]sessions.MatchSet
+	if goal.Metric == domainstats.FeatureSetDifferential {
+		ids := make([]uuid.UUID, 0, len(items))
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		setsBySession, err = s.store.ListMatchSetsBySessionIDs(ctx, ids)
+		if err != nil {
+			return goals.Progress{}, err
+		}
+	}
+	return goals.Evaluate(goal, items, setsBySession, now), nil
+}
+
+// requestGoal answers 400 or 404 itself when there is no live goal.
+func (s *Server) requestGoal(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (goals.Goal, bool) {
+	goalID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid goal id", http.StatusBadRequest)
+		return goals.Goal{}, false
+	}
+	goal, found, err := s.store.GetGoal(r.Context(), userID, goalID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return goals.Goal{}, false
+	}
+	if !found || goal.DeletedAt != nil {
+		http.NotFound(w, r)
+		return goals.Goal{}, false
+	}
+	return goal, true
+}
+
+func (s *Server) validGoal(w http.ResponseWriter, r *http.Request, g goals.Goal) bool {
+	if err := g.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if g.OpponentID == nil {
+		return true
+	}
+	exists, err := s.store.OpponentExists(r.Context(), g.UserID, *g.OpponentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !exists {
+		http.Error(w, "unknown opponentId", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
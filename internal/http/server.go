@@ -2,8 +2,11 @@ package httpserver
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -17,17 +20,21 @@ import (
 	domainsync "github.com/lutefd/baseline-api/internal/domain/sync"
 	"github.com/lutefd/baseline-api/internal/projections"
 	"github.com/lutefd/baseline-api/internal/storage/postgres"
+	"github.com/lutefd/baseline-api/internal/syncer"
 )
 
 type Dependencies struct {
 	Store         *postgres.Store
 	APIToken      string
 	DefaultUserID uuid.UUID
+	// ProjectionWorker, when set, is consulted to flag overviews whose
+	// projection updates are still in flight.
+	ProjectionWorker *projections.Worker
 }
 
 type Server struct {
 	store       *postgres.Store
-	projection  *projections.Service
+	projector   *projections.Worker
 	auth        auth.Middleware
 	defaultUser uuid.UUID
 }
@@ -35,7 +42,7 @@ type Server struct {
 func NewServer(deps Dependencies) *Server {
 	return &Server{
 		store:       deps.Store,
-		projection:  projections.NewService(deps.Store),
+		projector:   deps.ProjectionWorker,
 		auth:        auth.NewMiddleware(deps.APIToken, deps.DefaultUserID),
 		defaultUser: deps.DefaultUserID,
 	}
@@ -48,16 +55,35 @@ func (s *Server) Router() http.Handler {
 	mux.HandleFunc("GET /v1/sessions", s.handleListSessions)
 	mux.HandleFunc("POST /v1/opponents", s.handleCreateOpponent)
 	mux.HandleFunc("GET /v1/opponents", s.handleListOpponents)
+	mux.HandleFunc("POST /v1/goals", s.handleCreateGoal)
+	mux.HandleFunc("GET /v1/goals", s.handleListGoals)
+	mux.HandleFunc("GET /v1/goals/{id}", s.handleGetGoal)
+	mux.HandleFunc("PUT /v1/goals/{id}", s.handleUpdateGoal)
+	mux.HandleFunc("DELETE /v1/goals/{id}", s.handleDeleteGoal)
+	mux.HandleFunc("GET /v1/goals/{id}/progress", s.handleGoalProgress)
 	mux.HandleFunc("POST /v1/sync/push", s.handleSyncPush)
 	mux.HandleFunc("GET /v1/sync/pull", s.handleSyncPull)
+	mux.HandleFunc("GET /v1/sync/capabilities", s.handleSyncCapabilities)
 	mux.HandleFunc("GET /v1/stats/overview", s.handleOverview)
+	mux.HandleFunc("GET /v1/stats/periods", s.handlePeriodStats)
+	mux.HandleFunc("GET /v1/stats/history", s.handleStatsHistory)
+	mux.HandleFunc("GET /v1/settings", s.handleGetSettings)
+	mux.HandleFunc("PUT /v1/settings", s.handleUpdateSettings)
 	mux.HandleFunc("GET /v1/analysis/overview", s.handleOverview)
 	mux.HandleFunc("GET /v1/analysis/trends", s.handleTrends)
 	mux.HandleFunc("GET /v1/analysis/correlations", s.handleCorrelations)
+	mux.HandleFunc("GET /v1/analysis/correlations/matrix", s.handleCorrelationMatrix)
+	mux.HandleFunc("GET /v1/analysis/win-model", s.handleWinModel)
+	mux.HandleFunc("POST /v1/analysis/win-probability", s.handleWinProbability)
+	mux.HandleFunc("GET /v1/analysis/rolling", s.handleRolling)
+	mux.HandleFunc("GET /v1/analysis/ratings", s.handleRatings)
+	mux.HandleFunc("GET /v1/analysis/anomalies", s.handleAnomalies)
+	mux.HandleFunc("GET /v1/analysis/streaks", s.handleStreaks)
+	mux.HandleFunc("GET /v1/analysis/opponent-profiles", s.handleOpponentProfiles)
 	mux.HandleFunc("GET /v1/analysis/deep", s.handleDeepAnalysis)
 	mux.HandleFunc("GET /v1/analysis/opponents/", s.handleOpponentAnalysis)
 
-	return s.auth.Guard(loggingMiddleware(mux))
+	return s.auth.Guard(loggingMiddleware(compressionMiddleware(decompressionMiddleware(mux))))
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
@@ -76,6 +102,10 @@ func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := payload.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if payload.ID == uuid.Nil {
 		payload.ID = uuid.New()
 	}
@@ -86,15 +116,20 @@ func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
 	}
 	payload.UpdatedAt = now
 
-	if err := s.store.EnsureDefaultUser(r.Context(), userID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if err := s.store.CreateSession(r.Context(), payload); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if err := s.projection.RecomputeForUser(r.Context(), userID); err != nil {
+	ctx := r.Context()
+	err := s.store.WithTx(ctx, func(tx *postgres.Store) error {
+		if err := tx.EnsureDefaultUser(ctx, userID); err != nil {
+			return err
+		}
+		if err := tx.CreateSession(ctx, payload); err != nil {
+			return err
+		}
+		return tx.EnqueueOutbox(ctx, userID, projections.EventSessionsChanged, projections.SessionsChanged{
+			UserID:  userID,
+			Changes: []domainstats.SessionChange{{After: &domainstats.SessionState{Session: payload}}},
+		})
+	})
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -121,7 +156,80 @@ func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"sessions": items})
+	var flags map[uuid.UUID][]domainstats.AnomalyFlag
+	if len(items) > 0 {
+		// The page is the newest sessions, so it only needs flags from its
+		// oldest one onwards.
+		flags, err = s.sessionAnomalies(r.Context(), userID, &items[len(items)-1].Date, nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	out := make([]flaggedSession, 0, len(items))
+	for _, item := range items {
+		anomalies := flags[item.ID]
+		if anomalies == nil {
+			anomalies = []domainstats.AnomalyFlag{}
+		}
+		out = append(out, flaggedSession{Session: item, Anomalies: anomalies})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sessions": out})
+}
+
+// flaggedSession is a session with its anomaly flags.
+type flaggedSession struct {
+	sessions.Session
+	Anomalies []domainstats.AnomalyFlag `json:"anomalies"`
+}
+
+// sessionAnomalies flags the user's live sessions dated between from and to
+// with the default window and threshold.
+func (s *Server) sessionAnomalies(ctx context.Context, userID uuid.UUID, from, to *time.Time) (map[uuid.UUID][]domainstats.AnomalyFlag, error) {
+	history, err := s.anomalyHistory(ctx, userID, from, to, domainstats.DefaultAnomalyWindow)
+	if err != nil {
+		return nil, err
+	}
+	detected := domainstats.DetectAnomalies(history, domainstats.DefaultAnomalyWindow, domainstats.DefaultAnomalyThreshold)
+	out := make(map[uuid.UUID][]domainstats.AnomalyFlag, len(detected))
+	for _, item := range detected {
+		out[item.SessionID] = item.Flags
+	}
+	return out, nil
+}
+
+// anomalyHistory lists the user's live sessions between from and to, preceded
+// by the window sessions before from that form their baseline.
+func (s *Server) anomalyHistory(ctx context.Context, userID uuid.UUID, from, to *time.Time, window int) ([]sessions.Session, error) {
+	history, err := s.store.ListSessionsByDateRange(ctx, userID, from, to)
+	if err != nil || from == nil {
+		return history, err
+	}
+	baseline, err := s.store.ListSessionsBefore(ctx, userID, *from, window)
+	if err != nil {
+		return nil, err
+	}
+	return append(baseline, history...), nil
+}
+
+// listAnalysisSessions lists the user's live sessions in the date range,
+// leaving out flagged sessions when the request sets excludeAnomalies=true.
+func (s *Server) listAnalysisSessions(r *http.Request, userID uuid.UUID, from, to *time.Time) ([]sessions.Session, error) {
+	items, err := s.store.ListSessionsByDateRange(r.Context(), userID, from, to)
+	if err != nil || r.URL.Query().Get("excludeAnomalies") != "true" {
+		return items, err
+	}
+	flags, err := s.sessionAnomalies(r.Context(), userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]sessions.Session, 0, len(items))
+	for _, item := range items {
+		if _, flagged := flags[item.ID]; !flagged {
+			kept = append(kept, item)
+		}
+	}
+	return kept, nil
 }
 
 func (s *Server) handleCreateOpponent(w http.ResponseWriter, r *http.Request) {
@@ -136,6 +244,10 @@ func (s *Server) handleCreateOpponent(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := payload.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if payload.ID == uuid.Nil {
 		payload.ID = uuid.New()
 	}
@@ -149,11 +261,24 @@ func (s *Server) handleCreateOpponent(w http.ResponseWriter, r *http.Request) {
 	}
 	payload.UpdatedAt = now
 
-	if err := s.store.EnsureDefaultUser(r.Context(), userID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if err := s.store.CreateOpponent(r.Context(), payload); err != nil {
+	ctx := r.Context()
+	err := s.store.WithTx(ctx, func(tx *postgres.Store) error {
+		if err := tx.EnsureDefaultUser(ctx, userID); err != nil {
+			return err
+		}
+		if err := tx.CreateOpponent(ctx, payload); err != nil {
+			return err
+		}
+		return tx.EnqueueOutbox(ctx, userID, syncer.EventOpponentsChanged, syncer.OpponentsChanged{
+			UserID:      userID,
+			OpponentIDs: []uuid.UUID{payload.ID},
+		})
+	})
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			http.Error(w, "opponent with this identityKey already exists", http.StatusConflict)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -183,55 +308,121 @@ func (s *Server) handleSyncPush(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := negotiateSyncProtocol(w, r, domainsync.MinProtocolVersion)
+	if !ok {
+		return
+	}
+
+	if isNDJSON(r.Header.Get("Content-Type")) {
+		if r.URL.Query().Get("dryRun") == "true" {
+			http.Error(w, "dryRun is not supported for NDJSON push", http.StatusBadRequest)
+			return
+		}
+		s.handleSyncPushStream(w, r, userID, version)
+		return
+	}
+
 	var payload domainsync.PushRequest
 	if err := decodeJSON(r, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeDecodeError(w, err)
 		return
 	}
+	payload.ProtocolVersion = version
 
-	if err := s.store.EnsureDefaultUser(r.Context(), userID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if r.URL.Query().Get("dryRun") == "true" {
+		s.handleSyncPushDryRun(w, r, userID, payload)
 		return
 	}
 
-	response := domainsync.PushResponse{}
-
-	for _, item := range payload.Opponents {
-		item.UserID = userID
-		decision, err := s.store.UpsertOpponentByUpdatedAt(r.Context(), item)
+	ctx := r.Context()
+	var response domainsync.PushResponse
+	err := s.store.WithTx(ctx, func(tx *postgres.Store) error {
+		if err := tx.EnsureDefaultUser(ctx, userID); err != nil {
+			return err
+		}
+		batch, applied, err := syncer.NewService(tx, postgres.IsUniqueViolation).Apply(ctx, userID, payload)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return err
 		}
-		applyCounts(&response.Opponents, decision)
+		response = applied
+		return enqueueBatchEvents(ctx, tx, userID, batch)
+	})
+	if err != nil {
+		writeSyncError(w, err)
+		return
 	}
 
-	for _, item := range payload.Sessions {
-		item.UserID = userID
-		decision, err := s.store.UpsertSessionByUpdatedAt(r.Context(), item)
+	response.ServerTimestamp = time.Now().UTC()
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleSyncPushDryRun runs the full push and projection recompute inside a
+// transaction that is always rolled back, reporting what would have changed.
+func (s *Server) handleSyncPushDryRun(w http.ResponseWriter, r *http.Request, userID uuid.UUID, payload domainsync.PushRequest) {
+	ctx := r.Context()
+	var preview domainsync.PushPreview
+	err := s.store.WithRollback(ctx, func(tx *postgres.Store) error {
+		if err := tx.EnsureDefaultUser(ctx, userID); err != nil {
+			return err
+		}
+		before, err := projections.TakeSnapshot(ctx, tx, userID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return err
 		}
-		applyCounts(&response.Sessions, decision)
-	}
-
-	for _, item := range payload.MatchSets {
-		decision, err := s.store.UpsertMatchSetByUpdatedAt(r.Context(), item)
+		response, items, err := syncer.NewService(tx, postgres.IsUniqueViolation).PushDetailed(ctx, userID, payload)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return err
 		}
-		applyCounts(&response.MatchSets, decision)
-	}
-
-	response.ServerTimestamp = time.Now().UTC()
-	if err := s.projection.RecomputeForUser(r.Context(), userID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := projections.NewService(tx).RecomputeForUser(ctx, userID); err != nil {
+			return err
+		}
+		after, err := projections.TakeSnapshot(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		response.ServerTimestamp = time.Now().UTC()
+		preview = domainsync.PushPreview{
+			PushResponse:      response,
+			DryRun:            true,
+			Items:             items,
+			ProjectionDelta:   domainstats.NewUserStatsChange(before.User, after.User),
+			ProjectionChanges: projections.DiffSnapshots(before, after),
+		}
+		return nil
+	})
+	if err != nil {
+		writeSyncError(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, preview)
+}
 
-	writeJSON(w, http.StatusOK, response)
+// enqueueBatchEvents records the outbox events for a push on the push's own
+// transaction, so they exist if and only if the writes commit.
+func enqueueBatchEvents(ctx context.Context, tx *postgres.Store, userID uuid.UUID, batch *syncer.Batch) error {
+	changes, err := batch.SessionChanges(ctx)
+	if err != nil {
+		return err
+	}
+	if batch.RequiresRebuild() {
+		payload := projections.SessionsChanged{UserID: userID, Rebuild: true}
+		if err := tx.EnqueueOutbox(ctx, userID, projections.EventSessionsChanged, payload); err != nil {
+			return err
+		}
+	} else if len(changes) > 0 {
+		payload := projections.SessionsChanged{UserID: userID, Changes: changes}
+		if err := tx.EnqueueOutbox(ctx, userID, projections.EventSessionsChanged, payload); err != nil {
+			return err
+		}
+	}
+	if ids := batch.ChangedOpponentIDs(); len(ids) > 0 {
+		payload := syncer.OpponentsChanged{UserID: userID, OpponentIDs: ids}
+		if err := tx.EnqueueOutbox(ctx, userID, syncer.EventOpponentsChanged, payload); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *Server) handleSyncPull(w http.ResponseWriter, r *http.Request) {
@@ -240,6 +431,9 @@ func (s *Server) handleSyncPull(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	if _, ok := negotiateSyncProtocol(w, r, domainsync.MinProtocolVersion); !ok {
+		return
+	}
 	updatedAfterRaw := r.URL.Query().Get("updatedAfter")
 	if updatedAfterRaw == "" {
 		http.Error(w, "updatedAfter is required", http.StatusBadRequest)
@@ -251,19 +445,47 @@ func (s *Server) handleSyncPull(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessionsChanged, matchSetsChanged, opponentsChanged, err := s.store.PullChanges(r.Context(), userID, updatedAfter)
+	if acceptsNDJSON(r) {
+		s.handleSyncPullStream(w, r, userID, updatedAfter, requestDeviceID(r))
+		return
+	}
+
+	pulledAt := time.Now().UTC()
+	sessionsChanged, matchSetsChanged, opponentsChanged, goalsChanged, err := s.store.PullChanges(r.Context(), userID, updatedAfter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	purgedThrough, err := s.store.GetTombstonesPurgedThrough(r.Context(), userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if deviceID := requestDeviceID(r); deviceID != "" {
+		if err := s.store.EnsureDefaultUser(r.Context(), userID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := s.store.RecordDevicePull(r.Context(), userID, deviceID, pulledAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 
 	writeJSON(w, http.StatusOK, domainsync.PullResponse{
-		Sessions:  sessionsChanged,
-		MatchSets: matchSetsChanged,
-		Opponents: opponentsChanged,
+		Sessions:           sessionsChanged,
+		MatchSets:          matchSetsChanged,
+		Opponents:          opponentsChanged,
+		Goals:              goalsChanged,
+		FullResyncRequired: domainsync.RequiresFullResync(updatedAfter, purgedThrough),
 	})
 }
 
+func (s *Server) handleSyncCapabilities(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set(domainsync.ProtocolHeader, strconv.Itoa(domainsync.ProtocolVersionCurrent))
+	writeJSON(w, http.StatusOK, domainsync.CurrentCapabilities())
+}
+
 func (s *Server) handleOverview(w http.ResponseWriter, r *http.Request) {
 	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
@@ -280,8 +502,31 @@ func (s *Server) handleOverview(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	stale, err := s.store.HasUndeliveredOutbox(r.Context(), userID, projections.EventSessionsChanged)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, adjustedWinRate, err := s.store.GetPlayerRating(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	currentStreak, err := s.store.CurrentResultStreak(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stale = stale || (s.projector != nil && s.projector.Pending(userID))
+	// Users without a user_stats row yet have nothing outdated.
+	stale = stale || (!statsRow.LastCalculatedAt.IsZero() && statsRow.CalculatorVersion < domainstats.CalculatorVersion)
 	writeJSON(w, http.StatusOK, map[string]any{
+		"stale":                     stale,
+		"lastCalculatedAt":          statsRow.LastCalculatedAt,
+		"calculatorVersion":         statsRow.CalculatorVersion,
 		"winRate":                   statsRow.WinRate,
+		"strengthAdjustedWinRate":   adjustedWinRate,
+		"currentStreak":             currentStreak,
 		"avgComposure":              statsRow.AvgComposure,
 		"avgRushingIndex":           statsRow.AvgRushingIndex,
 		"improvementSlopeComposure": statsRow.ImprovementSlopeComposure,
@@ -291,6 +536,130 @@ func (s *Server) handleOverview(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handlePeriodStats serves the weekly, monthly or yearly projections. A from
+// date inside a period includes that whole period. The projections are kept in
+// the user's calendar; a tz override that differs from it is computed from the
+// sessions instead.
+func (s *Server) handlePeriodStats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	granularity := r.URL.Query().Get("granularity")
+	if granularity == "" {
+		granularity = domainstats.PeriodWeek
+	}
+	if !domainstats.ValidPeriodGranularity(granularity) {
+		http.Error(w, "granularity must be week, month or year", http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cal, overridden, err := s.requestCalendar(r.Context(), r, userID)
+	if err != nil {
+		writeCalendarError(w, err)
+		return
+	}
+
+	var periods []domainstats.PeriodStats
+	if overridden {
+		var fromAt, toAt *time.Time
+		if from != nil {
+			start, _ := cal.PeriodRange(*from, granularity)
+			fromAt = &start
+		}
+		if to != nil {
+			_, next := cal.PeriodRange(*to, granularity)
+			end := next.Add(-time.Microsecond)
+			toAt = &end
+		}
+		items, err := s.store.ListSessionsByDateRange(r.Context(), userID, fromAt, toAt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		periods = projections.ComputePeriodStats(cal, items, granularity)
+	} else {
+		var fromDate, toDate *time.Time
+		if from != nil {
+			start := cal.PeriodStart(*from, granularity)
+			fromDate = &start
+		}
+		if to != nil {
+			day := cal.Day(*to)
+			toDate = &day
+		}
+		periods, err = s.store.ListPeriodStats(r.Context(), userID, granularity, fromDate, toDate)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"granularity": granularity,
+		"timezone":    cal.Timezone(),
+		"periods":     periods,
+	})
+}
+
+const (
+	defaultHistoryPoints = 365
+	maxHistoryPoints     = 2000
+)
+
+// handleStatsHistory serves the daily user_stats snapshots as one series per
+// overview metric, downsampled to at most maxPoints points.
+func (s *Server) handleStatsHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	maxPoints := defaultHistoryPoints
+	if raw := r.URL.Query().Get("maxPoints"); raw != "" {
+		maxPoints, err = strconv.Atoi(raw)
+		if err != nil || maxPoints < 1 || maxPoints > maxHistoryPoints {
+			http.Error(w, fmt.Sprintf("maxPoints must be between 1 and %d", maxHistoryPoints), http.StatusBadRequest)
+			return
+		}
+	}
+	cal, _, err := s.requestCalendar(r.Context(), r, userID)
+	if err != nil {
+		writeCalendarError(w, err)
+		return
+	}
+	var fromDate, toDate *time.Time
+	if from != nil {
+		day := cal.Day(*from)
+		fromDate = &day
+	}
+	if to != nil {
+		day := cal.Day(*to)
+		toDate = &day
+	}
+
+	snapshots, err := s.store.ListUserStatsHistory(r.Context(), userID, fromDate, toDate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sampled, resolution := domainstats.DownsampleHistory(cal, snapshots, maxPoints)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"resolution": resolution,
+		"points":     len(sampled),
+		"series":     domainstats.HistorySeries(sampled),
+	})
+}
+
 func (s *Server) handleOpponentAnalysis(w http.ResponseWriter, r *http.Request) {
 	userID, ok := auth.UserIDFromContext(r.Context())
 	if !ok {
@@ -308,6 +677,13 @@ func (s *Server) handleOpponentAnalysis(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "invalid opponent id", http.StatusBadRequest)
 		return
 	}
+	if opponent, found, err := s.store.GetOpponent(r.Context(), userID, opponentID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if !found || opponent.DeletedAt != nil {
+		http.NotFound(w, r)
+		return
+	}
 	matchSessions, err := s.store.ListMatchSessionsByOpponent(r.Context(), userID, opponentID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -322,7 +698,7 @@ func (s *Server) handleOpponentAnalysis(w http.ResponseWriter, r *http.Request)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	statsRow, err := s.store.GetOpponentStats(r.Context(), opponentID)
+	statsRow, err := s.store.GetOpponentStats(r.Context(), userID, opponentID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -348,7 +724,7 @@ func (s *Server) handleTrends(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	items, err := s.store.ListSessionsByDateRange(r.Context(), userID, from, to)
+	items, err := s.listAnalysisSessions(r, userID, from, to)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -357,9 +733,15 @@ func (s *Server) handleTrends(w http.ResponseWriter, r *http.Request) {
 	if granularity == "" {
 		granularity = "week"
 	}
-	series := aggregateTrends(items, granularity)
+	cal, _, err := s.requestCalendar(r.Context(), r, userID)
+	if err != nil {
+		writeCalendarError(w, err)
+		return
+	}
+	series := aggregateTrends(cal, items, granularity)
 	writeJSON(w, http.StatusOK, map[string]any{
 		"granularity": granularity,
+		"timezone":    cal.Timezone(),
 		"series":      series,
 	})
 }
@@ -375,16 +757,449 @@ func (s *Server) handleCorrelations(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	items, err := s.store.ListSessionsByDateRange(r.Context(), userID, from, to)
+	minSamples, err := parseMinSamples(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items, err := s.listAnalysisSessions(r, userID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"minSamples":             minSamples,
+		"composureVsWin":         domainstats.CorrelationComposureVsWin(items, minSamples),
+		"rushingVsWin":           domainstats.CorrelationRushingVsWin(items, minSamples),
+		"followedFocusVsRushing": domainstats.CorrelationFollowedFocusVsRushing(items, minSamples),
+		"longRalliesVsWin":       domainstats.CorrelationLongRalliesVsWin(items, minSamples),
+	})
+}
+
+// handleCorrelationMatrix correlates every pair of the requested session
+// features, or of all of them when fields is empty.
+func (s *Server) handleCorrelationMatrix(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minSamples, err := parseMinSamples(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	method := r.URL.Query().Get("method")
+	if method == "" {
+		method = domainstats.CorrelationPearson
+	}
+	if !domainstats.ValidCorrelationMethod(method) {
+		http.Error(w, "method must be pearson or spearman", http.StatusBadRequest)
+		return
+	}
+	fields, err := parseFeatureFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, err := s.listAnalysisSessions(r, userID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setsBySession := map[uuid.UUID][]sessions.MatchSet{}
+	if slices.Contains(fields, domainstats.FeatureSetDifferential) {
+		sessionIDs := make([]uuid.UUID, 0, len(items))
+		for _, item := range items {
+			sessionIDs = append(sessionIDs, item.ID)
+		}
+		setsBySession, err = s.store.ListMatchSetsBySessionIDs(r.Context(), sessionIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	matrix := domainstats.BuildCorrelationMatrix(items, setsBySession, fields, method, minSamples)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"method":     matrix.Method,
+		"minSamples": minSamples,
+		"fields":     matrix.Fields,
+		"matrix":     matrix.Matrix,
+	})
+}
+
+// winProbabilityRequest describes a hypothetical session to score.
+type winProbabilityRequest struct {
+	DurationMinutes  int `json:"durationMinutes"`
+	Composure        int `json:"composure"`
+	RushedShots      int `json:"rushedShots"`
+	UnforcedErrors   int `json:"unforcedErrors"`
+	LongRallies      int `json:"longRallies"`
+	DirectionChanges int `json:"directionChanges"`
+}
+
+func (p winProbabilityRequest) session() (sessions.Session, error) {
+	if p.DurationMinutes <= 0 {
+		return sessions.Session{}, errors.New("durationMinutes must be positive")
+	}
+	if p.Composure < 1 || p.Composure > 10 {
+		return sessions.Session{}, errors.New("composure must be between 1 and 10")
+	}
+	if p.RushedShots < 0 || p.UnforcedErrors < 0 || p.LongRallies < 0 || p.DirectionChanges < 0 {
+		return sessions.Session{}, errors.New("counts must not be negative")
+	}
+	return sessions.Session{
+		DurationMinutes:  p.DurationMinutes,
+		Composure:        p.Composure,
+		RushedShots:      p.RushedShots,
+		UnforcedErrors:   p.UnforcedErrors,
+		LongRallies:      p.LongRallies,
+		DirectionChanges: p.DirectionChanges,
+	}, nil
+}
+
+// handleWinProbability fits the user's win model on their matches in the
+// date range and scores the posted session with it.
+func (s *Server) handleWinModel(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items, err := s.listAnalysisSessions(r, userID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, domainstats.FitWinModel(items))
+}
+
+func (s *Server) handleWinProbability(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var payload winProbabilityRequest
+	if err := decodeJSON(r, &payload); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	hypothetical, err := payload.session()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items, err := s.listAnalysisSessions(r, userID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	model := domainstats.FitWinModel(items)
+	probability, contributions := model.Predict(hypothetical)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"probability":   probability,
+		"contributions": contributions,
+		"model":         model,
+	})
+}
+
+const (
+	defaultRollingWindow = 5
+	maxRollingWindow     = 100
+	defaultRollingDays   = 28
+	maxRollingDays       = 365
+	defaultHalfLifeDays  = 14
+	maxHalfLifeDays      = 365
+)
+
+// handleRolling serves rolling N-session and N-day averages and an EWMA of
+// the session metrics, with one point per session in the range.
+func (s *Server) handleRolling(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	window, err := parseBoundedInt(r, "window", defaultRollingWindow, 1, maxRollingWindow)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	days, err := parseBoundedInt(r, "days", defaultRollingDays, 1, maxRollingDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	halfLife := float64(defaultHalfLifeDays)
+	if raw := r.URL.Query().Get("halfLifeDays"); raw != "" {
+		halfLife, err = strconv.ParseFloat(raw, 64)
+		if err != nil || !(halfLife > 0 && halfLife <= maxHalfLifeDays) {
+			http.Error(w, fmt.Sprintf("halfLifeDays must be greater than 0 and at most %d", maxHalfLifeDays), http.StatusBadRequest)
+			return
+		}
+	}
+	items, err := s.listAnalysisSessions(r, userID, from, to)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	series := domainstats.BuildRollingSeries(items, window, days, halfLife)
 	writeJSON(w, http.StatusOK, map[string]any{
-		"composureVsWin":         domainstats.CorrelationComposureVsWin(items),
-		"rushingVsWin":           domainstats.CorrelationRushingVsWin(items),
-		"followedFocusVsRushing": domainstats.CorrelationFollowedFocusVsRushing(items),
-		"longRalliesVsWin":       domainstats.CorrelationLongRalliesVsWin(items),
+		"window":        window,
+		"days":          days,
+		"halfLifeDays":  halfLife,
+		"sessionWindow": series.SessionWindow,
+		"dayWindow":     series.DayWindow,
+		"ewma":          series.EWMA,
+	})
+}
+
+// handleOpponentProfiles splits match performance in the date range by the
+// opponents' dominant hand and play style.
+func (s *Server) handleOpponentProfiles(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items, err := s.listAnalysisSessions(r, userID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	matchSessions := make([]sessions.Session, 0, len(items))
+	sessionIDs := make([]uuid.UUID, 0, len(items))
+	for _, item := range items {
+		if item.IsMatch() && item.OpponentID != nil {
+			matchSessions = append(matchSessions, item)
+			sessionIDs = append(sessionIDs, item.ID)
+		}
+	}
+	setsBySession, err := s.store.ListMatchSetsBySessionIDs(r.Context(), sessionIDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Deleted opponents keep their traits for the matches played against them.
+	opponentItems, err := s.store.ListOpponentsByUser(r.Context(), userID, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	opponentsByID := make(map[uuid.UUID]opponents.Opponent, len(opponentItems))
+	for _, item := range opponentItems {
+		opponentsByID[item.ID] = item
+	}
+	writeJSON(w, http.StatusOK, domainstats.BuildOpponentProfiles(matchSessions, setsBySession, opponentsByID))
+}
+
+const maxFormSize = 50
+
+// handleStreaks serves win, loss, focus and composure streaks and the recent
+// form over the sessions in the date range.
+func (s *Server) handleStreaks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	formSize, err := parseBoundedInt(r, "form", domainstats.DefaultFormSize, 1, maxFormSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minComposure, err := parseBoundedInt(r, "minComposure", domainstats.DefaultMinComposure, 1, 10)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	items, err := s.listAnalysisSessions(r, userID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, domainstats.BuildStreaks(items, formSize, minComposure))
+}
+
+const (
+	maxAnomalyWindow    = 200
+	maxAnomalyThreshold = 20
+)
+
+// handleAnomalies lists the sessions in the date range with metrics far from
+// the robust baseline of the sessions before them. Baselines reach back
+// before the range.
+func (s *Server) handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	window, err := parseBoundedInt(r, "window", domainstats.DefaultAnomalyWindow, domainstats.AnomalyMinBaseline, maxAnomalyWindow)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	threshold := domainstats.DefaultAnomalyThreshold
+	if raw := r.URL.Query().Get("threshold"); raw != "" {
+		threshold, err = strconv.ParseFloat(raw, 64)
+		if err != nil || !(threshold > 0 && threshold <= maxAnomalyThreshold) {
+			http.Error(w, fmt.Sprintf("threshold must be greater than 0 and at most %d", maxAnomalyThreshold), http.StatusBadRequest)
+			return
+		}
+	}
+
+	history, err := s.anomalyHistory(r.Context(), userID, from, to, window)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	checked := 0
+	for _, item := range history {
+		if inDateRange(item.Date, from, to) {
+			checked++
+		}
+	}
+	flagged := make([]domainstats.SessionAnomalies, 0)
+	byMetric := make(map[string]int, len(domainstats.AnomalyMetrics))
+	for _, metric := range domainstats.AnomalyMetrics {
+		byMetric[metric] = 0
+	}
+	for _, item := range domainstats.DetectAnomalies(history, window, threshold) {
+		if !inDateRange(item.Date, from, to) {
+			continue
+		}
+		flagged = append(flagged, item)
+		for _, flag := range item.Flags {
+			byMetric[flag.Metric]++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"window":          window,
+		"threshold":       threshold,
+		"sessionsChecked": checked,
+		"byMetric":        byMetric,
+		"sessions":        flagged,
+	})
+}
+
+func inDateRange(t time.Time, from, to *time.Time) bool {
+	return (from == nil || !t.Before(*from)) && (to == nil || !t.After(*to))
+}
+
+// ratedOpponent is an opponent's current rating with their name.
+type ratedOpponent struct {
+	OpponentID uuid.UUID `json:"opponentId"`
+	Name       string    `json:"name"`
+	domainstats.Rating
+}
+
+// handleRatings serves the player's and opponents' current Glicko-2 ratings
+// with the rating history of the matches in the date range, optionally
+// limited to one opponent.
+func (s *Server) handleRatings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var opponentFilter *uuid.UUID
+	if raw := r.URL.Query().Get("opponentId"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			http.Error(w, "invalid opponentId", http.StatusBadRequest)
+			return
+		}
+		opponentFilter = &id
+	}
+
+	player, adjustedWinRate, err := s.store.GetPlayerRating(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ratings, err := s.store.ListOpponentRatings(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	opponentItems, err := s.store.ListOpponentsByUser(r.Context(), userID, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	history, err := s.store.ListRatingHistory(r.Context(), userID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	opponentsOut := make([]ratedOpponent, 0, len(ratings))
+	for _, item := range opponentItems {
+		rating, ok := ratings[item.ID]
+		if !ok || (opponentFilter != nil && *opponentFilter != item.ID) {
+			continue
+		}
+		opponentsOut = append(opponentsOut, ratedOpponent{OpponentID: item.ID, Name: item.Name, Rating: rating})
+	}
+	sort.Slice(opponentsOut, func(i, j int) bool { return opponentsOut[i].Rating.Rating > opponentsOut[j].Rating.Rating })
+	if opponentFilter != nil {
+		filtered := make([]domainstats.RatingEvent, 0)
+		for _, event := range history {
+			if event.OpponentID == *opponentFilter {
+				filtered = append(filtered, event)
+			}
+		}
+		history = filtered
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"player":                  player,
+		"strengthAdjustedWinRate": adjustedWinRate,
+		"opponents":               opponentsOut,
+		"history":                 history,
 	})
 }
 
@@ -404,7 +1219,7 @@ func (s *Server) handleDeepAnalysis(w http.ResponseWriter, r *http.Request) {
 		granularity = "week"
 	}
 
-	items, err := s.store.ListSessionsByDateRange(r.Context(), userID, from, to)
+	items, err := s.listAnalysisSessions(r, userID, from, to)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -427,18 +1242,43 @@ func (s *Server) handleDeepAnalysis(w http.ResponseWriter, r *http.Request) {
 	for _, item := range opponentItems {
 		opponentNames[item.ID] = item.Name
 	}
+	cal, _, err := s.requestCalendar(r.Context(), r, userID)
+	if err != nil {
+		writeCalendarError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, domainstats.BuildDeepInsights(cal, items, setsBySession, opponentNames, granularity))
+}
 
-	writeJSON(w, http.StatusOK, domainstats.BuildDeepInsights(items, setsBySession, opponentNames, granularity))
+func negotiateSyncProtocol(w http.ResponseWriter, r *http.Request, minVersion int) (int, bool) {
+	w.Header().Set(domainsync.ProtocolHeader, strconv.Itoa(domainsync.ProtocolVersionCurrent))
+	version, err := domainsync.ParseProtocolVersion(r.Header.Get(domainsync.ProtocolHeader), minVersion)
+	switch {
+	case errors.Is(err, domainsync.ErrProtocolTooOld):
+		writeJSON(w, http.StatusUpgradeRequired, map[string]any{
+			"error":              "client sync protocol is too old, please update the app",
+			"protocolVersion":    version,
+			"minProtocolVersion": minVersion,
+			"serverVersion":      domainsync.ProtocolVersionCurrent,
+		})
+		return 0, false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	return version, true
 }
 
-func applyCounts(c *domainsync.EntityCounts, d domainsync.MergeDecision) {
-	switch d {
-	case domainsync.DecisionInsert:
-		c.Inserted++
-	case domainsync.DecisionUpdate:
-		c.Updated++
+func writeSyncError(w http.ResponseWriter, err error) {
+	var itemErr *domainsync.ItemError
+	switch {
+	case errors.Is(err, domainsync.ErrForeignOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.As(err, &itemErr):
+		http.Error(w, err.Error(), http.StatusBadRequest)
 	default:
-		c.Ignored++
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
@@ -454,6 +1294,50 @@ func userIDFromContext(ctx context.Context) (uuid.UUID, bool) {
 	return auth.UserIDFromContext(ctx)
 }
 
+// parseBoundedInt reads an optional integer query parameter in [lo, hi].
+func parseBoundedInt(r *http.Request, name string, fallback, lo, hi int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < lo || v > hi {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, lo, hi)
+	}
+	return v, nil
+}
+
+func parseMinSamples(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("minSamples")
+	if raw == "" {
+		return domainstats.DefaultCorrelationSamples, nil
+	}
+	minSamples, err := strconv.Atoi(raw)
+	if err != nil || minSamples < domainstats.MinCorrelationSamples {
+		return 0, fmt.Errorf("minSamples must be an integer of at least %d", domainstats.MinCorrelationSamples)
+	}
+	return minSamples, nil
+}
+
+// parseFeatureFields splits a comma-separated list of session features,
+// dropping duplicates. An empty list selects every feature.
+func parseFeatureFields(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return domainstats.SessionFeatures, nil
+	}
+	fields := make([]string, 0)
+	for _, part := range strings.Split(raw, ",") {
+		field := strings.TrimSpace(part)
+		if !domainstats.ValidSessionFeature(field) {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
 func parseDateRange(r *http.Request) (*time.Time, *time.Time, error) {
 	var from, to *time.Time
 	if raw := r.URL.Query().Get("from"); raw != "" {
@@ -473,14 +1357,14 @@ func parseDateRange(r *http.Request) (*time.Time, *time.Time, error) {
 	return from, to, nil
 }
 
-func aggregateTrends(items []sessions.Session, granularity string) []map[string]any {
+func aggregateTrends(cal domainstats.Calendar, items []sessions.Session, granularity string) []map[string]any {
 	type bucket struct {
 		sessions []sessions.Session
 		matches  []sessions.Session
 	}
 	buckets := make(map[time.Time]*bucket)
 	for _, item := range items {
-		key := bucketStart(item.Date, granularity)
+		key := bucketStart(cal, item.Date, granularity)
 		if _, ok := buckets[key]; !ok {
 			buckets[key] = &bucket{}
 		}
@@ -511,12 +1395,11 @@ func aggregateTrends(items []sessions.Session, granularity string) []map[string]
 	return out
 }
 
-func bucketStart(t time.Time, granularity string) time.Time {
-	t = t.UTC()
+func bucketStart(cal domainstats.Calendar, t time.Time, granularity string) time.Time {
 	if granularity == "month" {
-		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return cal.PeriodStart(t, domainstats.PeriodMonth)
 	}
-	return domainstats.WeekStart(t)
+	return cal.WeekStartOf(t)
 }
 
 type matchHistoryRow struct {
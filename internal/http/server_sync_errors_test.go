@@ -0,0 +1,74 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	domainsync "github.com/lutefd/baseline-api/internal/domain/sync"
+)
+
+func TestWriteSyncErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "validation", err: &domainsync.ItemError{EntityType: domainsync.EntitySession, ID: uuid.New(), Err: errors.New("composure must be between 1 and 10")}, want: http.StatusBadRequest},
+		{name: "foreign owner", err: fmt.Errorf("push: %w", &domainsync.ItemError{EntityType: domainsync.EntityOpponent, ID: uuid.New(), Err: domainsync.ErrForeignOwner}), want: http.StatusForbidden},
+		{name: "storage", err: errors.New("connection reset"), want: http.StatusInternalServerError},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeSyncError(rec, tc.err)
+			if rec.Code != tc.want {
+				t.Fatalf("expected status %d, got %d", tc.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestNegotiateSyncProtocol(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		min     int
+		want    int
+		wantOK  bool
+		wantErr int
+	}{
+		{name: "missing header is legacy", header: "", min: domainsync.MinProtocolVersion, want: domainsync.ProtocolVersionLegacy, wantOK: true},
+		{name: "current", header: "2", min: domainsync.MinProtocolVersion, want: 2, wantOK: true},
+		{name: "garbage", header: "v2", min: domainsync.MinProtocolVersion, wantErr: http.StatusBadRequest},
+		{name: "too old", header: "1", min: 2, wantErr: http.StatusUpgradeRequired},
+		{name: "missing header below minimum", header: "", min: 2, wantErr: http.StatusUpgradeRequired},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/sync/pull", nil)
+			if tc.header != "" {
+				req.Header.Set(domainsync.ProtocolHeader, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			got, ok := negotiateSyncProtocol(rec, req, tc.min)
+			if ok != tc.wantOK {
+				t.Fatalf("expected ok=%v, got %v", tc.wantOK, ok)
+			}
+			if ok && got != tc.want {
+				t.Fatalf("expected version %d, got %d", tc.want, got)
+			}
+			if !ok && rec.Code != tc.wantErr {
+				t.Fatalf("expected status %d, got %d", tc.wantErr, rec.Code)
+			}
+			if rec.Header().Get(domainsync.ProtocolHeader) == "" {
+				t.Fatalf("expected server protocol header to be set")
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/auth"
+	domainstats "github.com/lutefd/baseline-api/internal/domain/stats"
+	"github.com/lutefd/baseline-api/internal/projections"
+	"github.com/lutefd/baseline-api/internal/storage/postgres"
+)
+
+// calendarSettings is the wire form of a user's stats.Calendar.
+type calendarSettings struct {
+	Timezone  string `json:"timezone"`
+	WeekStart string `json:"weekStart"`
+}
+
+func newCalendarSettings(cal domainstats.Calendar) calendarSettings {
+	return calendarSettings{Timezone: cal.Timezone(), WeekStart: strings.ToLower(cal.WeekStart.String())}
+}
+
+func (s *Server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	cal, err := s.store.GetUserCalendar(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, newCalendarSettings(cal))
+}
+
+// handleUpdateSettings stores the user's calendar. Every period projection is
+// keyed by it, so a change queues a full projection rebuild in the same
+// transaction.
+func (s *Server) handleUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var payload calendarSettings
+	if err := decodeJSON(r, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	weekStart := time.Monday
+	if payload.WeekStart != "" {
+		parsed, err := domainstats.ParseWeekday(payload.WeekStart)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		weekStart = parsed
+	}
+	cal, err := domainstats.NewCalendar(payload.Timezone, weekStart)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	err = s.store.WithTx(ctx, func(tx *postgres.Store) error {
+		if err := tx.EnsureDefaultUser(ctx, userID); err != nil {
+			return err
+		}
+		changed, err := tx.UpdateUserCalendar(ctx, userID, cal)
+		if err != nil || !changed {
+			return err
+		}
+		return tx.EnqueueOutbox(ctx, userID, projections.EventSessionsChanged, projections.SessionsChanged{
+			UserID:  userID,
+			Rebuild: true,
+		})
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, newCalendarSettings(cal))
+}
+
+// requestCalendar returns the user's calendar with its time zone replaced by
+// the tz query parameter, if present. The boolean reports whether tz changed
+// the stored time zone. A bad tz yields an invalidTimezoneError.
+func (s *Server) requestCalendar(ctx context.Context, r *http.Request, userID uuid.UUID) (domainstats.Calendar, bool, error) {
+	cal, err := s.store.GetUserCalendar(ctx, userID)
+	if err != nil {
+		return cal, false, err
+	}
+	tz := strings.TrimSpace(r.URL.Query().Get("tz"))
+	if tz == "" {
+		return cal, false, nil
+	}
+	override, err := domainstats.NewCalendar(tz, cal.WeekStart)
+	if err != nil {
+		return cal, false, invalidTimezoneError{err}
+	}
+	return override, override.Timezone() != cal.Timezone(), nil
+}
+
+type invalidTimezoneError struct{ error }
+
+// writeCalendarError answers a requestCalendar failure.
+func writeCalendarError(w http.ResponseWriter, err error) {
+	var tzErr invalidTimezoneError
+	if errors.As(err, &tzErr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
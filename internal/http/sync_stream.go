@@ -0,0 +1,196 @@
+package httpserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/goals"
+	"github.com/lutefd/baseline-api/internal/domain/opponents"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+	domainsync "github.com/lutefd/baseline-api/internal/domain/sync"
+	"github.com/lutefd/baseline-api/internal/storage/postgres"
+	"github.com/lutefd/baseline-api/internal/syncer"
+)
+
+// handleSyncPushStream applies an NDJSON push line by line, in one transaction
+// together with its outbox events. Each line is a StreamRecord whose data is an
+// opponent, session, match set or goal.
+func (s *Server) handleSyncPushStream(w http.ResponseWriter, r *http.Request, userID uuid.UUID, version int) {
+	ctx := r.Context()
+	var response domainsync.PushResponse
+	err := s.store.WithTx(ctx, func(tx *postgres.Store) error {
+		if err := tx.EnsureDefaultUser(ctx, userID); err != nil {
+			return err
+		}
+		batch := syncer.NewService(tx, postgres.IsUniqueViolation).Begin(userID, version)
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLineBytes)
+		line := 0
+		for scanner.Scan() {
+			line++
+			raw := bytes.TrimSpace(scanner.Bytes())
+			if len(raw) == 0 {
+				continue
+			}
+			if err := applyStreamRecord(ctx, batch, raw); err != nil {
+				var decodeErr streamDecodeError
+				if errors.As(err, &decodeErr) {
+					return streamDecodeError{fmt.Errorf("line %d: %w", line, decodeErr.error)}
+				}
+				return err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return streamReadError{fmt.Errorf("line %d: %w", line+1, err)}
+		}
+
+		var err error
+		response, err = batch.Finish(ctx)
+		if err != nil {
+			return err
+		}
+		return enqueueBatchEvents(ctx, tx, userID, batch)
+	})
+
+	var decodeErr streamDecodeError
+	var readErr streamReadError
+	switch {
+	case err == nil:
+	case errors.As(err, &decodeErr):
+		http.Error(w, decodeErr.Error(), http.StatusBadRequest)
+		return
+	case errors.As(err, &readErr):
+		writeDecodeError(w, readErr.error)
+		return
+	default:
+		writeSyncError(w, err)
+		return
+	}
+	response.ServerTimestamp = time.Now().UTC()
+	writeJSON(w, http.StatusOK, response)
+}
+
+type streamDecodeError struct{ error }
+
+type streamReadError struct{ error }
+
+func applyStreamRecord(ctx context.Context, batch *syncer.Batch, raw []byte) error {
+	var record domainsync.StreamRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return streamDecodeError{err}
+	}
+	switch domainsync.EntityType(record.Type) {
+	case domainsync.EntityOpponent:
+		var item opponents.Opponent
+		if err := json.Unmarshal(record.Data, &item); err != nil {
+			return streamDecodeError{err}
+		}
+		return batch.ApplyOpponent(ctx, item)
+	case domainsync.EntitySession:
+		var item sessions.Session
+		if err := json.Unmarshal(record.Data, &item); err != nil {
+			return streamDecodeError{err}
+		}
+		return batch.ApplySession(ctx, item)
+	case domainsync.EntityMatchSet:
+		var item sessions.MatchSet
+		if err := json.Unmarshal(record.Data, &item); err != nil {
+			return streamDecodeError{err}
+		}
+		return batch.ApplyMatchSet(ctx, item)
+	case domainsync.EntityGoal:
+		var item goals.Goal
+		if err := json.Unmarshal(record.Data, &item); err != nil {
+			return streamDecodeError{err}
+		}
+		return batch.ApplyGoal(ctx, item)
+	default:
+		return streamDecodeError{fmt.Errorf("unknown record type %q", record.Type)}
+	}
+}
+
+// handleSyncPullStream writes changed rows as NDJSON while they are read from
+// the database, flushing periodically, and ends with a StreamRecordEnd trailer.
+func (s *Server) handleSyncPullStream(w http.ResponseWriter, r *http.Request, userID uuid.UUID, updatedAfter time.Time, deviceID string) {
+	pulledAt := time.Now().UTC()
+	purgedThrough, err := s.store.GetTombstonesPurgedThrough(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	end := domainsync.PullStreamEnd{
+		FullResyncRequired: domainsync.RequiresFullResync(updatedAfter, purgedThrough),
+		ServerTimestamp:    pulledAt,
+	}
+	// Headers are already sent, so failures are logged and reported as a
+	// final StreamRecordError line instead of a status code.
+	fail := func(err error) {
+		log.Printf("sync pull stream for user %s: %v", userID, err)
+		data, _ := json.Marshal(domainsync.PullStreamError{Error: err.Error()})
+		_ = enc.Encode(domainsync.StreamRecord{Type: domainsync.StreamRecordError, Data: data})
+	}
+	written := 0
+	err = s.store.StreamChanges(r.Context(), userID, updatedAfter, func(entityType domainsync.EntityType, item any) error {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(domainsync.StreamRecord{Type: string(entityType), Data: data}); err != nil {
+			return err
+		}
+		switch entityType {
+		case domainsync.EntitySession:
+			end.Sessions++
+		case domainsync.EntityMatchSet:
+			end.MatchSets++
+		case domainsync.EntityOpponent:
+			end.Opponents++
+		case domainsync.EntityGoal:
+			end.Goals++
+		}
+		written++
+		if flusher != nil && written%500 == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+	if deviceID != "" {
+		if err := s.store.EnsureDefaultUser(r.Context(), userID); err != nil {
+			fail(err)
+			return
+		}
+		if err := s.store.RecordDevicePull(r.Context(), userID, deviceID, pulledAt); err != nil {
+			fail(err)
+			return
+		}
+	}
+	data, err := json.Marshal(end)
+	if err != nil {
+		fail(err)
+		return
+	}
+	_ = enc.Encode(domainsync.StreamRecord{Type: domainsync.StreamRecordEnd, Data: data})
+}
+
+func requestDeviceID(r *http.Request) string {
+	return strings.TrimSpace(r.Header.Get("X-Device-ID"))
+}
@@ -0,0 +1,176 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/events"
+)
+
+// Record is one outbox row claimed for delivery.
+type Record struct {
+	ID       int64
+	UserID   uuid.UUID
+	Name     string
+	Payload  json.RawMessage
+	Attempts int
+}
+
+type Store interface {
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]Record, error)
+	MarkOutboxDelivered(ctx context.Context, id int64) error
+	MarkOutboxFailed(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string, dead bool) error
+	PurgeOutbox(ctx context.Context, deliveredBefore time.Time) (int64, error)
+}
+
+// Decoder turns a stored payload back into the value subscribers expect.
+type Decoder func(json.RawMessage) (any, error)
+
+// JSON decodes payloads into a T.
+func JSON[T any]() Decoder {
+	return func(raw json.RawMessage) (any, error) {
+		var v T
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+}
+
+// Dispatcher delivers outbox rows to the bus at least once. A row is claimed
+// under a lease, published, and marked delivered only when every subscriber
+// succeeded; otherwise it is retried with exponential backoff and moved to the
+// dead state after maxAttempts. Rows whose lease expires, for example because
+// the process died mid-delivery, are claimed again.
+type Dispatcher struct {
+	store       Store
+	bus         *events.Bus
+	decoders    map[string]Decoder
+	batchSize   int
+	lease       time.Duration
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	maxAttempts int
+	now         func() time.Time
+}
+
+func NewDispatcher(store Store, bus *events.Bus) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		bus:         bus,
+		decoders:    make(map[string]Decoder),
+		batchSize:   100,
+		lease:       time.Minute,
+		baseBackoff: time.Second,
+		maxBackoff:  5 * time.Minute,
+		maxAttempts: 10,
+		now:         time.Now,
+	}
+}
+
+// Register sets the decoder for an event name. Events without a decoder are
+// published with their raw JSON payload.
+func (d *Dispatcher) Register(name string, decode Decoder) {
+	d.decoders[name] = decode
+}
+
+// DispatchOnce claims one batch of due rows and delivers them concurrently,
+// so subscribers that coalesce per user see the whole batch at once. It
+// returns the number of rows delivered.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	records, err := d.store.ClaimOutbox(ctx, d.batchSize, d.lease)
+	if err != nil {
+		return 0, err
+	}
+
+	results := make([]error, len(records))
+	var wg sync.WaitGroup
+	for i, record := range records {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = d.deliver(ctx, record)
+		}()
+	}
+	wg.Wait()
+
+	delivered := 0
+	for i, record := range records {
+		if results[i] == nil {
+			if err := d.store.MarkOutboxDelivered(ctx, record.ID); err != nil {
+				return delivered, err
+			}
+			delivered++
+			continue
+		}
+		attempts := record.Attempts + 1
+		dead := attempts >= d.maxAttempts
+		next := d.now().UTC().Add(d.backoff(attempts))
+		if dead {
+			log.Printf("outbox event %d (%s) dead after %d attempts: %v", record.ID, record.Name, attempts, results[i])
+		}
+		if err := d.store.MarkOutboxFailed(ctx, record.ID, attempts, next, results[i].Error(), dead); err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, record Record) error {
+	var payload any = record.Payload
+	if decode, ok := d.decoders[record.Name]; ok {
+		decoded, err := decode(record.Payload)
+		if err != nil {
+			return fmt.Errorf("decode %s payload: %w", record.Name, err)
+		}
+		payload = decoded
+	}
+	return d.bus.Publish(ctx, events.Event{ID: record.ID, Name: record.Name, Payload: payload})
+}
+
+// backoff doubles from baseBackoff for each failed attempt, capped at maxBackoff.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.baseBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.maxBackoff)
+}
+
+// Run polls for due rows every interval, draining full batches back to back,
+// and drops delivered rows older than retention once per hour.
+func (d *Dispatcher) Run(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+
+	for {
+		for {
+			delivered, err := d.DispatchOnce(ctx)
+			if err != nil {
+				log.Printf("outbox dispatch: %v", err)
+				break
+			}
+			if delivered < d.batchSize {
+				break
+			}
+		}
+		if d.now().Sub(lastPurge) >= time.Hour {
+			lastPurge = d.now()
+			if _, err := d.store.PurgeOutbox(ctx, lastPurge.UTC().Add(-retention)); err != nil {
+				log.Printf("outbox purge: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
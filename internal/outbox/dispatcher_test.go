@@ -0,0 +1,100 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/events"
+)
+
+type failure struct {
+	attempts int
+	next     time.Time
+	dead     bool
+}
+
+type outboxStoreMock struct {
+	records   []Record
+	delivered map[int64]bool
+	failed    map[int64]failure
+}
+
+func (m *outboxStoreMock) ClaimOutbox(_ context.Context, limit int, _ time.Duration) ([]Record, error) {
+	if len(m.records) > limit {
+		return m.records[:limit], nil
+	}
+	return m.records, nil
+}
+
+func (m *outboxStoreMock) MarkOutboxDelivered(_ context.Context, id int64) error {
+	m.delivered[id] = true
+	return nil
+}
+
+func (m *outboxStoreMock) MarkOutboxFailed(_ context.Context, id int64, attempts int, next time.Time, _ string, dead bool) error {
+	m.failed[id] = failure{attempts: attempts, next: next, dead: dead}
+	return nil
+}
+
+func (m *outboxStoreMock) PurgeOutbox(_ context.Context, _ time.Time) (int64, error) {
+	return 0, nil
+}
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func TestDispatchOnceDeliversDecodedPayloadsAndRetriesFailures(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	store := &outboxStoreMock{
+		records: []Record{
+			{ID: 1, UserID: uuid.New(), Name: "Greeted", Payload: json.RawMessage(`{"name":"ok"}`)},
+			{ID: 2, UserID: uuid.New(), Name: "Greeted", Payload: json.RawMessage(`{"name":"fail"}`), Attempts: 2},
+			{ID: 3, UserID: uuid.New(), Name: "Greeted", Payload: json.RawMessage(`{"name":"fail"}`), Attempts: 9},
+		},
+		delivered: map[int64]bool{},
+		failed:    map[int64]failure{},
+	}
+
+	bus := events.NewBus()
+	bus.Subscribe("Greeted", func(_ context.Context, e events.Event) error {
+		if e.Payload.(greeting).Name == "fail" {
+			return errors.New("subscriber failed")
+		}
+		return nil
+	})
+
+	d := NewDispatcher(store, bus)
+	d.now = func() time.Time { return now }
+	d.Register("Greeted", JSON[greeting]())
+
+	delivered, err := d.DispatchOnce(context.Background())
+	if err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	if delivered != 1 || !store.delivered[1] {
+		t.Fatalf("expected only event 1 to be delivered, got %d %+v", delivered, store.delivered)
+	}
+
+	retry := store.failed[2]
+	if retry.dead || retry.attempts != 3 || !retry.next.Equal(now.Add(4*time.Second)) {
+		t.Fatalf("expected event 2 to back off 4s on its third attempt, got %+v", retry)
+	}
+	if dead := store.failed[3]; !dead.dead || dead.attempts != 10 {
+		t.Fatalf("expected event 3 to be dead-lettered, got %+v", dead)
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	d := NewDispatcher(&outboxStoreMock{}, events.NewBus())
+	if got := d.backoff(1); got != time.Second {
+		t.Fatalf("expected first retry after 1s, got %s", got)
+	}
+	if got := d.backoff(30); got != d.maxBackoff {
+		t.Fatalf("expected backoff to cap at %s, got %s", d.maxBackoff, got)
+	}
+}
@@ -0,0 +1,71 @@
+package projections
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// coalescer is a per-key singleflight that never hands a caller the result of
+// a run that started before it arrived. Callers that find a run in progress
+// share one follow-up run instead of each starting their own. The follow-up
+// runs detached from the caller that created it, and every caller stops
+// waiting when its own ctx is done.
+type coalescer struct {
+	mu      sync.Mutex
+	running map[uuid.UUID]*flight
+}
+
+type flight struct {
+	ctx    context.Context
+	fn     func(context.Context) error
+	done   chan struct{}
+	err    error
+	next   *flight
+	joined int
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{running: make(map[uuid.UUID]*flight)}
+}
+
+func (c *coalescer) Do(ctx context.Context, key uuid.UUID, fn func(context.Context) error) error {
+	c.mu.Lock()
+	if current, ok := c.running[key]; ok {
+		if current.next == nil {
+			current.next = &flight{ctx: context.WithoutCancel(ctx), fn: fn, done: make(chan struct{})}
+		}
+		next := current.next
+		next.joined++
+		c.mu.Unlock()
+		select {
+		case <-next.done:
+			return next.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f := &flight{ctx: ctx, fn: fn, done: make(chan struct{})}
+	c.running[key] = f
+	c.mu.Unlock()
+
+	c.run(key, f)
+	return f.err
+}
+
+func (c *coalescer) run(key uuid.UUID, f *flight) {
+	f.err = f.fn(f.ctx)
+	close(f.done)
+
+	c.mu.Lock()
+	next := f.next
+	if next == nil {
+		delete(c.running, key)
+		c.mu.Unlock()
+		return
+	}
+	c.running[key] = next
+	c.mu.Unlock()
+	go c.run(key, next)
+}
@@ -0,0 +1,109 @@
+package projections
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCoalescerFoldsConcurrentCallersIntoOneFollowUpRun(t *testing.T) {
+	c := newCoalescer()
+	key := uuid.New()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var runs atomic.Int32
+
+	first := make(chan error, 1)
+	go func() {
+		first <- c.Do(context.Background(), key, func(context.Context) error {
+			runs.Add(1)
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Do(context.Background(), key, func(context.Context) error { runs.Add(1); return nil }); err != nil {
+				t.Errorf("follower failed: %v", err)
+			}
+		}()
+	}
+	for {
+		c.mu.Lock()
+		next := c.running[key].next
+		joined := next != nil && next.joined == 5
+		c.mu.Unlock()
+		if joined {
+			break
+		}
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+	if err := <-first; err != nil {
+		t.Fatalf("leader failed: %v", err)
+	}
+
+	if got := runs.Load(); got != 2 {
+		t.Fatalf("expected leader plus one shared follow-up run, got %d", got)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.running) != 0 {
+		t.Fatalf("expected no runs left in flight")
+	}
+}
+
+func TestCoalescerWaitersHonourTheirOwnContext(t *testing.T) {
+	c := newCoalescer()
+	key := uuid.New()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		_ = c.Do(context.Background(), key, func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	followUp := make(chan error, 1)
+	waited := make(chan error, 1)
+	go func() {
+		waited <- c.Do(ctx, key, func(ctx context.Context) error {
+			followUp <- ctx.Err()
+			return nil
+		})
+	}()
+	for {
+		c.mu.Lock()
+		joined := c.running[key].next != nil
+		c.mu.Unlock()
+		if joined {
+			break
+		}
+		runtime.Gosched()
+	}
+	cancel()
+	if err := <-waited; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancelled waiter to give up, got %v", err)
+	}
+
+	close(release)
+	if err := <-followUp; err != nil {
+		t.Fatalf("expected the follow-up to run detached from the cancelled caller, got %v", err)
+	}
+}
@@ -2,6 +2,8 @@ package projections
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"sort"
 	"time"
 
@@ -11,23 +13,201 @@ import (
 )
 
 type Store interface {
-	ListSessionsByUser(ctx context.Context, userID uuid.UUID, includeDeleted bool, limit int) ([]sessions.Session, error)
+	ListActiveSessionsByUser(ctx context.Context, userID uuid.UUID) ([]sessions.Session, error)
+	CountActiveSessions(ctx context.Context, userID uuid.UUID) (int, error)
 	ListMatchSetsBySessionIDs(ctx context.Context, sessionIDs []uuid.UUID) (map[uuid.UUID][]sessions.MatchSet, error)
 	UpsertUserStats(ctx context.Context, userID uuid.UUID, us stats.UserStats) error
-	UpsertOpponentStats(ctx context.Context, opponentID uuid.UUID, v stats.OpponentStats) error
-	ReplaceWeeklyStats(ctx context.Context, userID uuid.UUID, rows []stats.WeeklyStats) error
+	UpsertOpponentStats(ctx context.Context, userID, opponentID uuid.UUID, v stats.OpponentStats) error
+	DeleteOpponentStatsExcept(ctx context.Context, userID uuid.UUID, keep []uuid.UUID) error
+	ReplacePeriodStats(ctx context.Context, userID uuid.UUID, granularity string, rows []stats.PeriodStats) error
+	ReplaceRatings(ctx context.Context, userID uuid.UUID, r stats.Ratings) error
+	AppendRatings(ctx context.Context, userID uuid.UUID, r stats.Ratings) error
+	LoadRatings(ctx context.Context, userID uuid.UUID, opponentIDs []uuid.UUID) (stats.Ratings, bool, error)
+	LastRatingEvent(ctx context.Context, userID uuid.UUID) (stats.RatingEvent, bool, error)
+	GetUserCalendar(ctx context.Context, userID uuid.UUID) (stats.Calendar, error)
+	LoadAccumulators(ctx context.Context, userID uuid.UUID, cal stats.Calendar, periods map[string][]time.Time, opponentIDs []uuid.UUID) (stats.Accumulators, bool, error)
+	SaveAccumulators(ctx context.Context, userID uuid.UUID, acc stats.Accumulators, now time.Time, eventIDs []int64) error
+	ReplaceAccumulators(ctx context.Context, userID uuid.UUID, acc stats.Accumulators, eventIDs []int64) error
+	AppliedEvents(ctx context.Context, eventIDs []int64) (map[int64]bool, error)
+	MarkEventsApplied(ctx context.Context, userID uuid.UUID, eventIDs []int64) error
 }
 
+// LockFunc runs fn under a per-user lock with a Store bound to the lock's
+// transaction.
+type LockFunc func(ctx context.Context, userID uuid.UUID, fn func(Store) error) error
+
 type Service struct {
-	store Store
+	store   Store
+	lock    LockFunc
+	flights *coalescer
 }
 
 func NewService(store Store) *Service {
-	return &Service{store: store}
+	return &Service{store: store, flights: newCoalescer()}
+}
+
+func (s *Service) WithLock(lock LockFunc) *Service {
+	s.lock = lock
+	return s
 }
 
+func (s *Service) locked(ctx context.Context, userID uuid.UUID, fn func(*Service) error) error {
+	if s.lock == nil {
+		return fn(s)
+	}
+	return s.lock(ctx, userID, func(store Store) error {
+		return fn(&Service{store: store})
+	})
+}
+
+// ApplyEvents adjusts the stored accumulators instead of rereading every
+// session, skipping events already applied. It falls back to a full rebuild
+// when the accumulators are missing, outdated or inconsistent.
+func (s *Service) ApplyEvents(ctx context.Context, userID uuid.UUID, batch []SessionsChanged) error {
+	return s.locked(ctx, userID, func(locked *Service) error {
+		return locked.applyEvents(ctx, userID, batch)
+	})
+}
+
+func (s *Service) applyEvents(ctx context.Context, userID uuid.UUID, batch []SessionsChanged) error {
+	eventIDs := make([]int64, 0, len(batch))
+	for _, e := range batch {
+		if e.EventID != 0 {
+			eventIDs = append(eventIDs, e.EventID)
+		}
+	}
+	applied, err := s.store.AppliedEvents(ctx, eventIDs)
+	if err != nil {
+		return err
+	}
+
+	var changes []stats.SessionChange
+	fresh := make([]int64, 0, len(eventIDs))
+	rebuild := false
+	for _, e := range batch {
+		if e.EventID != 0 {
+			if applied[e.EventID] {
+				continue
+			}
+			fresh = append(fresh, e.EventID)
+		}
+		rebuild = rebuild || e.Rebuild
+		changes = append(changes, e.Changes...)
+	}
+	if rebuild {
+		return s.rebuild(ctx, userID, fresh)
+	}
+	if len(changes) == 0 {
+		return s.store.MarkEventsApplied(ctx, userID, fresh)
+	}
+
+	cal, err := s.store.GetUserCalendar(ctx, userID)
+	if err != nil {
+		return err
+	}
+	periods, opponentIDs := touchedKeys(cal, changes)
+	acc, found, err := s.store.LoadAccumulators(ctx, userID, cal, periods, opponentIDs)
+	if err != nil {
+		return err
+	}
+	if !found || acc.Version < stats.CalculatorVersion {
+		return s.rebuild(ctx, userID, fresh)
+	}
+
+	acc.Apply(changes)
+	if !acc.Consistent() {
+		return s.rebuild(ctx, userID, fresh)
+	}
+	count, err := s.store.CountActiveSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if count != acc.User.Sessions {
+		return s.rebuild(ctx, userID, fresh)
+	}
+	if touchesMatches(changes) {
+		if err := s.updateRatings(ctx, userID, changes); err != nil {
+			return err
+		}
+	}
+	return s.store.SaveAccumulators(ctx, userID, acc, time.Now().UTC(), fresh)
+}
+
+// RecomputeForUser coalesces calls that arrive during a running rebuild into
+// one follow-up rebuild.
 func (s *Service) RecomputeForUser(ctx context.Context, userID uuid.UUID) error {
-	allSessions, err := s.store.ListSessionsByUser(ctx, userID, false, 20000)
+	recompute := func(ctx context.Context) error {
+		return s.locked(ctx, userID, func(locked *Service) error {
+			return locked.rebuild(ctx, userID, nil)
+		})
+	}
+	// A service bound to a lock is already inside a flight; joining one
+	// again would wait on itself.
+	if s.flights == nil {
+		return recompute(ctx)
+	}
+	return s.flights.Do(ctx, userID, recompute)
+}
+
+type OutdatedStore interface {
+	ListOutdatedProjectionUsers(ctx context.Context, version int) ([]uuid.UUID, error)
+}
+
+func (s *Service) RebuildOutdated(ctx context.Context, store OutdatedStore) (int, error) {
+	userIDs, err := store.ListOutdatedProjectionUsers(ctx, stats.CalculatorVersion)
+	if err != nil {
+		return 0, err
+	}
+	rebuilt := 0
+	var errs []error
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return rebuilt, errors.Join(append(errs, err)...)
+		}
+		if err := s.RecomputeForUser(ctx, userID); err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", userID, err))
+			continue
+		}
+		rebuilt++
+	}
+	return rebuilt, errors.Join(errs...)
+}
+
+type OutdatedRatingsStore interface {
+	ListOutdatedRatingUsers(ctx context.Context, version int) ([]uuid.UUID, error)
+}
+
+// RebuildOutdatedRatings recomputes only the ratings of users whose ratings
+// are missing or older than stats.RatingsVersion.
+func (s *Service) RebuildOutdatedRatings(ctx context.Context, store OutdatedRatingsStore) (int, error) {
+	userIDs, err := store.ListOutdatedRatingUsers(ctx, stats.RatingsVersion)
+	if err != nil {
+		return 0, err
+	}
+	rebuilt := 0
+	var errs []error
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return rebuilt, errors.Join(append(errs, err)...)
+		}
+		err := s.locked(ctx, userID, func(locked *Service) error {
+			return locked.recomputeRatings(ctx, userID)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %s: %w", userID, err))
+			continue
+		}
+		rebuilt++
+	}
+	return rebuilt, errors.Join(errs...)
+}
+
+func (s *Service) rebuild(ctx context.Context, userID uuid.UUID, eventIDs []int64) error {
+	cal, err := s.store.GetUserCalendar(ctx, userID)
+	if err != nil {
+		return err
+	}
+	allSessions, err := s.store.ListActiveSessionsByUser(ctx, userID)
 	if err != nil {
 		return err
 	}
@@ -51,24 +231,31 @@ func (s *Service) RecomputeForUser(ctx context.Context, userID uuid.UUID) error
 		ImprovementSlopeComposure: stats.Round(stats.ImprovementSlopeComposure(allSessions)),
 		ImprovementSlopeRushing:   stats.Round(stats.ImprovementSlopeRushing(allSessions)),
 		LastCalculatedAt:          time.Now().UTC(),
+		CalculatorVersion:         stats.CalculatorVersion,
 	}
 	if err := s.store.UpsertUserStats(ctx, userID, us); err != nil {
 		return err
 	}
 
-	if err := s.recomputeOpponents(ctx, matchSessions); err != nil {
+	setsBySession, err := s.recomputeOpponents(ctx, userID, matchSessions)
+	if err != nil {
 		return err
 	}
 
-	weekly := computeWeeklyStats(allSessions)
-	if err := s.store.ReplaceWeeklyStats(ctx, userID, weekly); err != nil {
+	if err := s.store.ReplaceRatings(ctx, userID, stats.ComputeRatings(matchSessions, setsBySession)); err != nil {
 		return err
 	}
 
-	return nil
+	for _, granularity := range stats.PeriodGranularities {
+		if err := s.store.ReplacePeriodStats(ctx, userID, granularity, ComputePeriodStats(cal, allSessions, granularity)); err != nil {
+			return err
+		}
+	}
+
+	return s.store.ReplaceAccumulators(ctx, userID, stats.BuildAccumulators(cal, allSessions, setsBySession), eventIDs)
 }
 
-func (s *Service) recomputeOpponents(ctx context.Context, matchSessions []sessions.Session) error {
+func (s *Service) recomputeOpponents(ctx context.Context, userID uuid.UUID, matchSessions []sessions.Session) (map[uuid.UUID][]sessions.MatchSet, error) {
 	byOpponent := make(map[uuid.UUID][]sessions.Session)
 	sessionIDs := make([]uuid.UUID, 0)
 	for _, item := range matchSessions {
@@ -82,7 +269,7 @@ func (s *Service) recomputeOpponents(ctx context.Context, matchSessions []sessio
 
 	setsBySession, err := s.store.ListMatchSetsBySessionIDs(ctx, sessionIDs)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for opponentID, sessionsForOpponent := range byOpponent {
@@ -98,51 +285,211 @@ func (s *Service) recomputeOpponents(ctx context.Context, matchSessions []sessio
 			AvgRushingIndex:    stats.Round(stats.AverageRushingIndex(sessionsForOpponent)),
 			AvgSetDifferential: 0,
 			LastCalculatedAt:   time.Now().UTC(),
+			CalculatorVersion:  stats.CalculatorVersion,
 		}
 		if len(sessionsForOpponent) > 0 {
 			os.AvgSetDifferential = stats.Round(float64(setDiffTotal) / float64(len(sessionsForOpponent)))
 		}
-		if err := s.store.UpsertOpponentStats(ctx, opponentID, os); err != nil {
-			return err
+		if err := s.store.UpsertOpponentStats(ctx, userID, opponentID, os); err != nil {
+			return nil, err
+		}
+	}
+
+	keep := make([]uuid.UUID, 0, len(byOpponent))
+	for opponentID := range byOpponent {
+		keep = append(keep, opponentID)
+	}
+	if err := s.store.DeleteOpponentStatsExcept(ctx, userID, keep); err != nil {
+		return nil, err
+	}
+	return setsBySession, nil
+}
+
+func (s *Service) recomputeRatings(ctx context.Context, userID uuid.UUID) error {
+	allSessions, err := s.store.ListActiveSessionsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	matchSessions := make([]sessions.Session, 0)
+	sessionIDs := make([]uuid.UUID, 0)
+	for _, item := range allSessions {
+		if item.IsMatch() && item.OpponentID != nil {
+			matchSessions = append(matchSessions, item)
+			sessionIDs = append(sessionIDs, item.ID)
 		}
 	}
+	setsBySession, err := s.store.ListMatchSetsBySessionIDs(ctx, sessionIDs)
+	if err != nil {
+		return err
+	}
+	return s.store.ReplaceRatings(ctx, userID, stats.ComputeRatings(matchSessions, setsBySession))
+}
 
-	return nil
+// updateRatings appends the rated matches added by changes when they are all
+// newer than the last rated match, and replays every match otherwise.
+func (s *Service) updateRatings(ctx context.Context, userID uuid.UUID, changes []stats.SessionChange) error {
+	added, ok := addedRatedMatches(changes)
+	if !ok {
+		return s.recomputeRatings(ctx, userID)
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	sessionIDs := make([]uuid.UUID, 0, len(added))
+	opponentIDs := make([]uuid.UUID, 0, len(added))
+	for _, item := range added {
+		sessionIDs = append(sessionIDs, item.ID)
+		opponentIDs = append(opponentIDs, *item.OpponentID)
+	}
+	prev, found, err := s.store.LoadRatings(ctx, userID, opponentIDs)
+	if err != nil {
+		return err
+	}
+	if !found || prev.Version < stats.RatingsVersion {
+		return s.recomputeRatings(ctx, userID)
+	}
+	last, found, err := s.store.LastRatingEvent(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if found {
+		for _, item := range added {
+			if !ratedAfter(item, last) {
+				return s.recomputeRatings(ctx, userID)
+			}
+		}
+	}
+
+	setsBySession, err := s.store.ListMatchSetsBySessionIDs(ctx, sessionIDs)
+	if err != nil {
+		return err
+	}
+	return s.store.AppendRatings(ctx, userID, stats.ExtendRatings(prev, added, setsBySession))
+}
+
+// addedRatedMatches returns the final state of the rated matches that changes
+// add. It reports false when changes edit or remove a match that may already
+// be rated.
+func addedRatedMatches(changes []stats.SessionChange) ([]sessions.Session, bool) {
+	inserted := make(map[uuid.UUID]bool)
+	latest := make(map[uuid.UUID]*stats.SessionState)
+	order := make([]uuid.UUID, 0)
+	for _, change := range changes {
+		var id uuid.UUID
+		switch {
+		case change.Before != nil:
+			id = change.Before.Session.ID
+			if !inserted[id] && stats.IsRatedMatch(change.Before.Session) {
+				return nil, false
+			}
+		case change.After != nil:
+			id = change.After.Session.ID
+			inserted[id] = true
+		default:
+			continue
+		}
+		if _, seen := latest[id]; !seen {
+			order = append(order, id)
+		}
+		latest[id] = change.After
+	}
+
+	added := make([]sessions.Session, 0)
+	for _, id := range order {
+		if state := latest[id]; state != nil && stats.IsRatedMatch(state.Session) {
+			added = append(added, state.Session)
+		}
+	}
+	return added, true
+}
+
+// ratedAfter matches the replay order of stats.ComputeRatings.
+func ratedAfter(item sessions.Session, last stats.RatingEvent) bool {
+	if !item.Date.Equal(last.Date) {
+		return item.Date.After(last.Date)
+	}
+	return item.ID.String() > last.SessionID.String()
+}
+
+func touchesMatches(changes []stats.SessionChange) bool {
+	for _, change := range changes {
+		for _, state := range []*stats.SessionState{change.Before, change.After} {
+			if state != nil && state.Session.IsMatch() && state.Session.OpponentID != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func touchedKeys(cal stats.Calendar, changes []stats.SessionChange) (map[string][]time.Time, []uuid.UUID) {
+	periodSets := make(map[string]map[time.Time]struct{})
+	opponentSet := make(map[uuid.UUID]struct{})
+	for _, change := range changes {
+		for _, state := range []*stats.SessionState{change.Before, change.After} {
+			if state == nil {
+				continue
+			}
+			for _, granularity := range stats.PeriodGranularities {
+				if periodSets[granularity] == nil {
+					periodSets[granularity] = make(map[time.Time]struct{})
+				}
+				periodSets[granularity][cal.PeriodStart(state.Session.Date, granularity)] = struct{}{}
+			}
+			if state.Session.OpponentID != nil {
+				opponentSet[*state.Session.OpponentID] = struct{}{}
+			}
+		}
+	}
+	periods := make(map[string][]time.Time, len(periodSets))
+	for granularity, set := range periodSets {
+		for start := range set {
+			periods[granularity] = append(periods[granularity], start)
+		}
+	}
+	opponentIDs := make([]uuid.UUID, 0, len(opponentSet))
+	for id := range opponentSet {
+		opponentIDs = append(opponentIDs, id)
+	}
+	return periods, opponentIDs
 }
 
-func computeWeeklyStats(items []sessions.Session) []stats.WeeklyStats {
-	type weeklyAccumulator struct {
+func ComputePeriodStats(cal stats.Calendar, items []sessions.Session, granularity string) []stats.PeriodStats {
+	type periodAccumulator struct {
 		sessions []sessions.Session
 		matches  []sessions.Session
 	}
-	acc := make(map[time.Time]*weeklyAccumulator)
+	acc := make(map[time.Time]*periodAccumulator)
 
 	for _, item := range items {
-		week := stats.WeekStart(item.Date)
-		if _, ok := acc[week]; !ok {
-			acc[week] = &weeklyAccumulator{}
+		start := cal.PeriodStart(item.Date, granularity)
+		if _, ok := acc[start]; !ok {
+			acc[start] = &periodAccumulator{}
 		}
-		acc[week].sessions = append(acc[week].sessions, item)
+		acc[start].sessions = append(acc[start].sessions, item)
 		if item.IsMatch() {
-			acc[week].matches = append(acc[week].matches, item)
+			acc[start].matches = append(acc[start].matches, item)
 		}
 	}
 
-	weeks := make([]time.Time, 0, len(acc))
-	for week := range acc {
-		weeks = append(weeks, week)
+	starts := make([]time.Time, 0, len(acc))
+	for start := range acc {
+		starts = append(starts, start)
 	}
-	sort.Slice(weeks, func(i, j int) bool { return weeks[i].Before(weeks[j]) })
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
 
-	rows := make([]stats.WeeklyStats, 0, len(weeks))
-	for _, week := range weeks {
-		bucket := acc[week]
-		rows = append(rows, stats.WeeklyStats{
-			WeekStartDate:   week,
-			AvgComposure:    stats.Round(stats.AverageComposure(bucket.sessions)),
-			AvgRushingIndex: stats.Round(stats.AverageRushingIndex(bucket.sessions)),
-			WinRate:         stats.Round(stats.WinRate(bucket.matches)),
-			MatchesPlayed:   len(bucket.matches),
+	rows := make([]stats.PeriodStats, 0, len(starts))
+	for _, start := range starts {
+		bucket := acc[start]
+		rows = append(rows, stats.PeriodStats{
+			PeriodStartDate:   start,
+			SessionsPlayed:    len(bucket.sessions),
+			AvgComposure:      stats.Round(stats.AverageComposure(bucket.sessions)),
+			AvgRushingIndex:   stats.Round(stats.AverageRushingIndex(bucket.sessions)),
+			WinRate:           stats.Round(stats.WinRate(bucket.matches)),
+			MatchesPlayed:     len(bucket.matches),
+			CalculatorVersion: stats.CalculatorVersion,
 		})
 	}
 	return rows
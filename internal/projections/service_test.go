@@ -2,6 +2,7 @@ package projections
 
 import (
 	"context"
+	"math"
 	"testing"
 	"time"
 
@@ -17,14 +18,72 @@ type projectionStoreMock struct {
 	upsertedUserID      uuid.UUID
 	upsertedUserStats   stats.UserStats
 	upsertedOpponent    map[uuid.UUID]stats.OpponentStats
-	replacedWeeklyUser  uuid.UUID
-	replacedWeeklyStats []stats.WeeklyStats
+	replacedPeriodUser  uuid.UUID
+	replacedPeriodStats map[string][]stats.PeriodStats
+	ratings             *stats.Ratings
+	storedRatings       *stats.Ratings
+	lastRating          *stats.RatingEvent
+	appendedRatings     *stats.Ratings
+
+	calendar          *stats.Calendar
+	accumulators      *stats.Accumulators
+	savedAccumulators *stats.Accumulators
+	appliedEvents     map[int64]bool
 }
 
-func (m *projectionStoreMock) ListSessionsByUser(_ context.Context, _ uuid.UUID, _ bool, _ int) ([]sessions.Session, error) {
+func (m *projectionStoreMock) ListActiveSessionsByUser(_ context.Context, _ uuid.UUID) ([]sessions.Session, error) {
 	return m.sessions, nil
 }
 
+func (m *projectionStoreMock) CountActiveSessions(_ context.Context, _ uuid.UUID) (int, error) {
+	return len(m.sessions), nil
+}
+
+func (m *projectionStoreMock) GetUserCalendar(_ context.Context, _ uuid.UUID) (stats.Calendar, error) {
+	if m.calendar != nil {
+		return *m.calendar, nil
+	}
+	return stats.DefaultCalendar, nil
+}
+
+func (m *projectionStoreMock) LoadAccumulators(_ context.Context, _ uuid.UUID, _ stats.Calendar, _ map[string][]time.Time, _ []uuid.UUID) (stats.Accumulators, bool, error) {
+	if m.accumulators == nil {
+		return stats.NewAccumulators(stats.DefaultCalendar), false, nil
+	}
+	return *m.accumulators, true, nil
+}
+
+func (m *projectionStoreMock) SaveAccumulators(ctx context.Context, userID uuid.UUID, acc stats.Accumulators, _ time.Time, eventIDs []int64) error {
+	m.savedAccumulators = &acc
+	m.accumulators = &acc
+	return m.MarkEventsApplied(ctx, userID, eventIDs)
+}
+
+func (m *projectionStoreMock) ReplaceAccumulators(ctx context.Context, userID uuid.UUID, acc stats.Accumulators, eventIDs []int64) error {
+	m.accumulators = &acc
+	return m.MarkEventsApplied(ctx, userID, eventIDs)
+}
+
+func (m *projectionStoreMock) AppliedEvents(_ context.Context, eventIDs []int64) (map[int64]bool, error) {
+	out := make(map[int64]bool)
+	for _, id := range eventIDs {
+		if m.appliedEvents[id] {
+			out[id] = true
+		}
+	}
+	return out, nil
+}
+
+func (m *projectionStoreMock) MarkEventsApplied(_ context.Context, _ uuid.UUID, eventIDs []int64) error {
+	if m.appliedEvents == nil {
+		m.appliedEvents = make(map[int64]bool)
+	}
+	for _, id := range eventIDs {
+		m.appliedEvents[id] = true
+	}
+	return nil
+}
+
 func (m *projectionStoreMock) ListMatchSetsBySessionIDs(_ context.Context, _ []uuid.UUID) (map[uuid.UUID][]sessions.MatchSet, error) {
 	return m.setsBySession, nil
 }
@@ -35,7 +94,7 @@ func (m *projectionStoreMock) UpsertUserStats(_ context.Context, userID uuid.UUI
 	return nil
 }
 
-func (m *projectionStoreMock) UpsertOpponentStats(_ context.Context, opponentID uuid.UUID, v stats.OpponentStats) error {
+func (m *projectionStoreMock) UpsertOpponentStats(_ context.Context, _, opponentID uuid.UUID, v stats.OpponentStats) error {
 	if m.upsertedOpponent == nil {
 		m.upsertedOpponent = make(map[uuid.UUID]stats.OpponentStats)
 	}
@@ -43,13 +102,53 @@ func (m *projectionStoreMock) UpsertOpponentStats(_ context.Context, opponentID
 	return nil
 }
 
-func (m *projectionStoreMock) ReplaceWeeklyStats(_ context.Context, userID uuid.UUID, rows []stats.WeeklyStats) error {
-	m.replacedWeeklyUser = userID
-	m.replacedWeeklyStats = rows
+func (m *projectionStoreMock) DeleteOpponentStatsExcept(_ context.Context, _ uuid.UUID, keep []uuid.UUID) error {
+	kept := make(map[uuid.UUID]bool, len(keep))
+	for _, id := range keep {
+		kept[id] = true
+	}
+	for id := range m.upsertedOpponent {
+		if !kept[id] {
+			delete(m.upsertedOpponent, id)
+		}
+	}
+	return nil
+}
+
+func (m *projectionStoreMock) ReplacePeriodStats(_ context.Context, userID uuid.UUID, granularity string, rows []stats.PeriodStats) error {
+	if m.replacedPeriodStats == nil {
+		m.replacedPeriodStats = make(map[string][]stats.PeriodStats)
+	}
+	m.replacedPeriodUser = userID
+	m.replacedPeriodStats[granularity] = rows
 	return nil
 }
 
-func TestRecomputeForUserComputesUserOpponentAndWeeklyStats(t *testing.T) {
+func (m *projectionStoreMock) ReplaceRatings(_ context.Context, _ uuid.UUID, r stats.Ratings) error {
+	m.ratings = &r
+	return nil
+}
+
+func (m *projectionStoreMock) AppendRatings(_ context.Context, _ uuid.UUID, r stats.Ratings) error {
+	m.appendedRatings = &r
+	return nil
+}
+
+func (m *projectionStoreMock) LoadRatings(_ context.Context, _ uuid.UUID, _ []uuid.UUID) (stats.Ratings, bool, error) {
+	if m.storedRatings == nil {
+		return stats.Ratings{}, false, nil
+	}
+	return *m.storedRatings, true, nil
+}
+
+func (m *projectionStoreMock) LastRatingEvent(_ context.Context, _ uuid.UUID) (stats.RatingEvent, bool, error) {
+	if m.lastRating == nil {
+		return stats.RatingEvent{}, false, nil
+	}
+	return *m.lastRating, true, nil
+}
+
+func TestRecomputeForUserComputesUserOpponentAndPeriodStats(t *testing.T) {
 	userID := uuid.New()
 	opponentID := uuid.New()
 	win := true
@@ -128,10 +227,287 @@ func TestRecomputeForUserComputesUserOpponentAndWeeklyStats(t *testing.T) {
 		t.Fatalf("expected avg set differential -0.5, got %.4f", opponentStats.AvgSetDifferential)
 	}
 
-	if mock.replacedWeeklyUser != userID {
-		t.Fatalf("expected weekly stats user id to match")
+	if mock.replacedPeriodUser != userID {
+		t.Fatalf("expected period stats user id to match")
+	}
+	if got := len(mock.replacedPeriodStats[stats.PeriodWeek]); got != 3 {
+		t.Fatalf("expected 3 weekly buckets, got %d", got)
+	}
+	months := mock.replacedPeriodStats[stats.PeriodMonth]
+	if len(months) != 1 || months[0].SessionsPlayed != 3 || months[0].MatchesPlayed != 2 {
+		t.Fatalf("expected one monthly bucket with 3 sessions and 2 matches, got %+v", months)
+	}
+	if got := len(mock.replacedPeriodStats[stats.PeriodYear]); got != 1 {
+		t.Fatalf("expected 1 yearly bucket, got %d", got)
+	}
+
+	if mock.ratings == nil || mock.ratings.Player.Matches != 2 || len(mock.ratings.History) != 2 {
+		t.Fatalf("expected ratings from both matches, got %+v", mock.ratings)
+	}
+	if _, ok := mock.ratings.Opponents[opponentID]; !ok {
+		t.Fatalf("expected an opponent rating")
+	}
+}
+
+func TestRecomputeDropsOpponentsWithoutMatches(t *testing.T) {
+	userID := uuid.New()
+	staleID := uuid.New()
+	mock := &projectionStoreMock{
+		upsertedOpponent: map[uuid.UUID]stats.OpponentStats{staleID: {MatchesPlayed: 3}},
+	}
+
+	svc := NewService(mock)
+	if err := svc.RecomputeForUser(context.Background(), userID); err != nil {
+		t.Fatalf("recompute failed: %v", err)
+	}
+	if _, ok := mock.upsertedOpponent[staleID]; ok {
+		t.Fatalf("expected stale opponent stats to be removed")
+	}
+}
+
+func TestRecomputeBucketsPeriodsInUserCalendar(t *testing.T) {
+	userID := uuid.New()
+	cal, err := stats.NewCalendar("America/Sao_Paulo", time.Sunday)
+	if err != nil {
+		t.Fatalf("calendar: %v", err)
+	}
+	// Saturday 2026-02-28 at 22:00 local, which is Sunday 2026-03-01 in UTC.
+	session := sessions.Session{ID: uuid.New(), UserID: userID, SessionType: "class", Date: time.Date(2026, 3, 1, 1, 0, 0, 0, time.UTC), DurationMinutes: 60, Composure: 6}
+	mock := &projectionStoreMock{sessions: []sessions.Session{session}, calendar: &cal}
+
+	if err := NewService(mock).RecomputeForUser(context.Background(), userID); err != nil {
+		t.Fatalf("recompute failed: %v", err)
+	}
+	weeks := mock.replacedPeriodStats[stats.PeriodWeek]
+	if len(weeks) != 1 || !weeks[0].PeriodStartDate.Equal(time.Date(2026, 2, 22, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the local week of 2026-02-22, got %+v", weeks)
+	}
+	months := mock.replacedPeriodStats[stats.PeriodMonth]
+	if len(months) != 1 || !months[0].PeriodStartDate.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the local month of 2026-02, got %+v", months)
+	}
+}
+
+func TestApplyEventsFallsBackToRebuildWithoutAccumulators(t *testing.T) {
+	userID := uuid.New()
+	session := sessions.Session{ID: uuid.New(), UserID: userID, SessionType: "class", Date: time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC), DurationMinutes: 60, Composure: 6}
+	mock := &projectionStoreMock{sessions: []sessions.Session{session}}
+
+	svc := NewService(mock)
+	batch := []SessionsChanged{{UserID: userID, Changes: []stats.SessionChange{{After: &stats.SessionState{Session: session}}}}}
+	if err := svc.ApplyEvents(context.Background(), userID, batch); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if mock.upsertedUserStats.TotalSessions != 1 {
+		t.Fatalf("expected full rebuild to upsert user stats, got %+v", mock.upsertedUserStats)
+	}
+	if mock.accumulators == nil || mock.accumulators.User.Sessions != 1 {
+		t.Fatalf("expected rebuild to reset accumulators")
+	}
+	if mock.savedAccumulators != nil {
+		t.Fatalf("rebuild must not also save a delta")
+	}
+}
+
+func TestApplyEventsAdjustsAccumulatorsAndSkipsRedelivery(t *testing.T) {
+	userID := uuid.New()
+	opponentID := uuid.New()
+	win := true
+	base := time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC)
+	existing := sessions.Session{ID: uuid.New(), UserID: userID, SessionType: "class", Date: base, DurationMinutes: 60, Composure: 6}
+	added := sessions.Session{ID: uuid.New(), UserID: userID, OpponentID: &opponentID, SessionType: "match", Date: base.AddDate(0, 0, 1), DurationMinutes: 60, Composure: 8, IsMatchWin: &win}
+
+	acc := stats.BuildAccumulators(stats.DefaultCalendar, []sessions.Session{existing}, nil)
+	mock := &projectionStoreMock{sessions: []sessions.Session{existing, added}, accumulators: &acc}
+
+	svc := NewService(mock)
+	event := SessionsChanged{
+		UserID:  userID,
+		Changes: []stats.SessionChange{{After: &stats.SessionState{Session: added, SetDifferential: 2}}},
+		EventID: 7,
+	}
+	if err := svc.ApplyEvents(context.Background(), userID, []SessionsChanged{event}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if mock.savedAccumulators == nil {
+		t.Fatalf("expected accumulators to be saved incrementally")
+	}
+	if mock.upsertedUserID != uuid.Nil {
+		t.Fatalf("incremental path must not run a full rebuild")
+	}
+	got := mock.savedAccumulators
+	if got.User.Sessions != 2 || got.User.Matches != 1 || got.User.Wins != 1 {
+		t.Fatalf("unexpected user accumulator: %+v", got.User)
+	}
+	if got.Opponents[opponentID].SetDiffSum != 2 {
+		t.Fatalf("unexpected opponent accumulator: %+v", got.Opponents[opponentID])
+	}
+	if mock.ratings == nil || mock.ratings.Player.Matches != 1 {
+		t.Fatalf("expected a new match to recompute ratings, got %+v", mock.ratings)
+	}
+
+	mock.savedAccumulators = nil
+	if err := svc.ApplyEvents(context.Background(), userID, []SessionsChanged{event}); err != nil {
+		t.Fatalf("redelivery failed: %v", err)
+	}
+	if mock.savedAccumulators != nil || mock.accumulators.User.Sessions != 2 {
+		t.Fatalf("expected redelivered event to be skipped")
+	}
+}
+
+func TestApplyEventsLeavesRatingsWithoutMatchChanges(t *testing.T) {
+	userID := uuid.New()
+	base := time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC)
+	existing := sessions.Session{ID: uuid.New(), UserID: userID, SessionType: "class", Date: base, DurationMinutes: 60, Composure: 6}
+	added := sessions.Session{ID: uuid.New(), UserID: userID, SessionType: "class", Date: base.AddDate(0, 0, 1), DurationMinutes: 60, Composure: 7}
+
+	acc := stats.BuildAccumulators(stats.DefaultCalendar, []sessions.Session{existing}, nil)
+	mock := &projectionStoreMock{sessions: []sessions.Session{existing, added}, accumulators: &acc}
+	batch := []SessionsChanged{{UserID: userID, Changes: []stats.SessionChange{{After: &stats.SessionState{Session: added}}}}}
+	if err := NewService(mock).ApplyEvents(context.Background(), userID, batch); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if mock.savedAccumulators == nil || mock.ratings != nil {
+		t.Fatalf("expected a class session to leave ratings alone")
+	}
+}
+
+func TestApplyEventsRebuildsWhenCountsDrift(t *testing.T) {
+	userID := uuid.New()
+	session := sessions.Session{ID: uuid.New(), UserID: userID, SessionType: "class", Date: time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC), DurationMinutes: 60, Composure: 6}
+	acc := stats.NewAccumulators(stats.DefaultCalendar)
+	mock := &projectionStoreMock{sessions: []sessions.Session{session, session}, accumulators: &acc}
+
+	svc := NewService(mock)
+	batch := []SessionsChanged{{UserID: userID, Changes: []stats.SessionChange{{After: &stats.SessionState{Session: session}}}}}
+	if err := svc.ApplyEvents(context.Background(), userID, batch); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if mock.savedAccumulators != nil || mock.upsertedUserStats.TotalSessions != 2 {
+		t.Fatalf("expected drifted accumulators to trigger a full rebuild")
+	}
+}
+
+func TestRecomputeForUserRunsUnderLock(t *testing.T) {
+	userID := uuid.New()
+	locked := &projectionStoreMock{}
+	var lockedUser uuid.UUID
+
+	svc := NewService(&projectionStoreMock{}).WithLock(func(_ context.Context, id uuid.UUID, fn func(Store) error) error {
+		lockedUser = id
+		return fn(locked)
+	})
+	if err := svc.RecomputeForUser(context.Background(), userID); err != nil {
+		t.Fatalf("recompute failed: %v", err)
+	}
+	if lockedUser != userID {
+		t.Fatalf("expected lock to be taken for the user")
+	}
+	if locked.upsertedUserID != userID {
+		t.Fatalf("expected writes to go through the locked store")
+	}
+}
+
+func TestApplyEventsRebuildsAccumulatorsFromOlderCalculator(t *testing.T) {
+	userID := uuid.New()
+	session := sessions.Session{ID: uuid.New(), UserID: userID, SessionType: "class", Date: time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC), DurationMinutes: 60, Composure: 6}
+	acc := stats.NewAccumulators(stats.DefaultCalendar)
+	acc.Version = stats.CalculatorVersion - 1
+	mock := &projectionStoreMock{sessions: []sessions.Session{session}, accumulators: &acc}
+
+	batch := []SessionsChanged{{UserID: userID, Changes: []stats.SessionChange{{After: &stats.SessionState{Session: session}}}}}
+	if err := NewService(mock).ApplyEvents(context.Background(), userID, batch); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if mock.savedAccumulators != nil || mock.upsertedUserStats.CalculatorVersion != stats.CalculatorVersion {
+		t.Fatalf("expected outdated accumulators to trigger a rebuild")
+	}
+}
+
+func TestApplyEventsAppendsNewerMatchesToRatings(t *testing.T) {
+	userID := uuid.New()
+	opponentID := uuid.New()
+	win, loss := true, false
+	base := time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC)
+	first := sessions.Session{ID: uuid.New(), UserID: userID, OpponentID: &opponentID, SessionType: "match", Date: base, DurationMinutes: 60, Composure: 6, IsMatchWin: &loss}
+	added := sessions.Session{ID: uuid.New(), UserID: userID, OpponentID: &opponentID, SessionType: "match", Date: base.AddDate(0, 0, 1), DurationMinutes: 60, Composure: 8, IsMatchWin: &win}
+	earlier := added
+	earlier.ID, earlier.Date = uuid.New(), base.AddDate(0, 0, -1)
+
+	replayed := stats.ComputeRatings([]sessions.Session{first, added}, nil)
+	for _, tc := range []struct {
+		name   string
+		item   sessions.Session
+		append bool
+	}{
+		{name: "newer", item: added, append: true},
+		{name: "older", item: earlier, append: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stored := stats.ComputeRatings([]sessions.Session{first}, nil)
+			acc := stats.BuildAccumulators(stats.DefaultCalendar, []sessions.Session{first}, nil)
+			mock := &projectionStoreMock{
+				sessions:      []sessions.Session{first, tc.item},
+				accumulators:  &acc,
+				storedRatings: &stored,
+				lastRating:    &stored.History[0],
+			}
+			batch := []SessionsChanged{{UserID: userID, Changes: []stats.SessionChange{{After: &stats.SessionState{Session: tc.item}}}}}
+			if err := NewService(mock).ApplyEvents(context.Background(), userID, batch); err != nil {
+				t.Fatalf("apply failed: %v", err)
+			}
+			if !tc.append {
+				if mock.appendedRatings != nil || mock.ratings == nil || mock.ratings.Player.Matches != 2 {
+					t.Fatalf("expected an older match to replay every match, got %+v", mock.ratings)
+				}
+				return
+			}
+			got := mock.appendedRatings
+			if mock.ratings != nil || got == nil || len(got.History) != 1 || got.History[0].SessionID != added.ID {
+				t.Fatalf("expected only the new match to be appended, got %+v", got)
+			}
+			if got.Player.Matches != 2 || math.Abs(got.Player.Rating-replayed.Player.Rating) > 0.01 {
+				t.Fatalf("expected the appended rating to match a replay, got %+v want %+v", got.Player, replayed.Player)
+			}
+			if *got.StrengthAdjustedWinRate != *replayed.StrengthAdjustedWinRate {
+				t.Fatalf("expected adjusted win rate %v, got %v", *replayed.StrengthAdjustedWinRate, *got.StrengthAdjustedWinRate)
+			}
+		})
+	}
+}
+
+type outdatedStoreMock []uuid.UUID
+
+func (m outdatedStoreMock) ListOutdatedProjectionUsers(_ context.Context, _ int) ([]uuid.UUID, error) {
+	return m, nil
+}
+
+func (m outdatedStoreMock) ListOutdatedRatingUsers(_ context.Context, _ int) ([]uuid.UUID, error) {
+	return m, nil
+}
+
+func TestRebuildOutdatedRatingsLeavesOtherProjections(t *testing.T) {
+	mock := &projectionStoreMock{}
+	rebuilt, err := NewService(mock).RebuildOutdatedRatings(context.Background(), outdatedStoreMock{uuid.New()})
+	if err != nil {
+		t.Fatalf("rebuild failed: %v", err)
+	}
+	if rebuilt != 1 || mock.ratings == nil || mock.ratings.Version != stats.RatingsVersion {
+		t.Fatalf("expected ratings to be rebuilt, got %d and %+v", rebuilt, mock.ratings)
+	}
+	if mock.upsertedUserID != uuid.Nil || mock.savedAccumulators != nil {
+		t.Fatalf("expected a ratings backfill to leave other projections alone")
+	}
+}
+
+func TestRebuildOutdatedRecomputesListedUsers(t *testing.T) {
+	userID := uuid.New()
+	mock := &projectionStoreMock{}
+	rebuilt, err := NewService(mock).RebuildOutdated(context.Background(), outdatedStoreMock{userID})
+	if err != nil {
+		t.Fatalf("rebuild failed: %v", err)
 	}
-	if len(mock.replacedWeeklyStats) != 3 {
-		t.Fatalf("expected 3 weekly buckets, got %d", len(mock.replacedWeeklyStats))
+	if rebuilt != 1 || mock.upsertedUserID != userID {
+		t.Fatalf("expected user %s to be rebuilt, got %d rebuilt for %s", userID, rebuilt, mock.upsertedUserID)
 	}
 }
@@ -0,0 +1,100 @@
+package projections
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/stats"
+)
+
+// SnapshotStore reads the stored projections of a user.
+type SnapshotStore interface {
+	GetUserStats(ctx context.Context, userID uuid.UUID) (stats.UserStats, error)
+	ListOpponentStatsByUser(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]stats.OpponentStats, error)
+	ListPeriodStats(ctx context.Context, userID uuid.UUID, granularity string, from, to *time.Time) ([]stats.PeriodStats, error)
+}
+
+// Snapshot is every projection row of one user at a point in time.
+type Snapshot struct {
+	User      stats.UserStats
+	Opponents map[uuid.UUID]stats.OpponentStats
+	Periods   map[string]map[time.Time]stats.PeriodStats
+}
+
+func TakeSnapshot(ctx context.Context, store SnapshotStore, userID uuid.UUID) (Snapshot, error) {
+	var snap Snapshot
+	var err error
+	if snap.User, err = store.GetUserStats(ctx, userID); err != nil {
+		return snap, err
+	}
+	if snap.Opponents, err = store.ListOpponentStatsByUser(ctx, userID); err != nil {
+		return snap, err
+	}
+	snap.Periods = make(map[string]map[time.Time]stats.PeriodStats, len(stats.PeriodGranularities))
+	for _, granularity := range stats.PeriodGranularities {
+		rows, err := store.ListPeriodStats(ctx, userID, granularity, nil, nil)
+		if err != nil {
+			return snap, err
+		}
+		byStart := make(map[time.Time]stats.PeriodStats, len(rows))
+		for _, row := range rows {
+			byStart[row.PeriodStartDate] = row
+		}
+		snap.Periods[granularity] = byStart
+	}
+	return snap, nil
+}
+
+// DiffSnapshots lists the rows that differ between before and after, ordered
+// by scope and key. Calculation timestamps are ignored.
+func DiffSnapshots(before, after Snapshot) []stats.ProjectionChange {
+	out := make([]stats.ProjectionChange, 0)
+	if delta := stats.DiffUserStats(before.User, after.User); len(delta) > 0 {
+		out = append(out, stats.ProjectionChange{Scope: "user", Kind: stats.ChangeUpdated, Delta: delta})
+	}
+
+	opponentChanges := make([]stats.ProjectionChange, 0)
+	for id, b := range before.Opponents {
+		a, ok := after.Opponents[id]
+		if !ok {
+			opponentChanges = append(opponentChanges, stats.ProjectionChange{Scope: "opponent", Key: id.String(), Kind: stats.ChangeRemoved})
+			continue
+		}
+		if delta := stats.DiffOpponentStats(b, a); len(delta) > 0 {
+			opponentChanges = append(opponentChanges, stats.ProjectionChange{Scope: "opponent", Key: id.String(), Kind: stats.ChangeUpdated, Delta: delta})
+		}
+	}
+	for id := range after.Opponents {
+		if _, ok := before.Opponents[id]; !ok {
+			opponentChanges = append(opponentChanges, stats.ProjectionChange{Scope: "opponent", Key: id.String(), Kind: stats.ChangeAdded})
+		}
+	}
+	sort.Slice(opponentChanges, func(i, j int) bool { return opponentChanges[i].Key < opponentChanges[j].Key })
+	out = append(out, opponentChanges...)
+
+	for _, granularity := range stats.PeriodGranularities {
+		b, a := before.Periods[granularity], after.Periods[granularity]
+		periodChanges := make([]stats.ProjectionChange, 0)
+		for start, row := range b {
+			key := start.Format(time.DateOnly)
+			next, ok := a[start]
+			if !ok {
+				periodChanges = append(periodChanges, stats.ProjectionChange{Scope: granularity, Key: key, Kind: stats.ChangeRemoved})
+				continue
+			}
+			if delta := stats.DiffPeriodStats(row, next); len(delta) > 0 {
+				periodChanges = append(periodChanges, stats.ProjectionChange{Scope: granularity, Key: key, Kind: stats.ChangeUpdated, Delta: delta})
+			}
+		}
+		for start := range a {
+			if _, ok := b[start]; !ok {
+				periodChanges = append(periodChanges, stats.ProjectionChange{Scope: granularity, Key: start.Format(time.DateOnly), Kind: stats.ChangeAdded})
+			}
+		}
+		sort.Slice(periodChanges, func(i, j int) bool { return periodChanges[i].Key < periodChanges[j].Key })
+		out = append(out, periodChanges...)
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package projections
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/stats"
+)
+
+func TestDiffSnapshotsReportsUpdatedAddedAndRemovedRows(t *testing.T) {
+	kept, dropped, added := uuid.New(), uuid.New(), uuid.New()
+	week := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	nextWeek := week.AddDate(0, 0, 7)
+
+	before := Snapshot{
+		User: stats.UserStats{TotalSessions: 4, WinRate: 0.5, LastCalculatedAt: time.Now()},
+		Opponents: map[uuid.UUID]stats.OpponentStats{
+			kept:    {MatchesPlayed: 2, WinRate: 0.5},
+			dropped: {MatchesPlayed: 1},
+		},
+		Periods: map[string]map[time.Time]stats.PeriodStats{
+			stats.PeriodWeek: {week: {PeriodStartDate: week, SessionsPlayed: 4, AvgComposure: 6}},
+		},
+	}
+	after := Snapshot{
+		User: stats.UserStats{TotalSessions: 4, WinRate: 0.5, LastCalculatedAt: time.Now().Add(time.Minute)},
+		Opponents: map[uuid.UUID]stats.OpponentStats{
+			kept:  {MatchesPlayed: 2, WinRate: 0.5, AvgSetDifferential: 1.5},
+			added: {MatchesPlayed: 1},
+		},
+		Periods: map[string]map[time.Time]stats.PeriodStats{
+			stats.PeriodWeek: {
+				week:     {PeriodStartDate: week, SessionsPlayed: 4, AvgComposure: 6},
+				nextWeek: {PeriodStartDate: nextWeek, SessionsPlayed: 1},
+			},
+		},
+	}
+
+	changes := DiffSnapshots(before, after)
+	kinds := make(map[string]string, len(changes))
+	for _, change := range changes {
+		if change.Scope == "user" {
+			t.Fatalf("expected unchanged user stats to be skipped, got %+v", change)
+		}
+		kinds[change.Key] = change.Kind
+	}
+	want := map[string]string{
+		kept.String():                  stats.ChangeUpdated,
+		dropped.String():               stats.ChangeRemoved,
+		added.String():                 stats.ChangeAdded,
+		nextWeek.Format(time.DateOnly): stats.ChangeAdded,
+	}
+	if len(kinds) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), changes)
+	}
+	for key, kind := range want {
+		if kinds[key] != kind {
+			t.Fatalf("%s: expected %s, got %q", key, kind, kinds[key])
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package projections
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/stats"
+	"github.com/lutefd/baseline-api/internal/events"
+)
+
+// EventSessionsChanged is recorded in the outbox whenever a write commits
+// sessions or match sets.
+const EventSessionsChanged = "SessionsChanged"
+
+// SessionsChanged is the payload of EventSessionsChanged. Rebuild asks for a
+// full recompute when the writer could not describe its changes.
+type SessionsChanged struct {
+	UserID  uuid.UUID             `json:"userId"`
+	Changes []stats.SessionChange `json:"changes,omitempty"`
+	Rebuild bool                  `json:"rebuild,omitempty"`
+	// EventID is the outbox ID the event was delivered from, used to skip
+	// redeliveries. It is zero for events that never went through the outbox.
+	EventID int64 `json:"-"`
+}
+
+// Worker applies projection updates off the request path. Events for the same
+// user are debounced: they are folded into one update that runs once no new
+// event has arrived for the debounce interval, or after maxDelay at the latest.
+// Up to size users are updated at once; a user's updates never overlap.
+type Worker struct {
+	svc      *Service
+	debounce time.Duration
+	maxDelay time.Duration
+	size     int
+	ready    chan uuid.UUID
+	done     chan struct{}
+
+	mu      sync.Mutex
+	pending map[uuid.UUID]*pendingUpdate
+}
+
+type pendingUpdate struct {
+	events  []SessionsChanged
+	waiters []chan error
+	first   time.Time
+	timer   *time.Timer
+	running bool
+	// due is set when the timer fires while an update is running; the
+	// queued events are picked up once it finishes.
+	due bool
+}
+
+func NewWorker(svc *Service, debounce, maxDelay time.Duration, size int) *Worker {
+	if maxDelay < debounce {
+		maxDelay = debounce
+	}
+	if size < 1 {
+		size = 1
+	}
+	return &Worker{
+		svc:      svc,
+		debounce: debounce,
+		maxDelay: maxDelay,
+		size:     size,
+		ready:    make(chan uuid.UUID, 64),
+		done:     make(chan struct{}),
+		pending:  make(map[uuid.UUID]*pendingUpdate),
+	}
+}
+
+// Handle is the events.Handler for EventSessionsChanged. It queues the event
+// and returns once the debounced update that includes it has been applied, so
+// an outbox dispatcher only acknowledges events whose effect is stored.
+func (w *Worker) Handle(ctx context.Context, e events.Event) error {
+	payload, ok := e.Payload.(SessionsChanged)
+	if !ok {
+		return fmt.Errorf("unexpected %s payload %T", e.Name, e.Payload)
+	}
+	payload.EventID = e.ID
+
+	result := make(chan error, 1)
+	w.enqueue(payload, result)
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pending reports whether the user has projection updates queued or running,
+// meaning the stored projections may not reflect the latest writes yet.
+func (w *Worker) Pending(userID uuid.UUID) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.pending[userID]
+	return ok
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	defer close(w.done)
+	var wg sync.WaitGroup
+	for range w.size {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case userID := <-w.ready:
+					w.process(ctx, userID)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *Worker) enqueue(e SessionsChanged, result chan error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	p, ok := w.pending[e.UserID]
+	if !ok {
+		p = &pendingUpdate{}
+		w.pending[e.UserID] = p
+	}
+	p.events = append(p.events, e)
+	p.waiters = append(p.waiters, result)
+	w.schedule(e.UserID, p)
+}
+
+// schedule arms or extends the debounce timer. Callers hold w.mu.
+func (w *Worker) schedule(userID uuid.UUID, p *pendingUpdate) {
+	if p.timer == nil {
+		p.first = time.Now()
+		p.timer = time.AfterFunc(w.debounce, func() { w.fire(userID) })
+		return
+	}
+	if time.Since(p.first)+w.debounce <= w.maxDelay {
+		p.timer.Reset(w.debounce)
+	}
+}
+
+func (w *Worker) fire(userID uuid.UUID) {
+	select {
+	case w.ready <- userID:
+	case <-w.done:
+	}
+}
+
+func (w *Worker) process(ctx context.Context, userID uuid.UUID) {
+	w.mu.Lock()
+	p, ok := w.pending[userID]
+	if !ok || len(p.events) == 0 {
+		w.mu.Unlock()
+		return
+	}
+	if p.running {
+		p.due = true
+		w.mu.Unlock()
+		return
+	}
+	batch, waiters := p.events, p.waiters
+	p.events, p.waiters, p.timer = nil, nil, nil
+	p.running = true
+	w.mu.Unlock()
+
+	err := w.svc.ApplyEvents(ctx, userID, batch)
+	if err != nil {
+		log.Printf("projection update for user %s failed: %v", userID, err)
+	}
+
+	w.mu.Lock()
+	p.running = false
+	requeue := p.due
+	p.due = false
+	if len(p.events) == 0 && p.timer == nil {
+		delete(w.pending, userID)
+	}
+	w.mu.Unlock()
+	if requeue {
+		go w.fire(userID)
+	}
+
+	for _, waiter := range waiters {
+		waiter <- err
+	}
+}
@@ -0,0 +1,105 @@
+package projections
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+	"github.com/lutefd/baseline-api/internal/domain/stats"
+	"github.com/lutefd/baseline-api/internal/events"
+)
+
+func TestWorkerDebouncesEventsPerUser(t *testing.T) {
+	userID := uuid.New()
+	base := time.Date(2026, 2, 2, 0, 0, 0, 0, time.UTC)
+	first := sessions.Session{ID: uuid.New(), UserID: userID, SessionType: "class", Date: base, DurationMinutes: 60, Composure: 6}
+	second := sessions.Session{ID: uuid.New(), UserID: userID, SessionType: "class", Date: base.AddDate(0, 0, 1), DurationMinutes: 60, Composure: 8}
+
+	acc := stats.NewAccumulators(stats.DefaultCalendar)
+	mock := &projectionStoreMock{sessions: []sessions.Session{first, second}, accumulators: &acc}
+	worker := NewWorker(NewService(mock), 20*time.Millisecond, time.Second, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Run(ctx)
+
+	errs := make(chan error, 2)
+	for i, item := range []sessions.Session{first, second} {
+		event := events.Event{ID: int64(i + 1), Name: EventSessionsChanged, Payload: SessionsChanged{
+			UserID:  userID,
+			Changes: []stats.SessionChange{{After: &stats.SessionState{Session: item}}},
+		}}
+		go func() { errs <- worker.Handle(ctx, event) }()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for !worker.Pending(userID) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatalf("handle failed: %v", err)
+		}
+	}
+	if worker.Pending(userID) {
+		t.Fatalf("expected pending update to be applied once Handle returns")
+	}
+	if mock.savedAccumulators == nil || mock.savedAccumulators.User.Sessions != 2 {
+		t.Fatalf("expected both changes to be applied in one update, got %+v", mock.savedAccumulators)
+	}
+	if !mock.appliedEvents[1] || !mock.appliedEvents[2] {
+		t.Fatalf("expected both event IDs to be recorded as applied")
+	}
+}
+
+func TestWorkerRejectsUnknownPayload(t *testing.T) {
+	worker := NewWorker(NewService(&projectionStoreMock{}), time.Millisecond, time.Millisecond, 1)
+	if err := worker.Handle(context.Background(), events.Event{Name: EventSessionsChanged, Payload: "bad"}); err == nil {
+		t.Fatalf("expected error for unexpected payload")
+	}
+}
+
+func TestWorkerSlowUserDoesNotBlockOthers(t *testing.T) {
+	slow, fast := uuid.New(), uuid.New()
+	release := make(chan struct{})
+	lock := func(ctx context.Context, userID uuid.UUID, fn func(Store) error) error {
+		if userID == slow {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return fn(&projectionStoreMock{})
+	}
+	worker := NewWorker(NewService(&projectionStoreMock{}).WithLock(lock), time.Millisecond, time.Millisecond, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Run(ctx)
+
+	slowDone := make(chan error, 1)
+	go func() {
+		slowDone <- worker.Handle(ctx, events.Event{Name: EventSessionsChanged, Payload: SessionsChanged{UserID: slow}})
+	}()
+
+	fastDone := make(chan error, 1)
+	go func() {
+		fastDone <- worker.Handle(ctx, events.Event{Name: EventSessionsChanged, Payload: SessionsChanged{UserID: fast}})
+	}()
+	select {
+	case err := <-fastDone:
+		if err != nil {
+			t.Fatalf("handle failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected another user's update to finish while the slow one runs")
+	}
+
+	close(release)
+	if err := <-slowDone; err != nil {
+		t.Fatalf("handle failed: %v", err)
+	}
+}
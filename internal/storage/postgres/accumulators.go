@@ -0,0 +1,350 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+	"github.com/lutefd/baseline-api/internal/domain/stats"
+)
+
+const (
+	accumulatorScopeUser     = "user"
+	accumulatorScopeOpponent = "opponent"
+)
+
+// periodKeyLayouts formats period accumulator keys; the scope of a period
+// accumulator is its granularity.
+var periodKeyLayouts = map[string]string{
+	stats.PeriodWeek:  "2006-01-02",
+	stats.PeriodMonth: "2006-01",
+	stats.PeriodYear:  "2006",
+}
+
+// ListActiveSessionsByUser returns every live session of the user, without the
+// page limit applied by ListSessionsByUser, for full projection rebuilds.
+func (s *Store) ListActiveSessionsByUser(ctx context.Context, userID uuid.UUID) ([]sessions.Session, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, user_id, opponent_id, session_name, session_type, date, duration_minutes,
+		       rushed_shots, unforced_errors, long_rallies, direction_changes, composure,
+		       focus_text, followed_focus, is_match_win, notes, created_at, updated_at, deleted_at
+		FROM sessions
+		WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY date DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]sessions.Session, 0)
+	for rows.Next() {
+		var v sessions.Session
+		if err := rows.Scan(
+			&v.ID, &v.UserID, &v.OpponentID, &v.SessionName, &v.SessionType, &v.Date, &v.DurationMinutes,
+			&v.RushedShots, &v.UnforcedErrors, &v.LongRallies, &v.DirectionChanges, &v.Composure,
+			&v.FocusText, &v.FollowedFocus, &v.IsMatchWin, &v.Notes, &v.CreatedAt, &v.UpdatedAt, &v.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) CountActiveSessions(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := s.db.QueryRow(ctx, `
+		SELECT count(*) FROM sessions WHERE user_id = $1 AND deleted_at IS NULL
+	`, userID).Scan(&count)
+	return count, err
+}
+
+// GetSessionStates loads the listed sessions of the user together with the
+// set differential of their live match sets. Missing IDs are absent from the map.
+func (s *Store) GetSessionStates(ctx context.Context, userID uuid.UUID, sessionIDs []uuid.UUID) (map[uuid.UUID]stats.SessionState, error) {
+	result := make(map[uuid.UUID]stats.SessionState)
+	if len(sessionIDs) == 0 {
+		return result, nil
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT s.id, s.user_id, s.opponent_id, s.session_name, s.session_type, s.date, s.duration_minutes,
+		       s.rushed_shots, s.unforced_errors, s.long_rallies, s.direction_changes, s.composure,
+		       s.focus_text, s.followed_focus, s.is_match_win, s.notes, s.created_at, s.updated_at, s.deleted_at,
+		       COALESCE((
+		           SELECT sum(m.player_games - m.opponent_games)
+		           FROM match_sets m
+		           WHERE m.session_id = s.id AND m.deleted_at IS NULL
+		       ), 0)
+		FROM sessions s
+		WHERE s.user_id = $1 AND s.id = ANY($2)
+	`, userID, sessionIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var state stats.SessionState
+		v := &state.Session
+		if err := rows.Scan(
+			&v.ID, &v.UserID, &v.OpponentID, &v.SessionName, &v.SessionType, &v.Date, &v.DurationMinutes,
+			&v.RushedShots, &v.UnforcedErrors, &v.LongRallies, &v.DirectionChanges, &v.Composure,
+			&v.FocusText, &v.FollowedFocus, &v.IsMatchWin, &v.Notes, &v.CreatedAt, &v.UpdatedAt, &v.DeletedAt,
+			&state.SetDifferential,
+		); err != nil {
+			return nil, err
+		}
+		result[v.ID] = state
+	}
+	return result, rows.Err()
+}
+
+func (s *Store) GetMatchSetSessionID(ctx context.Context, matchSetID uuid.UUID) (uuid.UUID, bool, error) {
+	var sessionID uuid.UUID
+	err := s.db.QueryRow(ctx, `SELECT session_id FROM match_sets WHERE id = $1`, matchSetID).Scan(&sessionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, false, nil
+		}
+		return uuid.Nil, false, err
+	}
+	return sessionID, true, nil
+}
+
+// LoadAccumulators reads the user accumulator plus the listed period and
+// opponent accumulators, with periods keyed by granularity in cal. The boolean
+// is false when the user has never been rebuilt, in which case the caller must
+// fall back to a full recompute.
+func (s *Store) LoadAccumulators(ctx context.Context, userID uuid.UUID, cal stats.Calendar, periods map[string][]time.Time, opponentIDs []uuid.UUID) (stats.Accumulators, bool, error) {
+	acc := stats.NewAccumulators(cal)
+
+	scopes := []string{accumulatorScopeUser}
+	keys := []string{""}
+	for granularity, starts := range periods {
+		layout, ok := periodKeyLayouts[granularity]
+		if !ok {
+			return acc, false, fmt.Errorf("unknown period granularity %q", granularity)
+		}
+		for _, start := range starts {
+			scopes = append(scopes, granularity)
+			keys = append(keys, start.Format(layout))
+		}
+	}
+	for _, id := range opponentIDs {
+		scopes = append(scopes, accumulatorScopeOpponent)
+		keys = append(keys, id.String())
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT a.scope, a.scope_key, a.state, a.calculator_version
+		FROM projection_accumulators a
+		JOIN unnest($2::text[], $3::text[]) AS k(scope, scope_key)
+		  ON a.scope = k.scope AND a.scope_key = k.scope_key
+		WHERE a.user_id = $1
+	`, userID, scopes, keys)
+	if err != nil {
+		return acc, false, err
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		var scope, key string
+		var state []byte
+		var version int
+		if err := rows.Scan(&scope, &key, &state, &version); err != nil {
+			return acc, false, err
+		}
+		switch scope {
+		case accumulatorScopeUser:
+			if err := json.Unmarshal(state, &acc.User); err != nil {
+				return acc, false, err
+			}
+			acc.Version = version
+			found = true
+		case accumulatorScopeOpponent:
+			id, err := uuid.Parse(key)
+			if err != nil {
+				return acc, false, err
+			}
+			var v stats.OpponentAccumulator
+			if err := json.Unmarshal(state, &v); err != nil {
+				return acc, false, err
+			}
+			acc.Opponents[id] = v
+		default:
+			layout, ok := periodKeyLayouts[scope]
+			if !ok {
+				continue
+			}
+			start, err := time.Parse(layout, key)
+			if err != nil {
+				return acc, false, err
+			}
+			var v stats.PeriodAccumulator
+			if err := json.Unmarshal(state, &v); err != nil {
+				return acc, false, err
+			}
+			acc.Periods(scope)[start] = v
+		}
+	}
+	return acc, found, rows.Err()
+}
+
+// SaveAccumulators writes the given accumulators, the projection rows derived
+// from them and the applied event IDs in one transaction. Only the periods and
+// opponents present in acc are touched; periods and opponents left without
+// sessions have their projection rows removed.
+func (s *Store) SaveAccumulators(ctx context.Context, userID uuid.UUID, acc stats.Accumulators, now time.Time, eventIDs []int64) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	txStore := &Store{pool: s.pool, db: tx}
+	if err := txStore.writeAccumulators(ctx, userID, acc); err != nil {
+		return err
+	}
+	if err := txStore.MarkEventsApplied(ctx, userID, eventIDs); err != nil {
+		return err
+	}
+	if err := txStore.UpsertUserStats(ctx, userID, acc.User.Stats(now)); err != nil {
+		return err
+	}
+	for opponentID, v := range acc.Opponents {
+		if v.Matches == 0 {
+			if err := txStore.DeleteOpponentStats(ctx, userID, opponentID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := txStore.UpsertOpponentStats(ctx, userID, opponentID, v.Stats(now)); err != nil {
+			return err
+		}
+	}
+	for _, granularity := range stats.PeriodGranularities {
+		t, err := lookupPeriodTable(granularity)
+		if err != nil {
+			return err
+		}
+		for start, v := range acc.Periods(granularity) {
+			if v.Sessions == 0 {
+				err = txStore.deletePeriodStats(ctx, t, userID, start)
+			} else {
+				err = txStore.upsertPeriodStats(ctx, t, userID, v.Stats(start))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// ReplaceAccumulators discards every accumulator of the user and stores acc,
+// used after a full rebuild, recording eventIDs as applied.
+func (s *Store) ReplaceAccumulators(ctx context.Context, userID uuid.UUID, acc stats.Accumulators, eventIDs []int64) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `DELETE FROM projection_accumulators WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	txStore := &Store{pool: s.pool, db: tx}
+	if err := txStore.writeAccumulators(ctx, userID, acc); err != nil {
+		return err
+	}
+	if err := txStore.MarkEventsApplied(ctx, userID, eventIDs); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// AppliedEvents reports which of the given outbox event IDs have already been
+// folded into the projections.
+func (s *Store) AppliedEvents(ctx context.Context, eventIDs []int64) (map[int64]bool, error) {
+	applied := make(map[int64]bool)
+	if len(eventIDs) == 0 {
+		return applied, nil
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT event_id FROM projection_applied_events WHERE event_id = ANY($1)
+	`, eventIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		applied[id] = true
+	}
+	return applied, rows.Err()
+}
+
+func (s *Store) MarkEventsApplied(ctx context.Context, userID uuid.UUID, eventIDs []int64) error {
+	if len(eventIDs) == 0 {
+		return nil
+	}
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO projection_applied_events (event_id, user_id)
+		SELECT unnest($1::bigint[]), $2
+		ON CONFLICT (event_id) DO NOTHING
+	`, eventIDs, userID)
+	return err
+}
+
+func (s *Store) writeAccumulators(ctx context.Context, userID uuid.UUID, acc stats.Accumulators) error {
+	if err := s.putAccumulator(ctx, userID, acc.Version, accumulatorScopeUser, "", acc.User, false); err != nil {
+		return err
+	}
+	for id, v := range acc.Opponents {
+		if err := s.putAccumulator(ctx, userID, acc.Version, accumulatorScopeOpponent, id.String(), v, v.Matches == 0); err != nil {
+			return err
+		}
+	}
+	for _, granularity := range stats.PeriodGranularities {
+		layout := periodKeyLayouts[granularity]
+		for start, v := range acc.Periods(granularity) {
+			if err := s.putAccumulator(ctx, userID, acc.Version, granularity, start.Format(layout), v, v.Sessions == 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) putAccumulator(ctx context.Context, userID uuid.UUID, version int, scope, key string, state any, empty bool) error {
+	if empty {
+		_, err := s.db.Exec(ctx, `
+			DELETE FROM projection_accumulators WHERE user_id = $1 AND scope = $2 AND scope_key = $3
+		`, userID, scope, key)
+		return err
+	}
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("encode %s accumulator: %w", scope, err)
+	}
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO projection_accumulators (user_id, scope, scope_key, state, calculator_version, updated_at)
+		VALUES ($1,$2,$3,$4,$5,now())
+		ON CONFLICT (user_id, scope, scope_key)
+		DO UPDATE SET
+			state = EXCLUDED.state,
+			calculator_version = EXCLUDED.calculator_version,
+			updated_at = EXCLUDED.updated_at
+	`, userID, scope, key, payload, version)
+	return err
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/lutefd/baseline-api/internal/domain/goals"
+	"github.com/lutefd/baseline-api/internal/domain/sync"
+)
+
+const goalColumns = `id, user_id, title, metric, comparator, target, session_type, opponent_id,
+		window_sessions, window_days, required_count, starts_at, ends_at, created_at, updated_at, deleted_at`
+
+func scanGoal(row pgx.Row) (goals.Goal, error) {
+	var v goals.Goal
+	err := row.Scan(
+		&v.ID, &v.UserID, &v.Title, &v.Metric, &v.Comparator, &v.Target, &v.SessionType, &v.OpponentID,
+		&v.WindowSessions, &v.WindowDays, &v.RequiredCount, &v.StartsAt, &v.EndsAt, &v.CreatedAt, &v.UpdatedAt, &v.DeletedAt,
+	)
+	return v, err
+}
+
+func (s *Store) CreateGoal(ctx context.Context, v goals.Goal) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO goals (`+goalColumns+`)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)
+	`, v.ID, v.UserID, v.Title, v.Metric, v.Comparator, v.Target, v.SessionType, v.OpponentID,
+		v.WindowSessions, v.WindowDays, v.RequiredCount, v.StartsAt, v.EndsAt, v.CreatedAt, v.UpdatedAt, v.DeletedAt)
+	return err
+}
+
+// UpdateGoal overwrites every field of the user's goal v.ID, tombstones
+// included, and reports whether the goal exists.
+func (s *Store) UpdateGoal(ctx context.Context, v goals.Goal) (bool, error) {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE goals SET
+			title = $3,
+			metric = $4,
+			comparator = $5,
+			target = $6,
+			session_type = $7,
+			opponent_id = $8,
+			window_sessions = $9,
+			window_days = $10,
+			required_count = $11,
+			starts_at = $12,
+			ends_at = $13,
+			created_at = $14,
+			updated_at = $15,
+			deleted_at = $16,
+			received_at = now()
+		WHERE id = $1 AND user_id = $2
+	`, v.ID, v.UserID, v.Title, v.Metric, v.Comparator, v.Target, v.SessionType, v.OpponentID,
+		v.WindowSessions, v.WindowDays, v.RequiredCount, v.StartsAt, v.EndsAt, v.CreatedAt, v.UpdatedAt, v.DeletedAt)
+	return tag.RowsAffected() > 0, err
+}
+
+// GetGoal returns the user's goal, tombstoned or not.
+func (s *Store) GetGoal(ctx context.Context, userID, goalID uuid.UUID) (goals.Goal, bool, error) {
+	v, err := scanGoal(s.db.QueryRow(ctx, `
+		SELECT `+goalColumns+`
+		FROM goals WHERE id = $1 AND user_id = $2
+	`, goalID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return goals.Goal{}, false, nil
+		}
+		return goals.Goal{}, false, err
+	}
+	return v, true, nil
+}
+
+func (s *Store) ListGoalsByUser(ctx context.Context, userID uuid.UUID, includeDeleted bool) ([]goals.Goal, error) {
+	query := `SELECT ` + goalColumns + ` FROM goals WHERE user_id = $1`
+	if !includeDeleted {
+		query += ` AND deleted_at IS NULL`
+	}
+	query += ` ORDER BY starts_at DESC, created_at DESC`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]goals.Goal, 0)
+	for rows.Next() {
+		v, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) UpsertGoalByUpdatedAt(ctx context.Context, incoming goals.Goal) (sync.MergeDecision, error) {
+	var storedUserID uuid.UUID
+	var storedUpdatedAt time.Time
+	var storedDeletedAt *time.Time
+	err := s.db.QueryRow(ctx, `SELECT user_id, updated_at, deleted_at FROM goals WHERE id = $1`, incoming.ID).Scan(&storedUserID, &storedUpdatedAt, &storedDeletedAt)
+	if err == nil && storedUserID != incoming.UserID {
+		return sync.DecisionIgnore, sync.ErrForeignOwner
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			if err := s.CreateGoal(ctx, incoming); err != nil {
+				return sync.DecisionIgnore, err
+			}
+			return sync.DecisionInsert, nil
+		}
+		return sync.DecisionIgnore, err
+	}
+
+	decision := sync.ResolveByUpdatedAt(incoming.UpdatedAt, storedUpdatedAt, incoming.DeletedAt, storedDeletedAt)
+	if decision != sync.DecisionUpdate {
+		return decision, nil
+	}
+	_, err = s.UpdateGoal(ctx, incoming)
+	return decision, err
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/outbox"
+)
+
+// EnqueueOutbox records an event for later delivery. Call it on a store bound
+// to the same transaction as the writes the event describes.
+func (s *Store) EnqueueOutbox(ctx context.Context, userID uuid.UUID, name string, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode %s payload: %w", name, err)
+	}
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO outbox (user_id, event_name, payload) VALUES ($1,$2,$3)
+	`, userID, name, raw)
+	return err
+}
+
+// ClaimOutbox locks up to limit due rows in ID order and pushes their next
+// attempt past the lease, so concurrent dispatchers skip them and a crashed
+// dispatcher's rows become due again once the lease expires.
+func (s *Store) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]outbox.Record, error) {
+	rows, err := s.db.Query(ctx, `
+		UPDATE outbox SET next_attempt_at = now() + $2::interval
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, event_name, payload, attempts
+	`, limit, lease)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]outbox.Record, 0)
+	for rows.Next() {
+		var v outbox.Record
+		if err := rows.Scan(&v.ID, &v.UserID, &v.Name, &v.Payload, &v.Attempts); err != nil {
+			return nil, err
+		}
+		records = append(records, v)
+	}
+	return records, rows.Err()
+}
+
+func (s *Store) MarkOutboxDelivered(ctx context.Context, id int64) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE outbox SET status = 'delivered', delivered_at = now(), last_error = NULL WHERE id = $1
+	`, id)
+	return err
+}
+
+func (s *Store) MarkOutboxFailed(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string, dead bool) error {
+	status := "pending"
+	if dead {
+		status = "dead"
+	}
+	_, err := s.db.Exec(ctx, `
+		UPDATE outbox SET status = $2, attempts = $3, next_attempt_at = $4, last_error = $5 WHERE id = $1
+	`, id, status, attempts, nextAttemptAt, lastError)
+	return err
+}
+
+// HasUndeliveredOutbox reports whether the user has pending or dead events
+// with the given name, i.e. whether their projections may be missing writes.
+func (s *Store) HasUndeliveredOutbox(ctx context.Context, userID uuid.UUID, name string) (bool, error) {
+	var undelivered bool
+	err := s.db.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM outbox WHERE user_id = $1 AND event_name = $2 AND status IN ('pending', 'dead'))
+	`, userID, name).Scan(&undelivered)
+	return undelivered, err
+}
+
+// PurgeOutbox deletes delivered rows and projection dedupe markers older than
+// deliveredBefore. Dead rows are kept for inspection.
+func (s *Store) PurgeOutbox(ctx context.Context, deliveredBefore time.Time) (int64, error) {
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM outbox WHERE status = 'delivered' AND delivered_at < $1
+	`, deliveredBefore)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.db.Exec(ctx, `
+		DELETE FROM projection_applied_events WHERE applied_at < $1
+	`, deliveredBefore); err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
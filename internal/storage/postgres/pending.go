@@ -0,0 +1,134 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/goals"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+	"github.com/lutefd/baseline-api/internal/domain/sync"
+)
+
+func (s *Store) OpponentExists(ctx context.Context, userID, opponentID uuid.UUID) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM opponents WHERE id = $1 AND user_id = $2)
+	`, opponentID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (s *Store) SessionExists(ctx context.Context, userID, sessionID uuid.UUID) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM sessions WHERE id = $1 AND user_id = $2)
+	`, sessionID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (s *Store) SavePending(ctx context.Context, userID uuid.UUID, record sync.PendingRecord) error {
+	var payload []byte
+	var err error
+	switch record.EntityType {
+	case sync.EntitySession:
+		payload, err = json.Marshal(record.Session)
+	case sync.EntityMatchSet:
+		payload, err = json.Marshal(record.MatchSet)
+	case sync.EntityGoal:
+		payload, err = json.Marshal(record.Goal)
+	default:
+		return fmt.Errorf("unsupported pending entity type %q", record.EntityType)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO sync_pending (user_id, entity_type, entity_id, parent_type, parent_id, payload, updated_at, received_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,now())
+		ON CONFLICT (user_id, entity_type, entity_id)
+		DO UPDATE SET
+			parent_type = EXCLUDED.parent_type,
+			parent_id = EXCLUDED.parent_id,
+			payload = EXCLUDED.payload,
+			updated_at = EXCLUDED.updated_at,
+			received_at = EXCLUDED.received_at
+		WHERE sync_pending.updated_at < EXCLUDED.updated_at
+	`, userID, string(record.EntityType), record.ID, string(record.ParentType), record.ParentID, payload, record.UpdatedAt)
+	return err
+}
+
+func (s *Store) ListPending(ctx context.Context, userID uuid.UUID) ([]sync.PendingRecord, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT entity_type, entity_id, parent_type, parent_id, payload, updated_at
+		FROM sync_pending
+		WHERE user_id = $1
+		ORDER BY CASE entity_type WHEN 'session' THEN 0 ELSE 1 END, received_at ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]sync.PendingRecord, 0)
+	for rows.Next() {
+		var v sync.PendingRecord
+		var entityType, parentType string
+		var payload []byte
+		if err := rows.Scan(&entityType, &v.ID, &parentType, &v.ParentID, &payload, &v.UpdatedAt); err != nil {
+			return nil, err
+		}
+		v.EntityType = sync.EntityType(entityType)
+		v.ParentType = sync.EntityType(parentType)
+		switch v.EntityType {
+		case sync.EntitySession:
+			v.Session = &sessions.Session{}
+			err = json.Unmarshal(payload, v.Session)
+		case sync.EntityMatchSet:
+			v.MatchSet = &sessions.MatchSet{}
+			err = json.Unmarshal(payload, v.MatchSet)
+		case sync.EntityGoal:
+			v.Goal = &goals.Goal{}
+			err = json.Unmarshal(payload, v.Goal)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) DeletePending(ctx context.Context, userID uuid.UUID, entityType sync.EntityType, id uuid.UUID) error {
+	_, err := s.db.Exec(ctx, `
+		DELETE FROM sync_pending WHERE user_id = $1 AND entity_type = $2 AND entity_id = $3
+	`, userID, string(entityType), id)
+	return err
+}
+
+func (s *Store) ExpirePending(ctx context.Context, userID uuid.UUID, receivedBefore time.Time) ([]sync.PendingItem, error) {
+	rows, err := s.db.Query(ctx, `
+		DELETE FROM sync_pending
+		WHERE user_id = $1 AND received_at < $2
+		RETURNING entity_type, entity_id, parent_type, parent_id
+	`, userID, receivedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]sync.PendingItem, 0)
+	for rows.Next() {
+		var v sync.PendingItem
+		var entityType, parentType string
+		if err := rows.Scan(&entityType, &v.ID, &parentType, &v.ParentID); err != nil {
+			return nil, err
+		}
+		v.EntityType = sync.EntityType(entityType)
+		v.ParentType = sync.EntityType(parentType)
+		items = append(items, v)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,251 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/lutefd/baseline-api/internal/domain/stats"
+)
+
+// ReplaceRatings swaps the user's player rating, opponent ratings and rating
+// history for r.
+func (s *Store) ReplaceRatings(ctx context.Context, userID uuid.UUID, r stats.Ratings) error {
+	return s.writeRatings(ctx, userID, r, true)
+}
+
+// AppendRatings stores r as computed by stats.ExtendRatings: it updates the
+// player and the opponents in r and appends r's history.
+func (s *Store) AppendRatings(ctx context.Context, userID uuid.UUID, r stats.Ratings) error {
+	return s.writeRatings(ctx, userID, r, false)
+}
+
+func (s *Store) writeRatings(ctx context.Context, userID uuid.UUID, r stats.Ratings, replace bool) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO player_ratings (
+			user_id, rating, rating_deviation, volatility, matches_rated, last_match_at, strength_adjusted_win_rate,
+			surprise_sum, calculator_version, last_calculated_at
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,now())
+		ON CONFLICT (user_id)
+		DO UPDATE SET
+			rating = EXCLUDED.rating,
+			rating_deviation = EXCLUDED.rating_deviation,
+			volatility = EXCLUDED.volatility,
+			matches_rated = EXCLUDED.matches_rated,
+			last_match_at = EXCLUDED.last_match_at,
+			strength_adjusted_win_rate = EXCLUDED.strength_adjusted_win_rate,
+			surprise_sum = EXCLUDED.surprise_sum,
+			calculator_version = EXCLUDED.calculator_version,
+			last_calculated_at = EXCLUDED.last_calculated_at
+	`, userID, r.Player.Rating, r.Player.RatingDeviation, r.Player.Volatility, r.Player.Matches, r.Player.LastMatchAt,
+		r.StrengthAdjustedWinRate, r.Surprise, r.Version); err != nil {
+		return err
+	}
+
+	if replace {
+		if _, err := tx.Exec(ctx, `DELETE FROM opponent_ratings WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM rating_history WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+	}
+	for opponentID, v := range r.Opponents {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO opponent_ratings (
+				user_id, opponent_id, rating, rating_deviation, volatility, matches_rated, last_match_at, calculator_version
+			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+			ON CONFLICT (user_id, opponent_id)
+			DO UPDATE SET
+				rating = EXCLUDED.rating,
+				rating_deviation = EXCLUDED.rating_deviation,
+				volatility = EXCLUDED.volatility,
+				matches_rated = EXCLUDED.matches_rated,
+				last_match_at = EXCLUDED.last_match_at,
+				calculator_version = EXCLUDED.calculator_version
+		`, userID, opponentID, v.Rating, v.RatingDeviation, v.Volatility, v.Matches, v.LastMatchAt, r.Version); err != nil {
+			return err
+		}
+	}
+	for _, e := range r.History {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO rating_history (
+				user_id, session_id, opponent_id, match_date, won, score, expected_score,
+				player_rating, player_rating_deviation, player_volatility, player_matches,
+				opponent_rating, opponent_rating_deviation, opponent_volatility, opponent_matches
+			) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)
+		`, userID, e.SessionID, e.OpponentID, e.Date, e.Won, e.Score, e.ExpectedScore,
+			e.Player.Rating, e.Player.RatingDeviation, e.Player.Volatility, e.Player.Matches,
+			e.Opponent.Rating, e.Opponent.RatingDeviation, e.Opponent.Volatility, e.Opponent.Matches); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// LoadRatings returns the stored player rating and the ratings of the given
+// opponents, with Version and Surprise set and no history.
+func (s *Store) LoadRatings(ctx context.Context, userID uuid.UUID, opponentIDs []uuid.UUID) (stats.Ratings, bool, error) {
+	out := stats.Ratings{Opponents: make(map[uuid.UUID]stats.Rating)}
+	err := s.db.QueryRow(ctx, `
+		SELECT rating, rating_deviation, volatility, matches_rated, last_match_at, strength_adjusted_win_rate,
+		       surprise_sum, calculator_version
+		FROM player_ratings WHERE user_id = $1
+	`, userID).Scan(&out.Player.Rating, &out.Player.RatingDeviation, &out.Player.Volatility, &out.Player.Matches,
+		&out.Player.LastMatchAt, &out.StrengthAdjustedWinRate, &out.Surprise, &out.Version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return stats.Ratings{}, false, nil
+		}
+		return stats.Ratings{}, false, err
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT opponent_id, rating, rating_deviation, volatility, matches_rated, last_match_at, calculator_version
+		FROM opponent_ratings WHERE user_id = $1 AND opponent_id = ANY($2)
+	`, userID, opponentIDs)
+	if err != nil {
+		return stats.Ratings{}, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var v stats.Rating
+		var version int
+		if err := rows.Scan(&id, &v.Rating, &v.RatingDeviation, &v.Volatility, &v.Matches, &v.LastMatchAt, &version); err != nil {
+			return stats.Ratings{}, false, err
+		}
+		out.Opponents[id] = v
+		out.Version = min(out.Version, version)
+	}
+	return out, true, rows.Err()
+}
+
+// LastRatingEvent returns the user's most recent rated match.
+func (s *Store) LastRatingEvent(ctx context.Context, userID uuid.UUID) (stats.RatingEvent, bool, error) {
+	var e stats.RatingEvent
+	err := s.db.QueryRow(ctx, `
+		SELECT session_id, opponent_id, match_date
+		FROM rating_history
+		WHERE user_id = $1
+		ORDER BY match_date DESC, session_id DESC
+		LIMIT 1
+	`, userID).Scan(&e.SessionID, &e.OpponentID, &e.Date)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return stats.RatingEvent{}, false, nil
+		}
+		return stats.RatingEvent{}, false, err
+	}
+	return e, true, nil
+}
+
+// ListOutdatedRatingUsers returns the users with rating rows older than
+// version, and the users with sessions whose ratings were never computed.
+func (s *Store) ListOutdatedRatingUsers(ctx context.Context, version int) ([]uuid.UUID, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT user_id FROM player_ratings WHERE calculator_version < $1
+		UNION SELECT user_id FROM opponent_ratings WHERE calculator_version < $1
+		UNION SELECT s.user_id FROM sessions s
+		WHERE s.deleted_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM player_ratings p WHERE p.user_id = s.user_id)
+		ORDER BY user_id
+	`, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetPlayerRating returns the user's rating and strength-adjusted win rate,
+// or an initial rating when ratings were never computed.
+func (s *Store) GetPlayerRating(ctx context.Context, userID uuid.UUID) (stats.Rating, *float64, error) {
+	var out stats.Rating
+	var adjusted *float64
+	err := s.db.QueryRow(ctx, `
+		SELECT rating, rating_deviation, volatility, matches_rated, last_match_at, strength_adjusted_win_rate
+		FROM player_ratings WHERE user_id = $1
+	`, userID).Scan(&out.Rating, &out.RatingDeviation, &out.Volatility, &out.Matches, &out.LastMatchAt, &adjusted)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return stats.NewRating(), nil, nil
+		}
+		return stats.Rating{}, nil, err
+	}
+	return out, adjusted, nil
+}
+
+func (s *Store) ListOpponentRatings(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]stats.Rating, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT opponent_id, rating, rating_deviation, volatility, matches_rated, last_match_at
+		FROM opponent_ratings WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[uuid.UUID]stats.Rating)
+	for rows.Next() {
+		var id uuid.UUID
+		var v stats.Rating
+		if err := rows.Scan(&id, &v.Rating, &v.RatingDeviation, &v.Volatility, &v.Matches, &v.LastMatchAt); err != nil {
+			return nil, err
+		}
+		out[id] = v
+	}
+	return out, rows.Err()
+}
+
+// ListRatingHistory returns the user's rated matches between from and to,
+// oldest first.
+func (s *Store) ListRatingHistory(ctx context.Context, userID uuid.UUID, from, to *time.Time) ([]stats.RatingEvent, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT session_id, opponent_id, match_date, won, score, expected_score,
+		       player_rating, player_rating_deviation, player_volatility, player_matches,
+		       opponent_rating, opponent_rating_deviation, opponent_volatility, opponent_matches
+		FROM rating_history
+		WHERE user_id = $1
+		  AND ($2::timestamptz IS NULL OR match_date >= $2)
+		  AND ($3::timestamptz IS NULL OR match_date <= $3)
+		ORDER BY match_date ASC, session_id ASC
+	`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]stats.RatingEvent, 0)
+	for rows.Next() {
+		var e stats.RatingEvent
+		if err := rows.Scan(
+			&e.SessionID, &e.OpponentID, &e.Date, &e.Won, &e.Score, &e.ExpectedScore,
+			&e.Player.Rating, &e.Player.RatingDeviation, &e.Player.Volatility, &e.Player.Matches,
+			&e.Opponent.Rating, &e.Opponent.RatingDeviation, &e.Opponent.Volatility, &e.Opponent.Matches,
+		); err != nil {
+			return nil, err
+		}
+		date := e.Date
+		e.Player.LastMatchAt, e.Opponent.LastMatchAt = &date, &date
+		items = append(items, e)
+	}
+	return items, rows.Err()
+}
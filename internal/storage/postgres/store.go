@@ -4,20 +4,30 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/lutefd/baseline-api/internal/domain/goals"
 	"github.com/lutefd/baseline-api/internal/domain/opponents"
 	"github.com/lutefd/baseline-api/internal/domain/sessions"
 	"github.com/lutefd/baseline-api/internal/domain/stats"
 	"github.com/lutefd/baseline-api/internal/domain/sync"
 )
 
+type dbtx interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
 type Store struct {
 	pool *pgxpool.Pool
+	db   dbtx
 }
 
 func NewStore(ctx context.Context, dsn string) (*Store, error) {
@@ -31,15 +41,81 @@ func NewStore(ctx context.Context, dsn string) (*Store, error) {
 		pool.Close()
 		return nil, err
 	}
-	return &Store{pool: pool}, nil
+	return &Store{pool: pool, db: pool}, nil
 }
 
 func (s *Store) Close() {
 	s.pool.Close()
 }
 
+// WithRollback runs fn against a store bound to a transaction that is always
+// rolled back, so callers can observe the effect of writes without keeping them.
+func (s *Store) WithRollback(ctx context.Context, fn func(*Store) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	return fn(&Store{pool: s.pool, db: tx})
+}
+
+// WithTx runs fn against a store bound to a transaction that is committed
+// when fn returns nil and rolled back otherwise.
+func (s *Store) WithTx(ctx context.Context, fn func(*Store) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if err := fn(&Store{pool: s.pool, db: tx}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// WithUserLock runs fn in a transaction holding a transaction-scoped advisory
+// lock on (scope, userID), so callers using the same scope are serialized per
+// user across every process sharing the database.
+func (s *Store) WithUserLock(ctx context.Context, scope string, userID uuid.UUID, fn func(*Store) error) error {
+	return s.WithTx(ctx, func(tx *Store) error {
+		if err := tx.LockUser(ctx, scope, userID); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// LockUser takes the WithUserLock lock inside the current transaction, which
+// releases it. Outside a transaction it is released immediately.
+func (s *Store) LockUser(ctx context.Context, scope string, userID uuid.UUID) error {
+	_, err := s.db.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1), hashtext($2))`, scope, userID.String())
+	return err
+}
+
+// TryExclusive runs fn only when no other process holds the named advisory
+// lock, keeping it until fn returns. It reports whether fn ran.
+func (s *Store) TryExclusive(ctx context.Context, name string, fn func() error) (bool, error) {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, name).Scan(&acquired); err != nil {
+		return false, err
+	}
+	if !acquired {
+		return false, nil
+	}
+	defer func() {
+		_, _ = conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock(hashtext($1))`, name)
+	}()
+	return true, fn()
+}
+
 func (s *Store) EnsureDefaultUser(ctx context.Context, id uuid.UUID) error {
-	_, err := s.pool.Exec(ctx, `
+	_, err := s.db.Exec(ctx, `
 		INSERT INTO users (id, email)
 		VALUES ($1, NULL)
 		ON CONFLICT (id) DO NOTHING
@@ -47,8 +123,36 @@ func (s *Store) EnsureDefaultUser(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+// GetUserCalendar returns the user's bucketing calendar, or the default
+// calendar for users that do not exist yet.
+func (s *Store) GetUserCalendar(ctx context.Context, userID uuid.UUID) (stats.Calendar, error) {
+	var timezone string
+	var weekStart int
+	err := s.db.QueryRow(ctx, `SELECT timezone, week_start FROM users WHERE id = $1`, userID).Scan(&timezone, &weekStart)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return stats.DefaultCalendar, nil
+		}
+		return stats.Calendar{}, err
+	}
+	return stats.NewCalendar(timezone, time.Weekday(weekStart))
+}
+
+// UpdateUserCalendar stores the user's calendar and reports whether it changed.
+func (s *Store) UpdateUserCalendar(ctx context.Context, userID uuid.UUID, cal stats.Calendar) (bool, error) {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users
+		SET timezone = $2, week_start = $3, updated_at = now()
+		WHERE id = $1 AND (timezone <> $2 OR week_start <> $3)
+	`, userID, cal.Timezone(), int(cal.WeekStart))
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
 func (s *Store) CreateSession(ctx context.Context, v sessions.Session) error {
-	_, err := s.pool.Exec(ctx, `
+	_, err := s.db.Exec(ctx, `
 		INSERT INTO sessions (
 			id, user_id, opponent_id, session_name, session_type, date, duration_minutes,
 			rushed_shots, unforced_errors, long_rallies, direction_changes, composure,
@@ -83,7 +187,7 @@ func (s *Store) ListSessionsByUser(ctx context.Context, userID uuid.UUID, includ
 	}
 	query += ` ORDER BY date DESC LIMIT $2`
 
-	rows, err := s.pool.Query(ctx, query, userID, limit)
+	rows, err := s.db.Query(ctx, query, userID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -122,7 +226,39 @@ func (s *Store) ListSessionsByDateRange(ctx context.Context, userID uuid.UUID, f
 	}
 	query += ` ORDER BY date ASC`
 
-	rows, err := s.pool.Query(ctx, query, args...)
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]sessions.Session, 0)
+	for rows.Next() {
+		var v sessions.Session
+		if err := rows.Scan(
+			&v.ID, &v.UserID, &v.OpponentID, &v.SessionName, &v.SessionType, &v.Date, &v.DurationMinutes,
+			&v.RushedShots, &v.UnforcedErrors, &v.LongRallies, &v.DirectionChanges, &v.Composure,
+			&v.FocusText, &v.FollowedFocus, &v.IsMatchWin, &v.Notes, &v.CreatedAt, &v.UpdatedAt, &v.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, rows.Err()
+}
+
+// ListSessionsBefore returns the user's last limit live sessions dated before
+// before, oldest first.
+func (s *Store) ListSessionsBefore(ctx context.Context, userID uuid.UUID, before time.Time, limit int) ([]sessions.Session, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT id, user_id, opponent_id, session_name, session_type, date, duration_minutes,
+		       rushed_shots, unforced_errors, long_rallies, direction_changes, composure,
+		       focus_text, followed_focus, is_match_win, notes, created_at, updated_at, deleted_at
+		FROM sessions
+		WHERE user_id = $1 AND deleted_at IS NULL AND date < $2
+		ORDER BY date DESC
+		LIMIT $3
+	`, userID, before, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -140,11 +276,69 @@ func (s *Store) ListSessionsByDateRange(ctx context.Context, userID uuid.UUID, f
 		}
 		items = append(items, v)
 	}
+	slices.Reverse(items)
 	return items, rows.Err()
 }
 
+// CurrentResultStreak returns the run of equal results ending at the user's
+// latest decided match, or nil without one. Matches are read newest first a
+// page at a time, stopping at the first change of result.
+func (s *Store) CurrentResultStreak(ctx context.Context, userID uuid.UUID) (*stats.ResultStreak, error) {
+	const pageSize = 20
+	var out *stats.ResultStreak
+	var won bool
+	var afterDate *time.Time
+	var afterID uuid.UUID
+	for {
+		rows, err := s.db.Query(ctx, `
+			SELECT id, date, is_match_win
+			FROM sessions
+			WHERE user_id = $1 AND deleted_at IS NULL
+			  AND session_type IN ('match', 'friendly') AND is_match_win IS NOT NULL
+			  AND ($2::timestamptz IS NULL OR (date, id) < ($2, $3))
+			ORDER BY date DESC, id DESC
+			LIMIT $4
+		`, userID, afterDate, afterID, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		read, changed := 0, false
+		for rows.Next() {
+			var id uuid.UUID
+			var date time.Time
+			var result bool
+			if err := rows.Scan(&id, &date, &result); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			read++
+			if out == nil {
+				won = result
+				out = &stats.ResultStreak{Result: stats.ResultLoss, Streak: stats.Streak{EndSessionID: id, EndDate: date}}
+				if won {
+					out.Result = stats.ResultWin
+				}
+			}
+			if result != won {
+				changed = true
+				break
+			}
+			out.Length++
+			out.StartSessionID, out.StartDate = id, date
+			afterDate, afterID = &date, id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if changed || read < pageSize {
+			return out, nil
+		}
+	}
+}
+
 func (s *Store) ListMatchSessionsByOpponent(ctx context.Context, userID, opponentID uuid.UUID) ([]sessions.Session, error) {
-	rows, err := s.pool.Query(ctx, `
+	rows, err := s.db.Query(ctx, `
 		SELECT id, user_id, opponent_id, session_name, session_type, date, duration_minutes,
 		       rushed_shots, unforced_errors, long_rallies, direction_changes, composure,
 		       focus_text, followed_focus, is_match_win, notes, created_at, updated_at, deleted_at
@@ -177,7 +371,7 @@ func (s *Store) ListMatchSessionsByOpponent(ctx context.Context, userID, opponen
 
 func (s *Store) CreateOpponent(ctx context.Context, v opponents.Opponent) error {
 	v = withIdentityKey(v)
-	_, err := s.pool.Exec(ctx, `
+	_, err := s.db.Exec(ctx, `
 		INSERT INTO opponents (id, identity_key, user_id, name, dominant_hand, play_style, notes, created_at, updated_at, deleted_at)
 		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
 	`, v.ID, v.IdentityKey, v.UserID, v.Name, v.DominantHand, v.PlayStyle, v.Notes, v.CreatedAt, v.UpdatedAt, v.DeletedAt)
@@ -193,7 +387,7 @@ func (s *Store) ListOpponentsByUser(ctx context.Context, userID uuid.UUID, inclu
 	}
 	query += ` ORDER BY lower(name) ASC`
 
-	rows, err := s.pool.Query(ctx, query, userID)
+	rows, err := s.db.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -211,9 +405,13 @@ func (s *Store) ListOpponentsByUser(ctx context.Context, userID uuid.UUID, inclu
 }
 
 func (s *Store) UpsertSessionByUpdatedAt(ctx context.Context, incoming sessions.Session) (sync.MergeDecision, error) {
+	var storedUserID uuid.UUID
 	var storedUpdatedAt time.Time
 	var storedDeletedAt *time.Time
-	err := s.pool.QueryRow(ctx, `SELECT updated_at, deleted_at FROM sessions WHERE id = $1`, incoming.ID).Scan(&storedUpdatedAt, &storedDeletedAt)
+	err := s.db.QueryRow(ctx, `SELECT user_id, updated_at, deleted_at FROM sessions WHERE id = $1`, incoming.ID).Scan(&storedUserID, &storedUpdatedAt, &storedDeletedAt)
+	if err == nil && storedUserID != incoming.UserID {
+		return sync.DecisionIgnore, sync.ErrForeignOwner
+	}
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			if err := s.CreateSession(ctx, incoming); err != nil {
@@ -229,7 +427,7 @@ func (s *Store) UpsertSessionByUpdatedAt(ctx context.Context, incoming sessions.
 		return decision, nil
 	}
 
-	_, err = s.pool.Exec(ctx, `
+	_, err = s.db.Exec(ctx, `
 		UPDATE sessions SET
 			user_id = $2,
 			opponent_id = $3,
@@ -248,7 +446,8 @@ func (s *Store) UpsertSessionByUpdatedAt(ctx context.Context, incoming sessions.
 			notes = $16,
 			created_at = $17,
 			updated_at = $18,
-			deleted_at = $19
+			deleted_at = $19,
+			received_at = now()
 		WHERE id = $1
 	`,
 		incoming.ID, incoming.UserID, incoming.OpponentID, incoming.SessionName, incoming.SessionType, incoming.Date,
@@ -261,12 +460,20 @@ func (s *Store) UpsertSessionByUpdatedAt(ctx context.Context, incoming sessions.
 
 func (s *Store) UpsertOpponentByUpdatedAt(ctx context.Context, incoming opponents.Opponent) (sync.MergeDecision, error) {
 	incoming = withIdentityKey(incoming)
+	var storedUserID uuid.UUID
 	var storedUpdatedAt time.Time
 	var storedDeletedAt *time.Time
-	err := s.pool.QueryRow(ctx, `SELECT updated_at, deleted_at FROM opponents WHERE id = $1`, incoming.ID).Scan(&storedUpdatedAt, &storedDeletedAt)
+	err := s.db.QueryRow(ctx, `SELECT user_id, updated_at, deleted_at FROM opponents WHERE id = $1`, incoming.ID).Scan(&storedUserID, &storedUpdatedAt, &storedDeletedAt)
+	if err == nil && storedUserID != incoming.UserID {
+		return sync.DecisionIgnore, sync.ErrForeignOwner
+	}
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			if err := s.CreateOpponent(ctx, incoming); err != nil {
+			// The insert can hit the identity key constraint, which callers retry.
+			// Running it in its own (sub)transaction keeps an enclosing
+			// transaction usable after the failure.
+			err := s.WithTx(ctx, func(tx *Store) error { return tx.CreateOpponent(ctx, incoming) })
+			if err != nil {
 				return sync.DecisionIgnore, err
 			}
 			return sync.DecisionInsert, nil
@@ -279,7 +486,7 @@ func (s *Store) UpsertOpponentByUpdatedAt(ctx context.Context, incoming opponent
 		return decision, nil
 	}
 
-	_, err = s.pool.Exec(ctx, `
+	_, err = s.db.Exec(ctx, `
 		UPDATE opponents SET
 			user_id = $2,
 			identity_key = $3,
@@ -289,7 +496,8 @@ func (s *Store) UpsertOpponentByUpdatedAt(ctx context.Context, incoming opponent
 			notes = $7,
 			created_at = $8,
 			updated_at = $9,
-			deleted_at = $10
+			deleted_at = $10,
+			received_at = now()
 		WHERE id = $1
 	`, incoming.ID, incoming.UserID, incoming.IdentityKey, incoming.Name, incoming.DominantHand, incoming.PlayStyle, incoming.Notes,
 		incoming.CreatedAt, incoming.UpdatedAt, incoming.DeletedAt)
@@ -297,12 +505,22 @@ func (s *Store) UpsertOpponentByUpdatedAt(ctx context.Context, incoming opponent
 }
 
 func (s *Store) UpsertMatchSetByUpdatedAt(ctx context.Context, incoming sessions.MatchSet) (sync.MergeDecision, error) {
+	var sameOwner bool
 	var storedUpdatedAt time.Time
 	var storedDeletedAt *time.Time
-	err := s.pool.QueryRow(ctx, `SELECT updated_at, deleted_at FROM match_sets WHERE id = $1`, incoming.ID).Scan(&storedUpdatedAt, &storedDeletedAt)
+	err := s.db.QueryRow(ctx, `
+		SELECT ms.updated_at, ms.deleted_at,
+		       stored.user_id IS NOT DISTINCT FROM (SELECT user_id FROM sessions WHERE id = $2)
+		FROM match_sets ms
+		JOIN sessions stored ON stored.id = ms.session_id
+		WHERE ms.id = $1
+	`, incoming.ID, incoming.SessionID).Scan(&storedUpdatedAt, &storedDeletedAt, &sameOwner)
+	if err == nil && !sameOwner {
+		return sync.DecisionIgnore, sync.ErrForeignOwner
+	}
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			_, err := s.pool.Exec(ctx, `
+			_, err := s.db.Exec(ctx, `
 				INSERT INTO match_sets (id, session_id, set_number, player_games, opponent_games, created_at, updated_at, deleted_at)
 				VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
 			`, incoming.ID, incoming.SessionID, incoming.SetNumber, incoming.PlayerGames, incoming.OpponentGames,
@@ -320,17 +538,68 @@ func (s *Store) UpsertMatchSetByUpdatedAt(ctx context.Context, incoming sessions
 		return decision, nil
 	}
 
-	_, err = s.pool.Exec(ctx, `
+	_, err = s.db.Exec(ctx, `
 		UPDATE match_sets
-		SET session_id=$2, set_number=$3, player_games=$4, opponent_games=$5, created_at=$6, updated_at=$7, deleted_at=$8
+		SET session_id=$2, set_number=$3, player_games=$4, opponent_games=$5, created_at=$6, updated_at=$7, deleted_at=$8,
+		    received_at=now()
 		WHERE id = $1
 	`, incoming.ID, incoming.SessionID, incoming.SetNumber, incoming.PlayerGames, incoming.OpponentGames,
 		incoming.CreatedAt, incoming.UpdatedAt, incoming.DeletedAt)
 	return decision, err
 }
 
-func (s *Store) PullChanges(ctx context.Context, userID uuid.UUID, updatedAfter time.Time) ([]sessions.Session, []sessions.MatchSet, []opponents.Opponent, error) {
-	sessionsRows, err := s.pool.Query(ctx, `
+func (s *Store) PullChanges(ctx context.Context, userID uuid.UUID, updatedAfter time.Time) ([]sessions.Session, []sessions.MatchSet, []opponents.Opponent, []goals.Goal, error) {
+	sessionItems := make([]sessions.Session, 0)
+	setItems := make([]sessions.MatchSet, 0)
+	opponentItems := make([]opponents.Opponent, 0)
+	goalItems := make([]goals.Goal, 0)
+	err := s.StreamChanges(ctx, userID, updatedAfter, func(entityType sync.EntityType, item any) error {
+		switch v := item.(type) {
+		case sessions.Session:
+			sessionItems = append(sessionItems, v)
+		case sessions.MatchSet:
+			setItems = append(setItems, v)
+		case opponents.Opponent:
+			opponentItems = append(opponentItems, v)
+		case goals.Goal:
+			goalItems = append(goalItems, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return sessionItems, setItems, opponentItems, goalItems, nil
+}
+
+// StreamChanges visits every row changed after updatedAfter, parents before
+// children (opponents, sessions, match sets, then goals), without buffering the
+// set.
+func (s *Store) StreamChanges(ctx context.Context, userID uuid.UUID, updatedAfter time.Time, visit func(sync.EntityType, any) error) error {
+	opponentRows, err := s.db.Query(ctx, `
+		SELECT id, identity_key, user_id, name, dominant_hand, play_style, notes, created_at, updated_at, deleted_at
+		FROM opponents
+		WHERE user_id = $1 AND updated_at > $2
+		ORDER BY updated_at ASC
+	`, userID, updatedAfter)
+	if err != nil {
+		return err
+	}
+	defer opponentRows.Close()
+	for opponentRows.Next() {
+		var v opponents.Opponent
+		if err := opponentRows.Scan(&v.ID, &v.IdentityKey, &v.UserID, &v.Name, &v.DominantHand, &v.PlayStyle, &v.Notes, &v.CreatedAt, &v.UpdatedAt, &v.DeletedAt); err != nil {
+			return err
+		}
+		if err := visit(sync.EntityOpponent, v); err != nil {
+			return err
+		}
+	}
+	if err := opponentRows.Err(); err != nil {
+		return err
+	}
+
+	sessionsRows, err := s.db.Query(ctx, `
 		SELECT id, user_id, opponent_id, session_name, session_type, date, duration_minutes,
 		       rushed_shots, unforced_errors, long_rallies, direction_changes, composure,
 		       focus_text, followed_focus, is_match_win, notes, created_at, updated_at, deleted_at
@@ -339,12 +608,9 @@ func (s *Store) PullChanges(ctx context.Context, userID uuid.UUID, updatedAfter
 		ORDER BY updated_at ASC
 	`, userID, updatedAfter)
 	if err != nil {
-		return nil, nil, nil, err
+		return err
 	}
 	defer sessionsRows.Close()
-
-	sessionItems := make([]sessions.Session, 0)
-	sessionIDs := make([]uuid.UUID, 0)
 	for sessionsRows.Next() {
 		var v sessions.Session
 		if err := sessionsRows.Scan(
@@ -352,64 +618,81 @@ func (s *Store) PullChanges(ctx context.Context, userID uuid.UUID, updatedAfter
 			&v.RushedShots, &v.UnforcedErrors, &v.LongRallies, &v.DirectionChanges, &v.Composure,
 			&v.FocusText, &v.FollowedFocus, &v.IsMatchWin, &v.Notes, &v.CreatedAt, &v.UpdatedAt, &v.DeletedAt,
 		); err != nil {
-			return nil, nil, nil, err
+			return err
+		}
+		if err := visit(sync.EntitySession, v); err != nil {
+			return err
 		}
-		sessionItems = append(sessionItems, v)
-		sessionIDs = append(sessionIDs, v.ID)
+	}
+	if err := sessionsRows.Err(); err != nil {
+		return err
 	}
 
-	setItems := make([]sessions.MatchSet, 0)
-	if len(sessionIDs) > 0 {
-		setRows, err := s.pool.Query(ctx, `
-			SELECT id, session_id, set_number, player_games, opponent_games, created_at, updated_at, deleted_at
-			FROM match_sets
-			WHERE session_id = ANY($1) AND updated_at > $2
-			ORDER BY updated_at ASC
-		`, sessionIDs, updatedAfter)
-		if err != nil {
-			return nil, nil, nil, err
+	setRows, err := s.db.Query(ctx, `
+		SELECT ms.id, ms.session_id, ms.set_number, ms.player_games, ms.opponent_games, ms.created_at, ms.updated_at, ms.deleted_at
+		FROM match_sets ms
+		JOIN sessions s ON s.id = ms.session_id
+		WHERE s.user_id = $1 AND ms.updated_at > $2
+		ORDER BY ms.updated_at ASC
+	`, userID, updatedAfter)
+	if err != nil {
+		return err
+	}
+	defer setRows.Close()
+	for setRows.Next() {
+		var v sessions.MatchSet
+		if err := setRows.Scan(&v.ID, &v.SessionID, &v.SetNumber, &v.PlayerGames, &v.OpponentGames, &v.CreatedAt, &v.UpdatedAt, &v.DeletedAt); err != nil {
+			return err
 		}
-		defer setRows.Close()
-		for setRows.Next() {
-			var v sessions.MatchSet
-			if err := setRows.Scan(&v.ID, &v.SessionID, &v.SetNumber, &v.PlayerGames, &v.OpponentGames, &v.CreatedAt, &v.UpdatedAt, &v.DeletedAt); err != nil {
-				return nil, nil, nil, err
-			}
-			setItems = append(setItems, v)
+		if err := visit(sync.EntityMatchSet, v); err != nil {
+			return err
 		}
 	}
+	if err := setRows.Err(); err != nil {
+		return err
+	}
 
-	opponentRows, err := s.pool.Query(ctx, `
-		SELECT id, identity_key, user_id, name, dominant_hand, play_style, notes, created_at, updated_at, deleted_at
-		FROM opponents
+	goalRows, err := s.db.Query(ctx, `
+		SELECT `+goalColumns+`
+		FROM goals
 		WHERE user_id = $1 AND updated_at > $2
 		ORDER BY updated_at ASC
 	`, userID, updatedAfter)
 	if err != nil {
-		return nil, nil, nil, err
+		return err
 	}
-	defer opponentRows.Close()
-
-	opponentItems := make([]opponents.Opponent, 0)
-	for opponentRows.Next() {
-		var v opponents.Opponent
-		if err := opponentRows.Scan(&v.ID, &v.IdentityKey, &v.UserID, &v.Name, &v.DominantHand, &v.PlayStyle, &v.Notes, &v.CreatedAt, &v.UpdatedAt, &v.DeletedAt); err != nil {
-			return nil, nil, nil, err
+	defer goalRows.Close()
+	for goalRows.Next() {
+		v, err := scanGoal(goalRows)
+		if err != nil {
+			return err
+		}
+		if err := visit(sync.EntityGoal, v); err != nil {
+			return err
 		}
-		opponentItems = append(opponentItems, v)
 	}
-
-	return sessionItems, setItems, opponentItems, nil
+	return goalRows.Err()
 }
 
+// UpsertUserStats overwrites the user's projection row and records it as the
+// history snapshot for the current day in the user's time zone, so the last
+// recompute of each day is kept.
 func (s *Store) UpsertUserStats(ctx context.Context, userID uuid.UUID, us stats.UserStats) error {
-	_, err := s.pool.Exec(ctx, `
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `
 		INSERT INTO user_stats (
 			user_id, total_sessions, total_matches, win_rate, avg_composure, avg_rushing_index,
-			avg_unforced_errors_per_min, improvement_slope_composure, improvement_slope_rushing, last_calculated_at
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+			avg_unforced_errors_per_min, improvement_slope_composure, improvement_slope_rushing, last_calculated_at,
+			calculator_version
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
 		ON CONFLICT (user_id)
 		DO UPDATE SET
+			calculator_version = EXCLUDED.calculator_version,
 			total_sessions = EXCLUDED.total_sessions,
 			total_matches = EXCLUDED.total_matches,
 			win_rate = EXCLUDED.win_rate,
@@ -420,59 +703,246 @@ func (s *Store) UpsertUserStats(ctx context.Context, userID uuid.UUID, us stats.
 			improvement_slope_rushing = EXCLUDED.improvement_slope_rushing,
 			last_calculated_at = EXCLUDED.last_calculated_at
 	`, userID, us.TotalSessions, us.TotalMatches, us.WinRate, us.AvgComposure, us.AvgRushingIndex,
-		us.AvgUnforcedErrorsPerMin, us.ImprovementSlopeComposure, us.ImprovementSlopeRushing, us.LastCalculatedAt)
-	return err
+		us.AvgUnforcedErrorsPerMin, us.ImprovementSlopeComposure, us.ImprovementSlopeRushing, us.LastCalculatedAt,
+		us.CalculatorVersion); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO user_stats_history (
+			user_id, snapshot_date, total_sessions, total_matches, win_rate, avg_composure, avg_rushing_index,
+			avg_unforced_errors_per_min, improvement_slope_composure, improvement_slope_rushing, calculator_version,
+			recorded_at
+		)
+		SELECT $1, ($10::timestamptz AT TIME ZONE COALESCE((SELECT timezone FROM users WHERE id = $1), 'UTC'))::date,
+		       $2,$3,$4,$5,$6,$7,$8,$9,$11,$10
+		ON CONFLICT (user_id, snapshot_date)
+		DO UPDATE SET
+			total_sessions = EXCLUDED.total_sessions,
+			total_matches = EXCLUDED.total_matches,
+			win_rate = EXCLUDED.win_rate,
+			avg_composure = EXCLUDED.avg_composure,
+			avg_rushing_index = EXCLUDED.avg_rushing_index,
+			avg_unforced_errors_per_min = EXCLUDED.avg_unforced_errors_per_min,
+			improvement_slope_composure = EXCLUDED.improvement_slope_composure,
+			improvement_slope_rushing = EXCLUDED.improvement_slope_rushing,
+			calculator_version = EXCLUDED.calculator_version,
+			recorded_at = EXCLUDED.recorded_at
+	`, userID, us.TotalSessions, us.TotalMatches, us.WinRate, us.AvgComposure, us.AvgRushingIndex,
+		us.AvgUnforcedErrorsPerMin, us.ImprovementSlopeComposure, us.ImprovementSlopeRushing, us.LastCalculatedAt,
+		us.CalculatorVersion); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ListUserStatsHistory returns the user's daily snapshots in ascending order,
+// limited to snapshot dates between from and to.
+func (s *Store) ListUserStatsHistory(ctx context.Context, userID uuid.UUID, from, to *time.Time) ([]stats.UserStatsSnapshot, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT snapshot_date, total_sessions, total_matches, win_rate, avg_composure, avg_rushing_index,
+		       avg_unforced_errors_per_min, improvement_slope_composure, improvement_slope_rushing,
+		       recorded_at, calculator_version
+		FROM user_stats_history
+		WHERE user_id = $1
+		  AND ($2::date IS NULL OR snapshot_date >= $2)
+		  AND ($3::date IS NULL OR snapshot_date <= $3)
+		ORDER BY snapshot_date ASC
+	`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]stats.UserStatsSnapshot, 0)
+	for rows.Next() {
+		var v stats.UserStatsSnapshot
+		if err := rows.Scan(
+			&v.Date, &v.TotalSessions, &v.TotalMatches, &v.WinRate, &v.AvgComposure, &v.AvgRushingIndex,
+			&v.AvgUnforcedErrorsPerMin, &v.ImprovementSlopeComposure, &v.ImprovementSlopeRushing,
+			&v.LastCalculatedAt, &v.CalculatorVersion,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, rows.Err()
 }
 
-func (s *Store) UpsertOpponentStats(ctx context.Context, opponentID uuid.UUID, v stats.OpponentStats) error {
-	_, err := s.pool.Exec(ctx, `
+func (s *Store) UpsertOpponentStats(ctx context.Context, userID, opponentID uuid.UUID, v stats.OpponentStats) error {
+	_, err := s.db.Exec(ctx, `
 		INSERT INTO opponent_stats (
-			opponent_id, matches_played, win_rate, avg_composure, avg_rushing_index, avg_set_differential, last_calculated_at
-		) VALUES ($1,$2,$3,$4,$5,$6,$7)
-		ON CONFLICT (opponent_id)
+			opponent_id, user_id, matches_played, win_rate, avg_composure, avg_rushing_index, avg_set_differential, last_calculated_at,
+			calculator_version
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+		ON CONFLICT (user_id, opponent_id)
 		DO UPDATE SET
+			calculator_version = EXCLUDED.calculator_version,
 			matches_played = EXCLUDED.matches_played,
 			win_rate = EXCLUDED.win_rate,
 			avg_composure = EXCLUDED.avg_composure,
 			avg_rushing_index = EXCLUDED.avg_rushing_index,
 			avg_set_differential = EXCLUDED.avg_set_differential,
 			last_calculated_at = EXCLUDED.last_calculated_at
-	`, opponentID, v.MatchesPlayed, v.WinRate, v.AvgComposure, v.AvgRushingIndex, v.AvgSetDifferential, v.LastCalculatedAt)
+	`, opponentID, userID, v.MatchesPlayed, v.WinRate, v.AvgComposure, v.AvgRushingIndex, v.AvgSetDifferential, v.LastCalculatedAt,
+		v.CalculatorVersion)
+	return err
+}
+
+func (s *Store) DeleteOpponentStats(ctx context.Context, userID, opponentID uuid.UUID) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM opponent_stats WHERE user_id = $1 AND opponent_id = $2`, userID, opponentID)
 	return err
 }
 
-func (s *Store) ReplaceWeeklyStats(ctx context.Context, userID uuid.UUID, rows []stats.WeeklyStats) error {
-	tx, err := s.pool.Begin(ctx)
+// DeleteOpponentStatsExcept removes the user's opponent_stats rows for every
+// opponent not in keep, i.e. opponents left without matches.
+func (s *Store) DeleteOpponentStatsExcept(ctx context.Context, userID uuid.UUID, keep []uuid.UUID) error {
+	_, err := s.db.Exec(ctx, `
+		DELETE FROM opponent_stats WHERE user_id = $1 AND NOT (opponent_id = ANY($2))
+	`, userID, keep)
+	return err
+}
+
+// periodTable names the projection table and start column of a granularity.
+type periodTable struct {
+	table  string
+	column string
+}
+
+var periodTables = map[string]periodTable{
+	stats.PeriodWeek:  {table: "weekly_stats", column: "week_start_date"},
+	stats.PeriodMonth: {table: "monthly_stats", column: "month_start_date"},
+	stats.PeriodYear:  {table: "yearly_stats", column: "year_start_date"},
+}
+
+func lookupPeriodTable(granularity string) (periodTable, error) {
+	t, ok := periodTables[granularity]
+	if !ok {
+		return periodTable{}, fmt.Errorf("unknown period granularity %q", granularity)
+	}
+	return t, nil
+}
+
+// ReplacePeriodStats swaps every row of the user's projection for the given
+// granularity with rows.
+func (s *Store) ReplacePeriodStats(ctx context.Context, userID uuid.UUID, granularity string, rows []stats.PeriodStats) error {
+	t, err := lookupPeriodTable(granularity)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	if _, err := tx.Exec(ctx, `DELETE FROM weekly_stats WHERE user_id = $1`, userID); err != nil {
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE user_id = $1`, t.table), userID); err != nil {
 		return err
 	}
+	txStore := &Store{pool: s.pool, db: tx}
 	for _, row := range rows {
-		if _, err := tx.Exec(ctx, `
-			INSERT INTO weekly_stats (user_id, week_start_date, avg_composure, avg_rushing_index, win_rate, matches_played)
-			VALUES ($1,$2,$3,$4,$5,$6)
-		`, userID, row.WeekStartDate, row.AvgComposure, row.AvgRushingIndex, row.WinRate, row.MatchesPlayed); err != nil {
+		if err := txStore.upsertPeriodStats(ctx, t, userID, row); err != nil {
 			return err
 		}
 	}
 	return tx.Commit(ctx)
 }
 
+func (s *Store) upsertPeriodStats(ctx context.Context, t periodTable, userID uuid.UUID, row stats.PeriodStats) error {
+	_, err := s.db.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %[1]s (user_id, %[2]s, sessions_played, avg_composure, avg_rushing_index, win_rate, matches_played, calculator_version)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		ON CONFLICT (user_id, %[2]s)
+		DO UPDATE SET
+			calculator_version = EXCLUDED.calculator_version,
+			sessions_played = EXCLUDED.sessions_played,
+			avg_composure = EXCLUDED.avg_composure,
+			avg_rushing_index = EXCLUDED.avg_rushing_index,
+			win_rate = EXCLUDED.win_rate,
+			matches_played = EXCLUDED.matches_played
+	`, t.table, t.column), userID, row.PeriodStartDate, row.SessionsPlayed, row.AvgComposure, row.AvgRushingIndex, row.WinRate, row.MatchesPlayed,
+		row.CalculatorVersion)
+	return err
+}
+
+func (s *Store) deletePeriodStats(ctx context.Context, t periodTable, userID uuid.UUID, start time.Time) error {
+	_, err := s.db.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE user_id = $1 AND %s = $2`, t.table, t.column), userID, start)
+	return err
+}
+
+// ListPeriodStats returns the user's projection rows for the granularity in
+// ascending order, limited to periods starting between from and to.
+func (s *Store) ListPeriodStats(ctx context.Context, userID uuid.UUID, granularity string, from, to *time.Time) ([]stats.PeriodStats, error) {
+	t, err := lookupPeriodTable(granularity)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, fmt.Sprintf(`
+		SELECT %[2]s, sessions_played, avg_composure, avg_rushing_index, win_rate, matches_played, calculator_version
+		FROM %[1]s
+		WHERE user_id = $1
+		  AND ($2::date IS NULL OR %[2]s >= $2)
+		  AND ($3::date IS NULL OR %[2]s <= $3)
+		ORDER BY %[2]s ASC
+	`, t.table, t.column), userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]stats.PeriodStats, 0)
+	for rows.Next() {
+		var v stats.PeriodStats
+		if err := rows.Scan(&v.PeriodStartDate, &v.SessionsPlayed, &v.AvgComposure, &v.AvgRushingIndex, &v.WinRate, &v.MatchesPlayed, &v.CalculatorVersion); err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, rows.Err()
+}
+
+// ListOutdatedProjectionUsers returns the users with any projection row
+// stamped with a calculator version older than version, plus users with
+// sessions that were never projected.
+func (s *Store) ListOutdatedProjectionUsers(ctx context.Context, version int) ([]uuid.UUID, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT user_id FROM user_stats WHERE calculator_version < $1
+		UNION SELECT user_id FROM opponent_stats WHERE calculator_version < $1
+		UNION SELECT user_id FROM weekly_stats WHERE calculator_version < $1
+		UNION SELECT user_id FROM monthly_stats WHERE calculator_version < $1
+		UNION SELECT user_id FROM yearly_stats WHERE calculator_version < $1
+		UNION SELECT user_id FROM projection_accumulators WHERE calculator_version < $1
+		UNION SELECT s.user_id FROM sessions s
+		WHERE s.deleted_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM user_stats u WHERE u.user_id = s.user_id)
+		ORDER BY user_id
+	`, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
 func (s *Store) GetUserStats(ctx context.Context, userID uuid.UUID) (stats.UserStats, error) {
 	var out stats.UserStats
-	err := s.pool.QueryRow(ctx, `
+	err := s.db.QueryRow(ctx, `
 		SELECT total_sessions, total_matches, win_rate, avg_composure, avg_rushing_index,
 		       avg_unforced_errors_per_min, improvement_slope_composure, improvement_slope_rushing,
-		       last_calculated_at
+		       last_calculated_at, calculator_version
 		FROM user_stats WHERE user_id = $1
 	`, userID).Scan(
 		&out.TotalSessions, &out.TotalMatches, &out.WinRate, &out.AvgComposure, &out.AvgRushingIndex,
 		&out.AvgUnforcedErrorsPerMin, &out.ImprovementSlopeComposure, &out.ImprovementSlopeRushing,
-		&out.LastCalculatedAt,
+		&out.LastCalculatedAt, &out.CalculatorVersion,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -488,7 +958,7 @@ func (s *Store) ListMatchSetsBySessionIDs(ctx context.Context, sessionIDs []uuid
 	if len(sessionIDs) == 0 {
 		return result, nil
 	}
-	rows, err := s.pool.Query(ctx, `
+	rows, err := s.db.Query(ctx, `
 		SELECT id, session_id, set_number, player_games, opponent_games, created_at, updated_at, deleted_at
 		FROM match_sets
 		WHERE session_id = ANY($1)
@@ -508,13 +978,14 @@ func (s *Store) ListMatchSetsBySessionIDs(ctx context.Context, sessionIDs []uuid
 	return result, rows.Err()
 }
 
-func (s *Store) GetOpponentStats(ctx context.Context, opponentID uuid.UUID) (stats.OpponentStats, error) {
+func (s *Store) GetOpponentStats(ctx context.Context, userID, opponentID uuid.UUID) (stats.OpponentStats, error) {
 	var out stats.OpponentStats
-	err := s.pool.QueryRow(ctx, `
-		SELECT matches_played, win_rate, avg_composure, avg_rushing_index, avg_set_differential, last_calculated_at
-		FROM opponent_stats WHERE opponent_id = $1
-	`, opponentID).Scan(
+	err := s.db.QueryRow(ctx, `
+		SELECT matches_played, win_rate, avg_composure, avg_rushing_index, avg_set_differential, last_calculated_at, calculator_version
+		FROM opponent_stats WHERE opponent_id = $1 AND user_id = $2
+	`, opponentID, userID).Scan(
 		&out.MatchesPlayed, &out.WinRate, &out.AvgComposure, &out.AvgRushingIndex, &out.AvgSetDifferential, &out.LastCalculatedAt,
+		&out.CalculatorVersion,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -525,9 +996,110 @@ func (s *Store) GetOpponentStats(ctx context.Context, opponentID uuid.UUID) (sta
 	return out, nil
 }
 
-func withIdentityKey(in opponents.Opponent) opponents.Opponent {
-	if strings.TrimSpace(in.IdentityKey) == "" {
-		in.IdentityKey = in.ID.String()
+func (s *Store) ListOpponentStatsByUser(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]stats.OpponentStats, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT opponent_id, matches_played, win_rate, avg_composure, avg_rushing_index, avg_set_differential, last_calculated_at, calculator_version
+		FROM opponent_stats WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
+
+	result := make(map[uuid.UUID]stats.OpponentStats)
+	for rows.Next() {
+		var id uuid.UUID
+		var v stats.OpponentStats
+		if err := rows.Scan(&id, &v.MatchesPlayed, &v.WinRate, &v.AvgComposure, &v.AvgRushingIndex, &v.AvgSetDifferential, &v.LastCalculatedAt, &v.CalculatorVersion); err != nil {
+			return nil, err
+		}
+		result[id] = v
+	}
+	return result, rows.Err()
+}
+
+func (s *Store) GetSession(ctx context.Context, userID, sessionID uuid.UUID) (sessions.Session, bool, error) {
+	var v sessions.Session
+	err := s.db.QueryRow(ctx, `
+		SELECT id, user_id, opponent_id, session_name, session_type, date, duration_minutes,
+		       rushed_shots, unforced_errors, long_rallies, direction_changes, composure,
+		       focus_text, followed_focus, is_match_win, notes, created_at, updated_at, deleted_at
+		FROM sessions WHERE id = $1 AND user_id = $2
+	`, sessionID, userID).Scan(
+		&v.ID, &v.UserID, &v.OpponentID, &v.SessionName, &v.SessionType, &v.Date, &v.DurationMinutes,
+		&v.RushedShots, &v.UnforcedErrors, &v.LongRallies, &v.DirectionChanges, &v.Composure,
+		&v.FocusText, &v.FollowedFocus, &v.IsMatchWin, &v.Notes, &v.CreatedAt, &v.UpdatedAt, &v.DeletedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return sessions.Session{}, false, nil
+		}
+		return sessions.Session{}, false, err
+	}
+	return v, true, nil
+}
+
+func (s *Store) GetOpponent(ctx context.Context, userID, opponentID uuid.UUID) (opponents.Opponent, bool, error) {
+	var v opponents.Opponent
+	err := s.db.QueryRow(ctx, `
+		SELECT id, identity_key, user_id, name, dominant_hand, play_style, notes, created_at, updated_at, deleted_at
+		FROM opponents WHERE id = $1 AND user_id = $2
+	`, opponentID, userID).Scan(&v.ID, &v.IdentityKey, &v.UserID, &v.Name, &v.DominantHand, &v.PlayStyle, &v.Notes, &v.CreatedAt, &v.UpdatedAt, &v.DeletedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return opponents.Opponent{}, false, nil
+		}
+		return opponents.Opponent{}, false, err
+	}
+	return v, true, nil
+}
+
+func (s *Store) FindOpponentIDByIdentityKey(ctx context.Context, userID uuid.UUID, identityKey string) (uuid.UUID, bool, error) {
+	var id uuid.UUID
+	err := s.db.QueryRow(ctx, `
+		SELECT id FROM opponents WHERE user_id = $1 AND identity_key = $2
+	`, userID, identityKey).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, false, nil
+		}
+		return uuid.Nil, false, err
+	}
+	return id, true, nil
+}
+
+// SaveOpponentAlias records that the user's opponent aliasID was merged into
+// canonicalID, so later pushes referencing aliasID resolve to it.
+func (s *Store) SaveOpponentAlias(ctx context.Context, userID, aliasID, canonicalID uuid.UUID) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO opponent_aliases (user_id, alias_id, canonical_id, created_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (user_id, alias_id)
+		DO UPDATE SET canonical_id = EXCLUDED.canonical_id
+	`, userID, aliasID, canonicalID)
+	return err
+}
+
+func (s *Store) FindOpponentAlias(ctx context.Context, userID, aliasID uuid.UUID) (uuid.UUID, bool, error) {
+	var id uuid.UUID
+	err := s.db.QueryRow(ctx, `
+		SELECT canonical_id FROM opponent_aliases WHERE user_id = $1 AND alias_id = $2
+	`, userID, aliasID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, false, nil
+		}
+		return uuid.Nil, false, err
+	}
+	return id, true, nil
+}
+
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func withIdentityKey(in opponents.Opponent) opponents.Opponent {
+	in.IdentityKey = sync.OpponentIdentityKey(in)
 	return in
 }
@@ -0,0 +1,195 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/lutefd/baseline-api/internal/domain/sync"
+)
+
+func (s *Store) RecordDevicePull(ctx context.Context, userID uuid.UUID, deviceID string, pulledAt time.Time) error {
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO sync_devices (user_id, device_id, last_pulled_at, created_at, updated_at)
+		VALUES ($1, $2, $3, now(), now())
+		ON CONFLICT (user_id, device_id)
+		DO UPDATE SET
+			last_pulled_at = GREATEST(COALESCE(sync_devices.last_pulled_at, EXCLUDED.last_pulled_at), EXCLUDED.last_pulled_at),
+			updated_at = now()
+	`, userID, deviceID, pulledAt)
+	return err
+}
+
+func (s *Store) GetTombstonesPurgedThrough(ctx context.Context, userID uuid.UUID) (*time.Time, error) {
+	var out *time.Time
+	err := s.db.QueryRow(ctx, `
+		SELECT tombstones_purged_through FROM users WHERE id = $1
+	`, userID).Scan(&out)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Store) ListUserIDs(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := s.db.Query(ctx, `SELECT id FROM users WHERE deleted_at IS NULL ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// PurgeTombstones hard-deletes rows soft-deleted before deletedBefore, but only
+// those the server received before every registered device of the user last
+// pulled. Users without registered devices keep every tombstone. A session is
+// kept while any of its match sets remain, so the cascade never removes sets
+// devices have not seen deleted. The newest purged received_at is recorded on
+// the user so stale pull cursors can be detected.
+func (s *Store) PurgeTombstones(ctx context.Context, userID uuid.UUID, deletedBefore time.Time) (sync.TombstonePurge, error) {
+	var out sync.TombstonePurge
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return out, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var neverPulled int
+	var horizon *time.Time
+	if err := tx.QueryRow(ctx, `
+		SELECT count(*) FILTER (WHERE last_pulled_at IS NULL), min(last_pulled_at)
+		FROM sync_devices WHERE user_id = $1
+	`, userID).Scan(&neverPulled, &horizon); err != nil {
+		return out, err
+	}
+	if neverPulled > 0 || horizon == nil {
+		return out, nil
+	}
+
+	var purgedThrough *time.Time
+	track := func(maxReceived *time.Time) {
+		if maxReceived != nil && (purgedThrough == nil || maxReceived.After(*purgedThrough)) {
+			purgedThrough = maxReceived
+		}
+	}
+
+	var maxReceived *time.Time
+	if err := tx.QueryRow(ctx, `
+		WITH purged AS (
+			DELETE FROM match_sets ms
+			USING sessions s
+			WHERE ms.session_id = s.id
+			  AND s.user_id = $1
+			  AND ms.deleted_at IS NOT NULL
+			  AND ms.deleted_at < $2
+			  AND ms.received_at < $3
+			RETURNING ms.received_at
+		)
+		SELECT count(*), max(received_at) FROM purged
+	`, userID, deletedBefore, horizon).Scan(&out.MatchSets, &maxReceived); err != nil {
+		return out, err
+	}
+	track(maxReceived)
+
+	if err := tx.QueryRow(ctx, `
+		WITH purged AS (
+			DELETE FROM sessions s
+			WHERE s.user_id = $1
+			  AND s.deleted_at IS NOT NULL
+			  AND s.deleted_at < $2
+			  AND s.received_at < $3
+			  AND NOT EXISTS (SELECT 1 FROM match_sets ms WHERE ms.session_id = s.id)
+			RETURNING s.received_at
+		)
+		SELECT count(*), max(received_at) FROM purged
+	`, userID, deletedBefore, horizon).Scan(&out.Sessions, &maxReceived); err != nil {
+		return out, err
+	}
+	track(maxReceived)
+
+	if err := tx.QueryRow(ctx, `
+		WITH purged AS (
+			DELETE FROM goals
+			WHERE user_id = $1
+			  AND deleted_at IS NOT NULL
+			  AND deleted_at < $2
+			  AND received_at < $3
+			RETURNING received_at
+		)
+		SELECT count(*), max(received_at) FROM purged
+	`, userID, deletedBefore, horizon).Scan(&out.Goals, &maxReceived); err != nil {
+		return out, err
+	}
+	track(maxReceived)
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM opponent_ratings r
+		USING opponents o
+		WHERE r.opponent_id = o.id
+		  AND o.user_id = $1
+		  AND o.deleted_at IS NOT NULL
+		  AND o.deleted_at < $2
+		  AND o.received_at < $3
+		  AND NOT EXISTS (SELECT 1 FROM sessions s WHERE s.opponent_id = o.id)
+		  AND NOT EXISTS (SELECT 1 FROM goals g WHERE g.opponent_id = o.id)
+	`, userID, deletedBefore, horizon); err != nil {
+		return out, err
+	}
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM opponent_stats os
+		USING opponents o
+		WHERE os.opponent_id = o.id
+		  AND o.user_id = $1
+		  AND o.deleted_at IS NOT NULL
+		  AND o.deleted_at < $2
+		  AND o.received_at < $3
+		  AND NOT EXISTS (SELECT 1 FROM sessions s WHERE s.opponent_id = o.id)
+		  AND NOT EXISTS (SELECT 1 FROM goals g WHERE g.opponent_id = o.id)
+	`, userID, deletedBefore, horizon); err != nil {
+		return out, err
+	}
+	if err := tx.QueryRow(ctx, `
+		WITH purged AS (
+			DELETE FROM opponents o
+			WHERE o.user_id = $1
+			  AND o.deleted_at IS NOT NULL
+			  AND o.deleted_at < $2
+			  AND o.received_at < $3
+			  AND NOT EXISTS (SELECT 1 FROM sessions s WHERE s.opponent_id = o.id)
+			  AND NOT EXISTS (SELECT 1 FROM goals g WHERE g.opponent_id = o.id)
+			RETURNING o.received_at
+		)
+		SELECT count(*), max(received_at) FROM purged
+	`, userID, deletedBefore, horizon).Scan(&out.Opponents, &maxReceived); err != nil {
+		return out, err
+	}
+	track(maxReceived)
+
+	if purgedThrough != nil {
+		if _, err := tx.Exec(ctx, `
+			UPDATE users
+			SET tombstones_purged_through = GREATEST(COALESCE(tombstones_purged_through, $2), $2),
+			    updated_at = now()
+			WHERE id = $1
+		`, userID, *purgedThrough); err != nil {
+			return out, err
+		}
+	}
+
+	return out, tx.Commit(ctx)
+}
@@ -0,0 +1,73 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sync"
+)
+
+type PendingStore interface {
+	ListUserIDs(ctx context.Context) ([]uuid.UUID, error)
+	ExpirePending(ctx context.Context, userID uuid.UUID, receivedBefore time.Time) ([]sync.PendingItem, error)
+}
+
+// PendingExpirer drops buffered children whose parent never arrived within
+// the retention. Every dropped item is logged.
+type PendingExpirer struct {
+	store     PendingStore
+	retention time.Duration
+	now       func() time.Time
+}
+
+func NewPendingExpirer(store PendingStore, retention time.Duration) *PendingExpirer {
+	return &PendingExpirer{store: store, retention: retention, now: time.Now}
+}
+
+func (e *PendingExpirer) ExpireOnce(ctx context.Context) (int, error) {
+	userIDs, err := e.store.ListUserIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := e.now().UTC().Add(-e.retention)
+	var total int
+	var errs []error
+	for _, userID := range userIDs {
+		expired, err := e.store.ExpirePending(ctx, userID, cutoff)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("expire pending for user %s: %w", userID, err))
+			continue
+		}
+		for _, item := range expired {
+			log.Printf("sync pending expired user=%s %s=%s waiting on %s=%s", userID, item.EntityType, item.ID, item.ParentType, item.ParentID)
+		}
+		total += len(expired)
+	}
+	return total, errors.Join(errs...)
+}
+
+func (e *PendingExpirer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := e.ExpireOnce(ctx)
+		if err != nil {
+			log.Printf("sync pending expiry: %v", err)
+		}
+		if expired > 0 {
+			log.Printf("sync pending expiry dropped %d items", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package syncer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sync"
+)
+
+type pendingStoreMock struct {
+	userIDs []uuid.UUID
+	expired map[uuid.UUID][]sync.PendingItem
+	cutoffs []time.Time
+}
+
+func (m *pendingStoreMock) ListUserIDs(_ context.Context) ([]uuid.UUID, error) {
+	return m.userIDs, nil
+}
+
+func (m *pendingStoreMock) ExpirePending(_ context.Context, userID uuid.UUID, receivedBefore time.Time) ([]sync.PendingItem, error) {
+	m.cutoffs = append(m.cutoffs, receivedBefore)
+	return m.expired[userID], nil
+}
+
+func TestExpireOnceCountsDroppedItems(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+	mock := &pendingStoreMock{
+		userIDs: []uuid.UUID{first, second},
+		expired: map[uuid.UUID][]sync.PendingItem{
+			first: {
+				{EntityType: sync.EntityMatchSet, ID: uuid.New(), ParentType: sync.EntitySession, ParentID: uuid.New()},
+				{EntityType: sync.EntitySession, ID: uuid.New(), ParentType: sync.EntityOpponent, ParentID: uuid.New()},
+			},
+		},
+	}
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	expirer := NewPendingExpirer(mock, 7*24*time.Hour)
+	expirer.now = func() time.Time { return now }
+
+	expired, err := expirer.ExpireOnce(context.Background())
+	if err != nil {
+		t.Fatalf("expire failed: %v", err)
+	}
+	if expired != 2 {
+		t.Fatalf("expected 2 expired items, got %d", expired)
+	}
+	want := time.Date(2026, 3, 24, 12, 0, 0, 0, time.UTC)
+	if len(mock.cutoffs) != 2 || !mock.cutoffs[0].Equal(want) {
+		t.Fatalf("expected cutoff %s for every user, got %v", want, mock.cutoffs)
+	}
+}
@@ -0,0 +1,548 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/goals"
+	"github.com/lutefd/baseline-api/internal/domain/opponents"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+	"github.com/lutefd/baseline-api/internal/domain/stats"
+	"github.com/lutefd/baseline-api/internal/domain/sync"
+)
+
+type Store interface {
+	GetOpponent(ctx context.Context, userID, opponentID uuid.UUID) (opponents.Opponent, bool, error)
+	GetSession(ctx context.Context, userID, sessionID uuid.UUID) (sessions.Session, bool, error)
+	FindOpponentIDByIdentityKey(ctx context.Context, userID uuid.UUID, identityKey string) (uuid.UUID, bool, error)
+	SaveOpponentAlias(ctx context.Context, userID, aliasID, canonicalID uuid.UUID) error
+	FindOpponentAlias(ctx context.Context, userID, aliasID uuid.UUID) (uuid.UUID, bool, error)
+	OpponentExists(ctx context.Context, userID, opponentID uuid.UUID) (bool, error)
+	SessionExists(ctx context.Context, userID, sessionID uuid.UUID) (bool, error)
+	UpsertOpponentByUpdatedAt(ctx context.Context, incoming opponents.Opponent) (sync.MergeDecision, error)
+	UpsertSessionByUpdatedAt(ctx context.Context, incoming sessions.Session) (sync.MergeDecision, error)
+	UpsertMatchSetByUpdatedAt(ctx context.Context, incoming sessions.MatchSet) (sync.MergeDecision, error)
+	UpsertGoalByUpdatedAt(ctx context.Context, incoming goals.Goal) (sync.MergeDecision, error)
+	SavePending(ctx context.Context, userID uuid.UUID, record sync.PendingRecord) error
+	ListPending(ctx context.Context, userID uuid.UUID) ([]sync.PendingRecord, error)
+	DeletePending(ctx context.Context, userID uuid.UUID, entityType sync.EntityType, id uuid.UUID) error
+	GetSessionStates(ctx context.Context, userID uuid.UUID, sessionIDs []uuid.UUID) (map[uuid.UUID]stats.SessionState, error)
+	GetMatchSetSessionID(ctx context.Context, matchSetID uuid.UUID) (uuid.UUID, bool, error)
+}
+
+// MaxTrackedSessions bounds how many sessions a batch keeps before and after
+// states for. Larger batches ask for a projection rebuild instead.
+const MaxTrackedSessions = 500
+
+// EventOpponentsChanged is recorded in the outbox when a write inserts or
+// updates opponents.
+const EventOpponentsChanged = "OpponentsChanged"
+
+type OpponentsChanged struct {
+	UserID      uuid.UUID   `json:"userId"`
+	OpponentIDs []uuid.UUID `json:"opponentIds"`
+}
+
+type Service struct {
+	store            Store
+	isUniqueConflict func(error) bool
+}
+
+func NewService(store Store, isUniqueConflict func(error) bool) *Service {
+	return &Service{store: store, isUniqueConflict: isUniqueConflict}
+}
+
+func (s *Service) Push(ctx context.Context, userID uuid.UUID, payload sync.PushRequest) (sync.PushResponse, error) {
+	_, response, err := s.Apply(ctx, userID, payload)
+	return response, err
+}
+
+// PushDetailed behaves like Push and additionally returns the merge decision
+// taken for every pushed or previously pending item, in application order.
+func (s *Service) PushDetailed(ctx context.Context, userID uuid.UUID, payload sync.PushRequest) (sync.PushResponse, []sync.ItemDecision, error) {
+	batch := s.Begin(userID, payload.ProtocolVersion)
+	batch.items = make([]sync.ItemDecision, 0)
+	response, err := batch.applyAll(ctx, payload)
+	return response, batch.items, err
+}
+
+// Apply pushes every item of payload through a new batch and finishes it. The
+// batch is returned so callers can read the resulting session changes.
+func (s *Service) Apply(ctx context.Context, userID uuid.UUID, payload sync.PushRequest) (*Batch, sync.PushResponse, error) {
+	batch := s.Begin(userID, payload.ProtocolVersion)
+	response, err := batch.applyAll(ctx, payload)
+	return batch, response, err
+}
+
+func (b *Batch) applyAll(ctx context.Context, payload sync.PushRequest) (sync.PushResponse, error) {
+	for _, item := range payload.Opponents {
+		if err := b.ApplyOpponent(ctx, item); err != nil {
+			return b.response, err
+		}
+	}
+	for _, item := range payload.Sessions {
+		if err := b.ApplySession(ctx, item); err != nil {
+			return b.response, err
+		}
+	}
+	for _, item := range payload.MatchSets {
+		if err := b.ApplyMatchSet(ctx, item); err != nil {
+			return b.response, err
+		}
+	}
+	for _, item := range payload.Goals {
+		if err := b.ApplyGoal(ctx, item); err != nil {
+			return b.response, err
+		}
+	}
+	return b.Finish(ctx)
+}
+
+// Batch applies one push item by item, so streamed payloads never need to be
+// held in memory. Children whose parent has not been applied yet are buffered
+// as pending and retried by Finish.
+type Batch struct {
+	svc     *Service
+	userID  uuid.UUID
+	version int
+	// opponentRemaps caches the persisted opponent aliases, mapping IDs
+	// without one to themselves.
+	opponentRemaps map[uuid.UUID]uuid.UUID
+	response       sync.PushResponse
+	// items is only kept for PushDetailed; streamed pushes stay O(1).
+	items []sync.ItemDecision
+
+	// before holds the state of every session the batch wrote or whose match
+	// sets it wrote, captured ahead of the first write; nil means it did not exist.
+	before  map[uuid.UUID]*stats.SessionState
+	touched []uuid.UUID
+	// overflow is set once the batch touched more than MaxTrackedSessions
+	// sessions; before and touched are then dropped.
+	overflow bool
+
+	changedOpponents []uuid.UUID
+}
+
+func (s *Service) Begin(userID uuid.UUID, protocolVersion int) *Batch {
+	if protocolVersion == 0 {
+		protocolVersion = sync.ProtocolVersionCurrent
+	}
+	return &Batch{
+		svc:            s,
+		userID:         userID,
+		version:        protocolVersion,
+		opponentRemaps: make(map[uuid.UUID]uuid.UUID),
+		response: sync.PushResponse{
+			OpponentIDRemaps: make([]sync.IDRemap, 0),
+			Pending:          make([]sync.PendingItem, 0),
+		},
+		before: make(map[uuid.UUID]*stats.SessionState),
+	}
+}
+
+func (b *Batch) ApplyOpponent(ctx context.Context, item opponents.Opponent) error {
+	item.UserID = b.userID
+	if err := item.Validate(); err != nil {
+		return &sync.ItemError{EntityType: sync.EntityOpponent, ID: item.ID, Err: err}
+	}
+	localID := item.ID
+	aliasID, err := b.resolveOpponent(ctx, localID)
+	if err != nil {
+		return err
+	}
+	item.ID = aliasID
+	if b.version < sync.ProtocolVersionCurrent {
+		stored, found, err := b.svc.store.GetOpponent(ctx, b.userID, item.ID)
+		if err != nil {
+			return err
+		}
+		if found {
+			item = sync.PreserveOpponentFields(item, stored, b.version)
+		}
+	}
+	canonicalID, decision, err := b.svc.upsertOpponentByIdentity(ctx, item)
+	if err != nil {
+		return itemError(sync.EntityOpponent, localID, err)
+	}
+	if canonicalID != localID {
+		if canonicalID != aliasID {
+			if err := b.svc.store.SaveOpponentAlias(ctx, b.userID, localID, canonicalID); err != nil {
+				return err
+			}
+		}
+		b.opponentRemaps[localID] = canonicalID
+		b.response.OpponentIDRemaps = append(b.response.OpponentIDRemaps, sync.IDRemap{From: localID, To: canonicalID})
+	}
+	applyCounts(&b.response.Opponents, decision)
+	b.record(sync.EntityOpponent, localID, decision)
+	if decision == sync.DecisionInsert || decision == sync.DecisionUpdate {
+		b.changedOpponents = append(b.changedOpponents, canonicalID)
+	}
+	return nil
+}
+
+func (b *Batch) ApplySession(ctx context.Context, item sessions.Session) error {
+	item.UserID = b.userID
+	if err := b.loadOpponentAlias(ctx, item.OpponentID); err != nil {
+		return err
+	}
+	item = sync.RemapSessionOpponent(item, b.opponentRemaps)
+	if b.version < sync.ProtocolVersionCurrent && len(sync.UnsupportedFields(sync.SessionFields, b.version)) > 0 {
+		stored, found, err := b.svc.store.GetSession(ctx, b.userID, item.ID)
+		if err != nil {
+			return err
+		}
+		if found {
+			if item, err = sync.PreserveSessionFields(item, stored, b.version); err != nil {
+				return err
+			}
+		}
+	}
+	if err := item.Validate(); err != nil {
+		return &sync.ItemError{EntityType: sync.EntitySession, ID: item.ID, Err: err}
+	}
+	decision, err := b.applySession(ctx, item)
+	if err != nil {
+		return itemError(sync.EntitySession, item.ID, err)
+	}
+	applyCounts(&b.response.Sessions, decision)
+	b.record(sync.EntitySession, item.ID, decision)
+	return nil
+}
+
+func (b *Batch) ApplyMatchSet(ctx context.Context, item sessions.MatchSet) error {
+	if err := item.Validate(); err != nil {
+		return &sync.ItemError{EntityType: sync.EntityMatchSet, ID: item.ID, Err: err}
+	}
+	decision, err := b.applyMatchSet(ctx, item)
+	if err != nil {
+		return itemError(sync.EntityMatchSet, item.ID, err)
+	}
+	applyCounts(&b.response.MatchSets, decision)
+	b.record(sync.EntityMatchSet, item.ID, decision)
+	return nil
+}
+
+func (b *Batch) ApplyGoal(ctx context.Context, item goals.Goal) error {
+	item.UserID = b.userID
+	if err := b.loadOpponentAlias(ctx, item.OpponentID); err != nil {
+		return err
+	}
+	item = sync.RemapGoalOpponent(item, b.opponentRemaps)
+	if err := item.Validate(); err != nil {
+		return &sync.ItemError{EntityType: sync.EntityGoal, ID: item.ID, Err: err}
+	}
+	decision, err := b.applyGoal(ctx, item)
+	if err != nil {
+		return itemError(sync.EntityGoal, item.ID, err)
+	}
+	applyCounts(&b.response.Goals, decision)
+	b.record(sync.EntityGoal, item.ID, decision)
+	return nil
+}
+
+func (b *Batch) Finish(ctx context.Context) (sync.PushResponse, error) {
+	remaining, err := b.drainPending(ctx)
+	if err != nil {
+		return b.response, err
+	}
+	for _, pending := range remaining {
+		b.response.Pending = append(b.response.Pending, pending.PendingItem)
+		switch pending.EntityType {
+		case sync.EntitySession:
+			b.response.Sessions.Pending++
+		case sync.EntityMatchSet:
+			b.response.MatchSets.Pending++
+		case sync.EntityGoal:
+			b.response.Goals.Pending++
+		}
+	}
+	return b.response, nil
+}
+
+// SessionChanges reports the before and after state of every session the
+// batch touched, for incremental projection updates. Call it after Finish. It
+// returns nil when RequiresRebuild is set.
+func (b *Batch) SessionChanges(ctx context.Context) ([]stats.SessionChange, error) {
+	if b.overflow {
+		return nil, nil
+	}
+	after, err := b.svc.store.GetSessionStates(ctx, b.userID, b.touched)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]stats.SessionChange, 0, len(b.touched))
+	for _, id := range b.touched {
+		change := stats.SessionChange{Before: b.before[id]}
+		if state, ok := after[id]; ok {
+			change.After = &state
+		}
+		if change.Before == nil && change.After == nil {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// RequiresRebuild reports whether the batch touched too many sessions to track
+// their changes, so projections need a full rebuild.
+func (b *Batch) RequiresRebuild() bool {
+	return b.overflow
+}
+
+// ChangedOpponentIDs lists the stored opponent IDs the batch inserted or updated.
+func (b *Batch) ChangedOpponentIDs() []uuid.UUID {
+	return b.changedOpponents
+}
+
+// capture records the current state of sessions the batch is about to write,
+// once per session, so SessionChanges can diff it against the final state.
+func (b *Batch) capture(ctx context.Context, sessionIDs ...uuid.UUID) error {
+	if b.overflow {
+		return nil
+	}
+	missing := make([]uuid.UUID, 0, len(sessionIDs))
+	for _, id := range sessionIDs {
+		if _, ok := b.before[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if len(b.touched)+len(missing) > MaxTrackedSessions {
+		b.overflow = true
+		b.before, b.touched = nil, nil
+		return nil
+	}
+	states, err := b.svc.store.GetSessionStates(ctx, b.userID, missing)
+	if err != nil {
+		return err
+	}
+	for _, id := range missing {
+		if _, ok := b.before[id]; ok {
+			continue
+		}
+		var before *stats.SessionState
+		if state, ok := states[id]; ok {
+			before = &state
+		}
+		b.before[id] = before
+		b.touched = append(b.touched, id)
+	}
+	return nil
+}
+
+func (b *Batch) record(entityType sync.EntityType, id uuid.UUID, decision sync.MergeDecision) {
+	if b.items == nil {
+		return
+	}
+	b.items = append(b.items, sync.ItemDecision{EntityType: entityType, ID: id, Decision: decision})
+}
+
+// upsertOpponentByIdentity merges an incoming opponent into the stored row that
+// already owns its identity key, so two devices that created the same opponent
+// under different IDs converge on the first ID the server saw. A concurrent
+// insert of the same key surfaces as a unique violation and is retried once
+// against the now-visible canonical row.
+func (s *Service) upsertOpponentByIdentity(ctx context.Context, item opponents.Opponent) (uuid.UUID, sync.MergeDecision, error) {
+	item.IdentityKey = sync.OpponentIdentityKey(item)
+	for attempt := 0; ; attempt++ {
+		canonicalID, found, err := s.store.FindOpponentIDByIdentityKey(ctx, item.UserID, item.IdentityKey)
+		if err != nil {
+			return item.ID, sync.DecisionIgnore, err
+		}
+		if found {
+			item.ID = canonicalID
+		}
+		decision, err := s.store.UpsertOpponentByUpdatedAt(ctx, item)
+		if err != nil && attempt == 0 && s.isUniqueConflict != nil && s.isUniqueConflict(err) {
+			continue
+		}
+		return item.ID, decision, err
+	}
+}
+
+// resolveOpponent returns the canonical ID an opponent ID was merged into by
+// an earlier push, or id itself.
+func (b *Batch) resolveOpponent(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	if canonical, ok := b.opponentRemaps[id]; ok {
+		return canonical, nil
+	}
+	canonical, found, err := b.svc.store.FindOpponentAlias(ctx, b.userID, id)
+	if err != nil {
+		return id, err
+	}
+	if !found {
+		canonical = id
+	}
+	b.opponentRemaps[id] = canonical
+	return canonical, nil
+}
+
+func (b *Batch) loadOpponentAlias(ctx context.Context, id *uuid.UUID) error {
+	if id == nil {
+		return nil
+	}
+	_, err := b.resolveOpponent(ctx, *id)
+	return err
+}
+
+func (b *Batch) applySession(ctx context.Context, item sessions.Session) (sync.MergeDecision, error) {
+	if item.OpponentID != nil {
+		exists, err := b.svc.store.OpponentExists(ctx, b.userID, *item.OpponentID)
+		if err != nil {
+			return sync.DecisionIgnore, err
+		}
+		if !exists {
+			return sync.DecisionPending, b.svc.store.SavePending(ctx, b.userID, sync.PendingSession(item))
+		}
+	}
+	return b.upsertSession(ctx, item)
+}
+
+func (b *Batch) applyMatchSet(ctx context.Context, item sessions.MatchSet) (sync.MergeDecision, error) {
+	exists, err := b.svc.store.SessionExists(ctx, b.userID, item.SessionID)
+	if err != nil {
+		return sync.DecisionIgnore, err
+	}
+	if !exists {
+		return sync.DecisionPending, b.svc.store.SavePending(ctx, b.userID, sync.PendingMatchSet(item))
+	}
+	return b.upsertMatchSet(ctx, item)
+}
+
+func (b *Batch) applyGoal(ctx context.Context, item goals.Goal) (sync.MergeDecision, error) {
+	if item.OpponentID != nil {
+		exists, err := b.svc.store.OpponentExists(ctx, b.userID, *item.OpponentID)
+		if err != nil {
+			return sync.DecisionIgnore, err
+		}
+		if !exists {
+			return sync.DecisionPending, b.svc.store.SavePending(ctx, b.userID, sync.PendingGoal(item))
+		}
+	}
+	return b.svc.store.UpsertGoalByUpdatedAt(ctx, item)
+}
+
+func (b *Batch) upsertSession(ctx context.Context, item sessions.Session) (sync.MergeDecision, error) {
+	if err := b.capture(ctx, item.ID); err != nil {
+		return sync.DecisionIgnore, err
+	}
+	return b.svc.store.UpsertSessionByUpdatedAt(ctx, item)
+}
+
+// upsertMatchSet captures both the target session and, when the set is being
+// moved, the session that held it before, since both set differentials change.
+func (b *Batch) upsertMatchSet(ctx context.Context, item sessions.MatchSet) (sync.MergeDecision, error) {
+	ids := []uuid.UUID{item.SessionID}
+	previous, found, err := b.svc.store.GetMatchSetSessionID(ctx, item.ID)
+	if err != nil {
+		return sync.DecisionIgnore, err
+	}
+	if found && previous != item.SessionID {
+		ids = append(ids, previous)
+	}
+	if err := b.capture(ctx, ids...); err != nil {
+		return sync.DecisionIgnore, err
+	}
+	return b.svc.store.UpsertMatchSetByUpdatedAt(ctx, item)
+}
+
+// drainPending retries buffered children until a full pass makes no progress,
+// so a session released by its opponent can in turn release its match sets.
+func (b *Batch) drainPending(ctx context.Context) ([]sync.PendingRecord, error) {
+	records, err := b.svc.store.ListPending(ctx, b.userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for progressed := true; progressed && len(records) > 0; {
+		progressed = false
+		remaining := records[:0]
+		for _, pending := range records {
+			decision, err := b.retryPending(ctx, pending)
+			if err != nil {
+				return nil, itemError(pending.EntityType, pending.ID, err)
+			}
+			if decision == sync.DecisionPending {
+				remaining = append(remaining, pending)
+				continue
+			}
+			if err := b.svc.store.DeletePending(ctx, b.userID, pending.EntityType, pending.ID); err != nil {
+				return nil, err
+			}
+			progressed = true
+			b.record(pending.EntityType, pending.ID, decision)
+			switch pending.EntityType {
+			case sync.EntitySession:
+				applyCounts(&b.response.Sessions, decision)
+			case sync.EntityMatchSet:
+				applyCounts(&b.response.MatchSets, decision)
+			case sync.EntityGoal:
+				applyCounts(&b.response.Goals, decision)
+			}
+		}
+		records = remaining
+	}
+	return records, nil
+}
+
+func (b *Batch) retryPending(ctx context.Context, record sync.PendingRecord) (sync.MergeDecision, error) {
+	switch {
+	case record.Session != nil:
+		if err := b.loadOpponentAlias(ctx, record.Session.OpponentID); err != nil {
+			return sync.DecisionPending, err
+		}
+		item := sync.RemapSessionOpponent(*record.Session, b.opponentRemaps)
+		item.UserID = b.userID
+		if item.OpponentID != nil {
+			exists, err := b.svc.store.OpponentExists(ctx, b.userID, *item.OpponentID)
+			if err != nil || !exists {
+				return sync.DecisionPending, err
+			}
+		}
+		return b.upsertSession(ctx, item)
+	case record.MatchSet != nil:
+		exists, err := b.svc.store.SessionExists(ctx, b.userID, record.MatchSet.SessionID)
+		if err != nil || !exists {
+			return sync.DecisionPending, err
+		}
+		return b.upsertMatchSet(ctx, *record.MatchSet)
+	case record.Goal != nil:
+		if err := b.loadOpponentAlias(ctx, record.Goal.OpponentID); err != nil {
+			return sync.DecisionPending, err
+		}
+		item := sync.RemapGoalOpponent(*record.Goal, b.opponentRemaps)
+		item.UserID = b.userID
+		exists, err := b.svc.store.OpponentExists(ctx, b.userID, *item.OpponentID)
+		if err != nil || !exists {
+			return sync.DecisionPending, err
+		}
+		return b.svc.store.UpsertGoalByUpdatedAt(ctx, item)
+	default:
+		return sync.DecisionPending, nil
+	}
+}
+
+func itemError(entityType sync.EntityType, id uuid.UUID, err error) error {
+	if errors.Is(err, sync.ErrForeignOwner) {
+		return &sync.ItemError{EntityType: entityType, ID: id, Err: err}
+	}
+	return err
+}
+
+func applyCounts(c *sync.EntityCounts, d sync.MergeDecision) {
+	switch d {
+	case sync.DecisionInsert:
+		c.Inserted++
+	case sync.DecisionUpdate:
+		c.Updated++
+	case sync.DecisionPending:
+		// Reported from the records still pending once the push has drained.
+	default:
+		c.Ignored++
+	}
+}
@@ -0,0 +1,447 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/goals"
+	"github.com/lutefd/baseline-api/internal/domain/opponents"
+	"github.com/lutefd/baseline-api/internal/domain/sessions"
+	"github.com/lutefd/baseline-api/internal/domain/stats"
+	"github.com/lutefd/baseline-api/internal/domain/sync"
+)
+
+type pendingKey struct {
+	entityType sync.EntityType
+	id         uuid.UUID
+}
+
+type syncStoreMock struct {
+	opponents map[uuid.UUID]opponents.Opponent
+	sessions  map[uuid.UUID]sessions.Session
+	matchSets map[uuid.UUID]sessions.MatchSet
+	goals     map[uuid.UUID]goals.Goal
+	pending   map[pendingKey]sync.PendingRecord
+	order     []pendingKey
+	aliases   map[uuid.UUID]uuid.UUID
+}
+
+func newSyncStoreMock() *syncStoreMock {
+	return &syncStoreMock{
+		opponents: map[uuid.UUID]opponents.Opponent{},
+		sessions:  map[uuid.UUID]sessions.Session{},
+		matchSets: map[uuid.UUID]sessions.MatchSet{},
+		goals:     map[uuid.UUID]goals.Goal{},
+		pending:   map[pendingKey]sync.PendingRecord{},
+		aliases:   map[uuid.UUID]uuid.UUID{},
+	}
+}
+
+func (m *syncStoreMock) GetOpponent(_ context.Context, _ uuid.UUID, opponentID uuid.UUID) (opponents.Opponent, bool, error) {
+	item, ok := m.opponents[opponentID]
+	return item, ok, nil
+}
+
+func (m *syncStoreMock) GetSession(_ context.Context, _ uuid.UUID, sessionID uuid.UUID) (sessions.Session, bool, error) {
+	item, ok := m.sessions[sessionID]
+	return item, ok, nil
+}
+
+func (m *syncStoreMock) FindOpponentIDByIdentityKey(_ context.Context, userID uuid.UUID, identityKey string) (uuid.UUID, bool, error) {
+	for _, item := range m.opponents {
+		if item.UserID == userID && item.IdentityKey == identityKey {
+			return item.ID, true, nil
+		}
+	}
+	return uuid.Nil, false, nil
+}
+
+func (m *syncStoreMock) SaveOpponentAlias(_ context.Context, _, aliasID, canonicalID uuid.UUID) error {
+	m.aliases[aliasID] = canonicalID
+	return nil
+}
+
+func (m *syncStoreMock) FindOpponentAlias(_ context.Context, _, aliasID uuid.UUID) (uuid.UUID, bool, error) {
+	id, ok := m.aliases[aliasID]
+	return id, ok, nil
+}
+
+func (m *syncStoreMock) OpponentExists(_ context.Context, _ uuid.UUID, opponentID uuid.UUID) (bool, error) {
+	_, ok := m.opponents[opponentID]
+	return ok, nil
+}
+
+func (m *syncStoreMock) SessionExists(_ context.Context, _ uuid.UUID, sessionID uuid.UUID) (bool, error) {
+	_, ok := m.sessions[sessionID]
+	return ok, nil
+}
+
+func (m *syncStoreMock) UpsertOpponentByUpdatedAt(_ context.Context, incoming opponents.Opponent) (sync.MergeDecision, error) {
+	stored, ok := m.opponents[incoming.ID]
+	decision := sync.ResolveByUpdatedAt(incoming.UpdatedAt, stored.UpdatedAt, incoming.DeletedAt, stored.DeletedAt)
+	if !ok || decision == sync.DecisionUpdate {
+		m.opponents[incoming.ID] = incoming
+	}
+	return decision, nil
+}
+
+func (m *syncStoreMock) UpsertSessionByUpdatedAt(_ context.Context, incoming sessions.Session) (sync.MergeDecision, error) {
+	stored, ok := m.sessions[incoming.ID]
+	decision := sync.ResolveByUpdatedAt(incoming.UpdatedAt, stored.UpdatedAt, incoming.DeletedAt, stored.DeletedAt)
+	if !ok || decision == sync.DecisionUpdate {
+		m.sessions[incoming.ID] = incoming
+	}
+	return decision, nil
+}
+
+func (m *syncStoreMock) UpsertMatchSetByUpdatedAt(_ context.Context, incoming sessions.MatchSet) (sync.MergeDecision, error) {
+	stored, ok := m.matchSets[incoming.ID]
+	decision := sync.ResolveByUpdatedAt(incoming.UpdatedAt, stored.UpdatedAt, incoming.DeletedAt, stored.DeletedAt)
+	if !ok || decision == sync.DecisionUpdate {
+		m.matchSets[incoming.ID] = incoming
+	}
+	return decision, nil
+}
+
+func (m *syncStoreMock) UpsertGoalByUpdatedAt(_ context.Context, incoming goals.Goal) (sync.MergeDecision, error) {
+	stored, ok := m.goals[incoming.ID]
+	decision := sync.ResolveByUpdatedAt(incoming.UpdatedAt, stored.UpdatedAt, incoming.DeletedAt, stored.DeletedAt)
+	if !ok || decision == sync.DecisionUpdate {
+		m.goals[incoming.ID] = incoming
+	}
+	return decision, nil
+}
+
+func (m *syncStoreMock) SavePending(_ context.Context, _ uuid.UUID, record sync.PendingRecord) error {
+	key := pendingKey{entityType: record.EntityType, id: record.ID}
+	if _, ok := m.pending[key]; !ok {
+		m.order = append(m.order, key)
+	}
+	m.pending[key] = record
+	return nil
+}
+
+func (m *syncStoreMock) ListPending(_ context.Context, _ uuid.UUID) ([]sync.PendingRecord, error) {
+	out := make([]sync.PendingRecord, 0, len(m.pending))
+	for _, key := range m.order {
+		if record, ok := m.pending[key]; ok {
+			out = append(out, record)
+		}
+	}
+	return out, nil
+}
+
+func (m *syncStoreMock) DeletePending(_ context.Context, _ uuid.UUID, entityType sync.EntityType, id uuid.UUID) error {
+	delete(m.pending, pendingKey{entityType: entityType, id: id})
+	return nil
+}
+
+func (m *syncStoreMock) GetSessionStates(_ context.Context, _ uuid.UUID, sessionIDs []uuid.UUID) (map[uuid.UUID]stats.SessionState, error) {
+	out := make(map[uuid.UUID]stats.SessionState)
+	for _, id := range sessionIDs {
+		session, ok := m.sessions[id]
+		if !ok {
+			continue
+		}
+		var sets []sessions.MatchSet
+		for _, set := range m.matchSets {
+			if set.SessionID == id {
+				sets = append(sets, set)
+			}
+		}
+		out[id] = stats.SessionState{Session: session, SetDifferential: stats.SetDifferential(sets)}
+	}
+	return out, nil
+}
+
+func (m *syncStoreMock) GetMatchSetSessionID(_ context.Context, matchSetID uuid.UUID) (uuid.UUID, bool, error) {
+	set, ok := m.matchSets[matchSetID]
+	return set.SessionID, ok, nil
+}
+
+func TestBatchSessionChangesReportsBeforeAndAfter(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	store := newSyncStoreMock()
+	existing := sessions.Session{ID: uuid.New(), UserID: userID, SessionType: "match", Date: now, DurationMinutes: 60, Composure: 5, UpdatedAt: now.Add(-time.Hour)}
+	store.sessions[existing.ID] = existing
+	svc := NewService(store, nil)
+
+	updated := existing
+	updated.Composure = 9
+	updated.UpdatedAt = now
+	batch, _, err := svc.Apply(ctx, userID, sync.PushRequest{
+		Sessions:  []sessions.Session{updated},
+		MatchSets: []sessions.MatchSet{{ID: uuid.New(), SessionID: existing.ID, SetNumber: 1, PlayerGames: 6, OpponentGames: 3, UpdatedAt: now}},
+	})
+	if err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+
+	changes, err := batch.SessionChanges(ctx)
+	if err != nil {
+		t.Fatalf("session changes failed: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected one change per touched session, got %d", len(changes))
+	}
+	change := changes[0]
+	if change.Before == nil || change.Before.Session.Composure != 5 || change.Before.SetDifferential != 0 {
+		t.Fatalf("unexpected before state: %+v", change.Before)
+	}
+	if change.After == nil || change.After.Session.Composure != 9 || change.After.SetDifferential != 3 {
+		t.Fatalf("unexpected after state: %+v", change.After)
+	}
+}
+
+func TestLargeBatchAsksForRebuild(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	items := make([]sessions.Session, 0, MaxTrackedSessions+1)
+	for i := 0; i <= MaxTrackedSessions; i++ {
+		items = append(items, sessions.Session{ID: uuid.New(), SessionType: "class", Date: now, DurationMinutes: 60, Composure: 5, UpdatedAt: now})
+	}
+	batch, response, err := NewService(newSyncStoreMock(), nil).Apply(ctx, userID, sync.PushRequest{Sessions: items})
+	if err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	if response.Sessions.Inserted != len(items) || !batch.RequiresRebuild() {
+		t.Fatalf("expected every session applied and a rebuild requested, got %+v", response.Sessions)
+	}
+	if changes, err := batch.SessionChanges(ctx); err != nil || changes != nil {
+		t.Fatalf("expected no tracked changes, got %d (%v)", len(changes), err)
+	}
+}
+
+func TestPushBuffersOrphansUntilParentArrives(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	opponentID := uuid.New()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	session := sessions.Session{ID: uuid.New(), OpponentID: &opponentID, SessionType: "match", Date: now, DurationMinutes: 60, Composure: 7, UpdatedAt: now}
+	set := sessions.MatchSet{ID: uuid.New(), SessionID: session.ID, SetNumber: 1, UpdatedAt: now}
+
+	store := newSyncStoreMock()
+	svc := NewService(store, nil)
+
+	first, err := svc.Push(ctx, userID, sync.PushRequest{
+		Sessions:  []sessions.Session{session},
+		MatchSets: []sessions.MatchSet{set},
+	})
+	if err != nil {
+		t.Fatalf("first push failed: %v", err)
+	}
+	if first.Sessions.Pending != 1 || first.MatchSets.Pending != 1 {
+		t.Fatalf("expected session and set to be pending, got %+v / %+v", first.Sessions, first.MatchSets)
+	}
+	if len(first.Pending) != 2 {
+		t.Fatalf("expected 2 pending items, got %d", len(first.Pending))
+	}
+	if len(store.sessions) != 0 || len(store.matchSets) != 0 {
+		t.Fatalf("orphans must not be written before their parent")
+	}
+
+	second, err := svc.Push(ctx, userID, sync.PushRequest{
+		Opponents: []opponents.Opponent{{ID: opponentID, Name: "Rival", UpdatedAt: now}},
+	})
+	if err != nil {
+		t.Fatalf("second push failed: %v", err)
+	}
+	if second.Sessions.Inserted != 1 || second.MatchSets.Inserted != 1 {
+		t.Fatalf("expected pending children to be applied, got %+v / %+v", second.Sessions, second.MatchSets)
+	}
+	if len(second.Pending) != 0 || len(store.pending) != 0 {
+		t.Fatalf("expected pending buffer to be drained")
+	}
+}
+
+func TestPushBuffersGoalUntilOpponentArrives(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	canonicalID := uuid.New()
+	localID := uuid.New()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	store := newSyncStoreMock()
+	store.opponents[canonicalID] = opponents.Opponent{ID: canonicalID, UserID: userID, IdentityKey: "club:rival", UpdatedAt: now.Add(-time.Hour)}
+	svc := NewService(store, nil)
+
+	goal := goals.Goal{
+		ID: uuid.New(), Title: "Beat the rival", Metric: "win", Comparator: goals.ComparatorGTE, Target: 0.5,
+		OpponentID: &localID, StartsAt: now, UpdatedAt: now,
+	}
+	first, err := svc.Push(ctx, userID, sync.PushRequest{Goals: []goals.Goal{goal}})
+	if err != nil {
+		t.Fatalf("first push failed: %v", err)
+	}
+	if first.Goals.Pending != 1 || len(store.goals) != 0 {
+		t.Fatalf("expected the goal to wait for its opponent, got %+v", first.Goals)
+	}
+
+	second, err := svc.Push(ctx, userID, sync.PushRequest{
+		Opponents: []opponents.Opponent{{ID: localID, IdentityKey: "club:rival", Name: "Rival", UpdatedAt: now}},
+	})
+	if err != nil {
+		t.Fatalf("second push failed: %v", err)
+	}
+	if second.Goals.Inserted != 1 || len(store.pending) != 0 {
+		t.Fatalf("expected the pending goal to be applied, got %+v", second.Goals)
+	}
+	stored := store.goals[goal.ID]
+	if stored.OpponentID == nil || *stored.OpponentID != canonicalID || stored.UserID != userID {
+		t.Fatalf("expected the goal opponent to be remapped to the canonical id, got %+v", stored)
+	}
+}
+
+func TestPushRemapsOpponentWithExistingIdentityKey(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	canonicalID := uuid.New()
+	localID := uuid.New()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	store := newSyncStoreMock()
+	store.opponents[canonicalID] = opponents.Opponent{ID: canonicalID, UserID: userID, IdentityKey: "club:rival", UpdatedAt: now.Add(-time.Hour)}
+	svc := NewService(store, nil)
+
+	session := sessions.Session{ID: uuid.New(), OpponentID: &localID, SessionType: "match", Date: now, DurationMinutes: 60, Composure: 7, UpdatedAt: now}
+	response, err := svc.Push(ctx, userID, sync.PushRequest{
+		Opponents: []opponents.Opponent{{ID: localID, IdentityKey: "club:rival", Name: "Rival", UpdatedAt: now}},
+		Sessions:  []sessions.Session{session},
+	})
+	if err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	if len(response.OpponentIDRemaps) != 1 || response.OpponentIDRemaps[0].From != localID || response.OpponentIDRemaps[0].To != canonicalID {
+		t.Fatalf("unexpected remaps: %+v", response.OpponentIDRemaps)
+	}
+	if response.Opponents.Updated != 1 {
+		t.Fatalf("expected canonical opponent to be updated, got %+v", response.Opponents)
+	}
+	if _, ok := store.opponents[localID]; ok {
+		t.Fatalf("duplicate opponent must not be inserted")
+	}
+	stored := store.sessions[session.ID]
+	if stored.OpponentID == nil || *stored.OpponentID != canonicalID {
+		t.Fatalf("expected session opponent to be remapped to canonical id")
+	}
+}
+
+func TestLaterPushesResolvePersistedOpponentAliases(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	canonicalID := uuid.New()
+	localID := uuid.New()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	store := newSyncStoreMock()
+	store.opponents[canonicalID] = opponents.Opponent{ID: canonicalID, UserID: userID, IdentityKey: "club:rival", UpdatedAt: now.Add(-time.Hour)}
+	svc := NewService(store, nil)
+	if _, err := svc.Push(ctx, userID, sync.PushRequest{
+		Opponents: []opponents.Opponent{{ID: localID, IdentityKey: "club:rival", Name: "Rival", UpdatedAt: now}},
+	}); err != nil {
+		t.Fatalf("first push failed: %v", err)
+	}
+	if store.aliases[localID] != canonicalID {
+		t.Fatalf("expected the alias to be persisted, got %v", store.aliases)
+	}
+
+	session := sessions.Session{ID: uuid.New(), OpponentID: &localID, SessionType: "match", Date: now, DurationMinutes: 60, Composure: 7, UpdatedAt: now}
+	goalOpponent := localID
+	goal := goals.Goal{
+		ID: uuid.New(), Title: "Beat the rival", Metric: "win", Comparator: goals.ComparatorGTE, Target: 0.5,
+		OpponentID: &goalOpponent, StartsAt: now, UpdatedAt: now,
+	}
+	response, err := svc.Push(ctx, userID, sync.PushRequest{Sessions: []sessions.Session{session}, Goals: []goals.Goal{goal}})
+	if err != nil {
+		t.Fatalf("second push failed: %v", err)
+	}
+	if response.Sessions.Inserted != 1 || response.Goals.Inserted != 1 || len(response.Pending) != 0 {
+		t.Fatalf("expected children of the alias to be applied, got %+v", response)
+	}
+	if stored := store.sessions[session.ID]; stored.OpponentID == nil || *stored.OpponentID != canonicalID {
+		t.Fatalf("expected the session to reference the canonical opponent")
+	}
+	if stored := store.goals[goal.ID]; stored.OpponentID == nil || *stored.OpponentID != canonicalID {
+		t.Fatalf("expected the goal to reference the canonical opponent")
+	}
+}
+
+func TestPushDetailedRejectsInvalidItems(t *testing.T) {
+	store := newSyncStoreMock()
+	svc := NewService(store, nil)
+
+	_, _, err := svc.PushDetailed(context.Background(), uuid.New(), sync.PushRequest{
+		Sessions: []sessions.Session{{ID: uuid.New(), SessionType: "match", Date: time.Now(), DurationMinutes: 60, Composure: 12}},
+	})
+	var itemErr *sync.ItemError
+	if !errors.As(err, &itemErr) || itemErr.EntityType != sync.EntitySession {
+		t.Fatalf("expected session item error, got %v", err)
+	}
+	if len(store.sessions) != 0 {
+		t.Fatalf("invalid session must not be written")
+	}
+}
+
+func TestPushFromLegacyClientKeepsStoredIdentityKey(t *testing.T) {
+	userID := uuid.New()
+	opponentID := uuid.New()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	store := newSyncStoreMock()
+	store.opponents[opponentID] = opponents.Opponent{ID: opponentID, UserID: userID, IdentityKey: "club:rival", Name: "Rival", UpdatedAt: now.Add(-time.Hour)}
+	svc := NewService(store, nil)
+
+	_, err := svc.Push(context.Background(), userID, sync.PushRequest{
+		Opponents:       []opponents.Opponent{{ID: opponentID, Name: "Rival Renamed", UpdatedAt: now}},
+		ProtocolVersion: sync.ProtocolVersionLegacy,
+	})
+	if err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	stored := store.opponents[opponentID]
+	if stored.Name != "Rival Renamed" {
+		t.Fatalf("expected name update to apply, got %q", stored.Name)
+	}
+	if stored.IdentityKey != "club:rival" {
+		t.Fatalf("expected identity key to be preserved, got %q", stored.IdentityKey)
+	}
+}
+
+func TestPushFromLegacyClientKeepsNewerSessionFields(t *testing.T) {
+	registered := sync.SessionFields
+	sync.SessionFields = []sync.FieldSpec{{Name: "notes", Since: 2}}
+	t.Cleanup(func() { sync.SessionFields = registered })
+
+	userID := uuid.New()
+	sessionID := uuid.New()
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	notes := "written by a v2 client"
+
+	store := newSyncStoreMock()
+	store.sessions[sessionID] = sessions.Session{ID: sessionID, UserID: userID, SessionType: "class", Date: now, DurationMinutes: 60, Composure: 5, Notes: &notes, UpdatedAt: now.Add(-time.Hour)}
+	svc := NewService(store, nil)
+
+	_, err := svc.Push(context.Background(), userID, sync.PushRequest{
+		Sessions:        []sessions.Session{{ID: sessionID, SessionType: "class", Date: now, DurationMinutes: 60, Composure: 8, UpdatedAt: now}},
+		ProtocolVersion: sync.ProtocolVersionLegacy,
+	})
+	if err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	stored := store.sessions[sessionID]
+	if stored.Composure != 8 {
+		t.Fatalf("expected composure update to apply, got %d", stored.Composure)
+	}
+	if stored.Notes == nil || *stored.Notes != notes {
+		t.Fatalf("expected notes to be preserved, got %v", stored.Notes)
+	}
+}
@@ -0,0 +1,68 @@
+package tombstones
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sync"
+)
+
+type Store interface {
+	ListUserIDs(ctx context.Context) ([]uuid.UUID, error)
+	PurgeTombstones(ctx context.Context, userID uuid.UUID, deletedBefore time.Time) (sync.TombstonePurge, error)
+}
+
+type Collector struct {
+	store     Store
+	retention time.Duration
+	now       func() time.Time
+}
+
+func NewCollector(store Store, retention time.Duration) *Collector {
+	return &Collector{store: store, retention: retention, now: time.Now}
+}
+
+func (c *Collector) CollectOnce(ctx context.Context) (sync.TombstonePurge, error) {
+	var total sync.TombstonePurge
+	userIDs, err := c.store.ListUserIDs(ctx)
+	if err != nil {
+		return total, err
+	}
+
+	cutoff := c.now().UTC().Add(-c.retention)
+	var errs []error
+	for _, userID := range userIDs {
+		purged, err := c.store.PurgeTombstones(ctx, userID, cutoff)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("purge tombstones for user %s: %w", userID, err))
+			continue
+		}
+		total.Add(purged)
+	}
+	return total, errors.Join(errs...)
+}
+
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := c.CollectOnce(ctx)
+		if err != nil {
+			log.Printf("tombstone gc: %v", err)
+		}
+		if purged.Total() > 0 {
+			log.Printf("tombstone gc purged sessions=%d matchSets=%d opponents=%d goals=%d", purged.Sessions, purged.MatchSets, purged.Opponents, purged.Goals)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
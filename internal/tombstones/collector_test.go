@@ -0,0 +1,78 @@
+package tombstones
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lutefd/baseline-api/internal/domain/sync"
+)
+
+type tombstoneStoreMock struct {
+	userIDs []uuid.UUID
+	purges  map[uuid.UUID]sync.TombstonePurge
+	failFor uuid.UUID
+
+	cutoffs []time.Time
+}
+
+func (m *tombstoneStoreMock) ListUserIDs(_ context.Context) ([]uuid.UUID, error) {
+	return m.userIDs, nil
+}
+
+func (m *tombstoneStoreMock) PurgeTombstones(_ context.Context, userID uuid.UUID, deletedBefore time.Time) (sync.TombstonePurge, error) {
+	m.cutoffs = append(m.cutoffs, deletedBefore)
+	if userID == m.failFor {
+		return sync.TombstonePurge{}, errors.New("purge failed")
+	}
+	return m.purges[userID], nil
+}
+
+func TestCollectOnceUsesRetentionCutoffAndSumsPurges(t *testing.T) {
+	first := uuid.New()
+	second := uuid.New()
+	mock := &tombstoneStoreMock{
+		userIDs: []uuid.UUID{first, second},
+		purges: map[uuid.UUID]sync.TombstonePurge{
+			first:  {Sessions: 2, MatchSets: 3},
+			second: {Sessions: 1, Opponents: 1},
+		},
+	}
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	collector := NewCollector(mock, 30*24*time.Hour)
+	collector.now = func() time.Time { return now }
+
+	total, err := collector.CollectOnce(context.Background())
+	if err != nil {
+		t.Fatalf("collect failed: %v", err)
+	}
+	if total.Sessions != 3 || total.MatchSets != 3 || total.Opponents != 1 {
+		t.Fatalf("unexpected purge totals: %+v", total)
+	}
+	want := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, cutoff := range mock.cutoffs {
+		if !cutoff.Equal(want) {
+			t.Fatalf("expected cutoff %s, got %s", want, cutoff)
+		}
+	}
+}
+
+func TestCollectOnceContinuesAfterUserFailure(t *testing.T) {
+	failing := uuid.New()
+	healthy := uuid.New()
+	mock := &tombstoneStoreMock{
+		userIDs: []uuid.UUID{failing, healthy},
+		purges:  map[uuid.UUID]sync.TombstonePurge{healthy: {Sessions: 4}},
+		failFor: failing,
+	}
+
+	total, err := NewCollector(mock, time.Hour).CollectOnce(context.Background())
+	if err == nil {
+		t.Fatalf("expected error for failing user")
+	}
+	if total.Sessions != 4 {
+		t.Fatalf("expected healthy user to be purged, got %+v", total)
+	}
+}
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS match_sets_tombstone_idx;
+DROP INDEX IF EXISTS opponents_tombstone_idx;
+DROP INDEX IF EXISTS sessions_tombstone_idx;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS tombstones_purged_through;
+
+DROP TABLE IF EXISTS sync_devices;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS sync_devices (
+    user_id uuid NOT NULL REFERENCES users(id),
+    device_id text NOT NULL,
+    last_pulled_at timestamptz NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, device_id)
+);
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS tombstones_purged_through timestamptz NULL;
+
+CREATE INDEX IF NOT EXISTS sessions_tombstone_idx
+    ON sessions (user_id, deleted_at)
+    WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS opponents_tombstone_idx
+    ON opponents (user_id, deleted_at)
+    WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS match_sets_tombstone_idx
+    ON match_sets (session_id, deleted_at)
+    WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS sync_pending (
+    user_id uuid NOT NULL REFERENCES users(id),
+    entity_type text NOT NULL CHECK (entity_type IN ('session', 'matchSet')),
+    entity_id uuid NOT NULL,
+    parent_type text NOT NULL CHECK (parent_type IN ('opponent', 'session')),
+    parent_id uuid NOT NULL,
+    payload jsonb NOT NULL,
+    updated_at timestamptz NOT NULL,
+    received_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, entity_type, entity_id)
+);
+
+CREATE INDEX IF NOT EXISTS sync_pending_parent_idx
+    ON sync_pending (user_id, parent_type, parent_id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS projection_accumulators (
+    user_id uuid NOT NULL REFERENCES users(id),
+    scope text NOT NULL CHECK (scope IN ('user', 'opponent', 'week')),
+    scope_key text NOT NULL,
+    state jsonb NOT NULL,
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, scope, scope_key)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS projection_applied_events;
+DROP TABLE IF EXISTS outbox;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id bigserial PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id),
+    event_name text NOT NULL,
+    payload jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts int NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    last_error text,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    delivered_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS outbox_due_idx
+    ON outbox (next_attempt_at, id)
+    WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS outbox_user_pending_idx
+    ON outbox (user_id, event_name)
+    WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS projection_applied_events (
+    event_id bigint PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id),
+    applied_at timestamptz NOT NULL DEFAULT now()
+);
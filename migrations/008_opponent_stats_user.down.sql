@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS opponent_stats_user_idx;
+
+ALTER TABLE opponent_stats
+    DROP COLUMN IF EXISTS user_id;
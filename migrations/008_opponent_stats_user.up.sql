@@ -0,0 +1,26 @@
+ALTER TABLE opponent_stats
+    ADD COLUMN IF NOT EXISTS user_id uuid REFERENCES users(id);
+
+UPDATE opponent_stats os
+SET user_id = o.user_id
+FROM opponents o
+WHERE o.id = os.opponent_id AND os.user_id IS NULL;
+
+DELETE FROM opponent_stats WHERE user_id IS NULL;
+
+ALTER TABLE opponent_stats
+    ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS opponent_stats_user_idx
+    ON opponent_stats (user_id);
+
+-- Rows for opponents whose matches were all deleted or reassigned were never
+-- cleaned up by earlier recomputes.
+DELETE FROM opponent_stats os
+WHERE NOT EXISTS (
+    SELECT 1 FROM sessions s
+    WHERE s.opponent_id = os.opponent_id
+      AND s.user_id = os.user_id
+      AND s.session_type IN ('match', 'friendly')
+      AND s.deleted_at IS NULL
+);
@@ -0,0 +1,13 @@
+DELETE FROM projection_accumulators WHERE scope IN ('month', 'year');
+
+ALTER TABLE projection_accumulators
+    DROP CONSTRAINT IF EXISTS projection_accumulators_scope_check;
+ALTER TABLE projection_accumulators
+    ADD CONSTRAINT projection_accumulators_scope_check
+    CHECK (scope IN ('user', 'opponent', 'week'));
+
+DROP TABLE IF EXISTS yearly_stats;
+DROP TABLE IF EXISTS monthly_stats;
+
+ALTER TABLE weekly_stats
+    DROP COLUMN IF EXISTS sessions_played;
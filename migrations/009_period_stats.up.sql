@@ -0,0 +1,88 @@
+ALTER TABLE weekly_stats
+    ADD COLUMN IF NOT EXISTS sessions_played int NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS monthly_stats (
+    user_id uuid NOT NULL REFERENCES users(id),
+    month_start_date date NOT NULL,
+    sessions_played int NOT NULL DEFAULT 0,
+    avg_composure numeric NOT NULL DEFAULT 0,
+    avg_rushing_index numeric NOT NULL DEFAULT 0,
+    win_rate numeric NOT NULL DEFAULT 0,
+    matches_played int NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, month_start_date)
+);
+
+CREATE TABLE IF NOT EXISTS yearly_stats (
+    user_id uuid NOT NULL REFERENCES users(id),
+    year_start_date date NOT NULL,
+    sessions_played int NOT NULL DEFAULT 0,
+    avg_composure numeric NOT NULL DEFAULT 0,
+    avg_rushing_index numeric NOT NULL DEFAULT 0,
+    win_rate numeric NOT NULL DEFAULT 0,
+    matches_played int NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, year_start_date)
+);
+
+ALTER TABLE projection_accumulators
+    DROP CONSTRAINT IF EXISTS projection_accumulators_scope_check;
+ALTER TABLE projection_accumulators
+    ADD CONSTRAINT projection_accumulators_scope_check
+    CHECK (scope IN ('user', 'opponent', 'week', 'month', 'year'));
+
+-- Backfill the new columns and tables from live sessions, bucketed in UTC like
+-- stats.PeriodStart.
+CREATE TEMP TABLE period_backfill ON COMMIT DROP AS
+SELECT
+    user_id,
+    (date AT TIME ZONE 'UTC') AS day,
+    composure,
+    CASE WHEN duration_minutes > 0
+        THEN (rushed_shots + unforced_errors)::numeric / duration_minutes
+        ELSE 0 END AS rushing_index,
+    session_type IN ('match', 'friendly') AS is_match,
+    session_type IN ('match', 'friendly') AND COALESCE(is_match_win, false) AS is_win
+FROM sessions
+WHERE deleted_at IS NULL;
+
+UPDATE weekly_stats w
+SET sessions_played = b.sessions_played
+FROM (
+    SELECT user_id, date_trunc('week', day)::date AS week_start_date, count(*) AS sessions_played
+    FROM period_backfill
+    GROUP BY 1, 2
+) b
+WHERE w.user_id = b.user_id AND w.week_start_date = b.week_start_date;
+
+INSERT INTO monthly_stats (user_id, month_start_date, sessions_played, avg_composure, avg_rushing_index, win_rate, matches_played)
+SELECT
+    user_id,
+    date_trunc('month', day)::date,
+    count(*),
+    round(avg(composure), 4),
+    round(avg(rushing_index), 4),
+    CASE WHEN count(*) FILTER (WHERE is_match) > 0
+        THEN round(count(*) FILTER (WHERE is_win)::numeric / count(*) FILTER (WHERE is_match), 4)
+        ELSE 0 END,
+    count(*) FILTER (WHERE is_match)
+FROM period_backfill
+GROUP BY 1, 2
+ON CONFLICT DO NOTHING;
+
+INSERT INTO yearly_stats (user_id, year_start_date, sessions_played, avg_composure, avg_rushing_index, win_rate, matches_played)
+SELECT
+    user_id,
+    date_trunc('year', day)::date,
+    count(*),
+    round(avg(composure), 4),
+    round(avg(rushing_index), 4),
+    CASE WHEN count(*) FILTER (WHERE is_match) > 0
+        THEN round(count(*) FILTER (WHERE is_win)::numeric / count(*) FILTER (WHERE is_match), 4)
+        ELSE 0 END,
+    count(*) FILTER (WHERE is_match)
+FROM period_backfill
+GROUP BY 1, 2
+ON CONFLICT DO NOTHING;
+
+-- Existing accumulators have no month or year scopes; dropping the user rows
+-- makes the next projection update rebuild them from scratch.
+DELETE FROM projection_accumulators WHERE scope = 'user';
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS timezone text NOT NULL DEFAULT 'UTC',
+    ADD COLUMN IF NOT EXISTS week_start smallint NOT NULL DEFAULT 1
+        CHECK (week_start BETWEEN 0 AND 6);
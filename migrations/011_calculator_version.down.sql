@@ -0,0 +1,6 @@
+ALTER TABLE projection_accumulators DROP COLUMN IF EXISTS calculator_version;
+ALTER TABLE yearly_stats DROP COLUMN IF EXISTS calculator_version;
+ALTER TABLE monthly_stats DROP COLUMN IF EXISTS calculator_version;
+ALTER TABLE weekly_stats DROP COLUMN IF EXISTS calculator_version;
+ALTER TABLE opponent_stats DROP COLUMN IF EXISTS calculator_version;
+ALTER TABLE user_stats DROP COLUMN IF EXISTS calculator_version;
@@ -0,0 +1,8 @@
+-- Rows written before versioning get 0, which marks them outdated so the API
+-- rebuilds them on startup.
+ALTER TABLE user_stats ADD COLUMN IF NOT EXISTS calculator_version int NOT NULL DEFAULT 0;
+ALTER TABLE opponent_stats ADD COLUMN IF NOT EXISTS calculator_version int NOT NULL DEFAULT 0;
+ALTER TABLE weekly_stats ADD COLUMN IF NOT EXISTS calculator_version int NOT NULL DEFAULT 0;
+ALTER TABLE monthly_stats ADD COLUMN IF NOT EXISTS calculator_version int NOT NULL DEFAULT 0;
+ALTER TABLE yearly_stats ADD COLUMN IF NOT EXISTS calculator_version int NOT NULL DEFAULT 0;
+ALTER TABLE projection_accumulators ADD COLUMN IF NOT EXISTS calculator_version int NOT NULL DEFAULT 0;
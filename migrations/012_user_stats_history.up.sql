@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS user_stats_history (
+    user_id uuid NOT NULL REFERENCES users(id),
+    snapshot_date date NOT NULL,
+    total_sessions int NOT NULL DEFAULT 0,
+    total_matches int NOT NULL DEFAULT 0,
+    win_rate numeric NOT NULL DEFAULT 0,
+    avg_composure numeric NOT NULL DEFAULT 0,
+    avg_rushing_index numeric NOT NULL DEFAULT 0,
+    avg_unforced_errors_per_min numeric NOT NULL DEFAULT 0,
+    improvement_slope_composure numeric NOT NULL DEFAULT 0,
+    improvement_slope_rushing numeric NOT NULL DEFAULT 0,
+    calculator_version int NOT NULL DEFAULT 0,
+    recorded_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, snapshot_date)
+);
+
+-- Seed the history with the current projections so every user has a
+-- starting point.
+INSERT INTO user_stats_history (
+    user_id, snapshot_date, total_sessions, total_matches, win_rate, avg_composure, avg_rushing_index,
+    avg_unforced_errors_per_min, improvement_slope_composure, improvement_slope_rushing, calculator_version, recorded_at
+)
+SELECT
+    s.user_id, (s.last_calculated_at AT TIME ZONE u.timezone)::date, s.total_sessions, s.total_matches, s.win_rate,
+    s.avg_composure, s.avg_rushing_index, s.avg_unforced_errors_per_min, s.improvement_slope_composure,
+    s.improvement_slope_rushing, s.calculator_version, s.last_calculated_at
+FROM user_stats s
+JOIN users u ON u.id = s.user_id
+ON CONFLICT DO NOTHING;
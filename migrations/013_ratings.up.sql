@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS player_ratings (
+    user_id uuid PRIMARY KEY REFERENCES users(id),
+    rating numeric NOT NULL DEFAULT 1500,
+    rating_deviation numeric NOT NULL DEFAULT 350,
+    volatility numeric NOT NULL DEFAULT 0.06,
+    matches_rated int NOT NULL DEFAULT 0,
+    last_match_at timestamptz,
+    strength_adjusted_win_rate numeric,
+    calculator_version int NOT NULL DEFAULT 0,
+    last_calculated_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS opponent_ratings (
+    user_id uuid NOT NULL REFERENCES users(id),
+    opponent_id uuid NOT NULL REFERENCES opponents(id),
+    rating numeric NOT NULL DEFAULT 1500,
+    rating_deviation numeric NOT NULL DEFAULT 350,
+    volatility numeric NOT NULL DEFAULT 0.06,
+    matches_rated int NOT NULL DEFAULT 0,
+    last_match_at timestamptz,
+    calculator_version int NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, opponent_id)
+);
+
+-- One row per rated match, holding both ratings after it.
+CREATE TABLE IF NOT EXISTS rating_history (
+    user_id uuid NOT NULL REFERENCES users(id),
+    session_id uuid NOT NULL,
+    opponent_id uuid NOT NULL,
+    match_date timestamptz NOT NULL,
+    won boolean NOT NULL,
+    score numeric NOT NULL,
+    expected_score numeric NOT NULL,
+    player_rating numeric NOT NULL,
+    player_rating_deviation numeric NOT NULL,
+    player_volatility numeric NOT NULL,
+    player_matches int NOT NULL,
+    opponent_rating numeric NOT NULL,
+    opponent_rating_deviation numeric NOT NULL,
+    opponent_volatility numeric NOT NULL,
+    opponent_matches int NOT NULL,
+    PRIMARY KEY (user_id, session_id)
+);
+
+CREATE INDEX IF NOT EXISTS rating_history_user_date_idx
+    ON rating_history (user_id, match_date);
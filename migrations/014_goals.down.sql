@@ -0,0 +1,8 @@
+DELETE FROM sync_pending WHERE entity_type = 'goal';
+ALTER TABLE sync_pending
+    DROP CONSTRAINT IF EXISTS sync_pending_entity_type_check;
+ALTER TABLE sync_pending
+    ADD CONSTRAINT sync_pending_entity_type_check
+    CHECK (entity_type IN ('session', 'matchSet'));
+
+DROP TABLE IF EXISTS goals;
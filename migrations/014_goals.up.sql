@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS goals (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id),
+    title text NOT NULL,
+    metric text NOT NULL,
+    comparator text NOT NULL CHECK (comparator IN ('lt', 'lte', 'gt', 'gte')),
+    target numeric NOT NULL,
+    session_type text NULL CHECK (session_type IN ('class', 'friendly', 'match')),
+    opponent_id uuid NULL REFERENCES opponents(id),
+    window_sessions int NULL CHECK (window_sessions > 0),
+    window_days int NULL CHECK (window_days > 0),
+    required_count int NULL CHECK (required_count > 0 AND required_count <= window_sessions),
+    starts_at timestamptz NOT NULL,
+    ends_at timestamptz NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    deleted_at timestamptz NULL,
+    CHECK (window_sessions IS NULL OR window_days IS NULL)
+);
+
+CREATE INDEX IF NOT EXISTS goals_user_updated_idx
+    ON goals (user_id, updated_at);
+CREATE INDEX IF NOT EXISTS goals_active_idx
+    ON goals (user_id, starts_at)
+    WHERE deleted_at IS NULL;
+
+ALTER TABLE sync_pending
+    DROP CONSTRAINT IF EXISTS sync_pending_entity_type_check;
+ALTER TABLE sync_pending
+    ADD CONSTRAINT sync_pending_entity_type_check
+    CHECK (entity_type IN ('session', 'matchSet', 'goal'));
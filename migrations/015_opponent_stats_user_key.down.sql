@@ -0,0 +1,8 @@
+CREATE INDEX IF NOT EXISTS opponent_stats_user_idx
+    ON opponent_stats (user_id);
+
+ALTER TABLE opponent_stats
+    DROP CONSTRAINT IF EXISTS opponent_stats_pkey;
+
+ALTER TABLE opponent_stats
+    ADD CONSTRAINT opponent_stats_pkey PRIMARY KEY (opponent_id);
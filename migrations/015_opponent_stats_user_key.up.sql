@@ -0,0 +1,7 @@
+ALTER TABLE opponent_stats
+    DROP CONSTRAINT IF EXISTS opponent_stats_pkey;
+
+ALTER TABLE opponent_stats
+    ADD CONSTRAINT opponent_stats_pkey PRIMARY KEY (user_id, opponent_id);
+
+DROP INDEX IF EXISTS opponent_stats_user_idx;
@@ -0,0 +1 @@
+ALTER TABLE player_ratings DROP COLUMN IF EXISTS surprise_sum;
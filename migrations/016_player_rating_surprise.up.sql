@@ -0,0 +1,6 @@
+-- Ratings now carry their own version and extend incrementally from the
+-- stored surprise sum. Existing rows are marked outdated so the API backfills
+-- them on startup.
+ALTER TABLE player_ratings ADD COLUMN IF NOT EXISTS surprise_sum double precision NOT NULL DEFAULT 0;
+UPDATE player_ratings SET calculator_version = 0;
+UPDATE opponent_ratings SET calculator_version = 0;
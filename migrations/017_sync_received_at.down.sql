@@ -0,0 +1,4 @@
+ALTER TABLE goals DROP COLUMN IF EXISTS received_at;
+ALTER TABLE opponents DROP COLUMN IF EXISTS received_at;
+ALTER TABLE match_sets DROP COLUMN IF EXISTS received_at;
+ALTER TABLE sessions DROP COLUMN IF EXISTS received_at;
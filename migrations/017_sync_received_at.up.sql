@@ -0,0 +1,7 @@
+-- Server-side receipt time of the latest write, compared with the server-side
+-- last_pulled_at of devices when purging tombstones. Existing rows count as
+-- received now, which only delays their purge.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS received_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE match_sets ADD COLUMN IF NOT EXISTS received_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE opponents ADD COLUMN IF NOT EXISTS received_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE goals ADD COLUMN IF NOT EXISTS received_at timestamptz NOT NULL DEFAULT now();
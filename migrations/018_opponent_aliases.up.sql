@@ -0,0 +1,9 @@
+-- Opponent IDs created on a device and merged into an existing opponent with
+-- the same identity key.
+CREATE TABLE IF NOT EXISTS opponent_aliases (
+    user_id uuid NOT NULL REFERENCES users(id),
+    alias_id uuid NOT NULL,
+    canonical_id uuid NOT NULL REFERENCES opponents(id) ON DELETE CASCADE,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, alias_id)
+);